@@ -0,0 +1,240 @@
+package gos
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Takes a struct and returns the values of its fields that correspond to the
+columns generated by `ColsInsert` and `ColsAssign`, in the same order. This
+allows to generate `insert` and `update` statements without renumbering the
+placeholders. The input must be a struct or a struct pointer. A nil pointer is
+fine and produces a nil result. Fields of embedded nil struct pointers produce
+nil values. Panics on other inputs. Example:
+
+	query := fmt.Sprintf(`update persons set %v where id = $1`, ColsAssign(person, 1))
+	args := append([]interface{}{person.Id}, StructArgs(person)...)
+
+Fields whose `db` tag includes the `zeronull` option produce nil instead of zero
+values. This is useful for nullable timestamps, since a zero `time.Time` would
+otherwise be stored as "0001-01-01". Zero values are detected via the `IsZero`
+method if available, falling back on `reflect.Value.IsZero`. Example:
+
+	type Person struct {
+		DeletedAt time.Time `db:"deleted_at,zeronull"`
+	}
+
+Similarly, string fields whose `db` tag includes the `emptynull` option produce
+nil instead of empty strings, which suits schemas where null means "unset":
+
+	type Person struct {
+		Nickname string `db:"nickname,emptynull"`
+	}
+
+Fields whose `db` tag includes the `redact` option produce values wrapped in
+`RedactedArg`, which are passed to the database as usual, but are masked in
+audit entries and in formatted output. This allows to declare sensitive fields
+once, on the struct:
+
+	type Person struct {
+		Ssn string `db:"ssn,redact"`
+	}
+*/
+func StructArgs(src interface{}) []interface{} {
+	rval := reflect.ValueOf(src)
+	rtype := refut.RtypeDeref(reflect.TypeOf(src))
+
+	if rtype == nil || rtype.Kind() != reflect.Struct {
+		panic(ErrInvalidInput.while(`generating struct arguments`).because(
+			fmt.Errorf(`expected struct, got %q`, rtype),
+		))
+	}
+
+	if refut.IsRvalNil(rval) {
+		return nil
+	}
+	rval = refut.RvalDeref(rval)
+
+	specs := writableColSpecs(structRtypeColSpecs(rtype))
+	out := make([]interface{}, 0, len(specs))
+	for _, spec := range specs {
+		out = append(out, structArg(rval, spec))
+	}
+	return out
+}
+
+/*
+Converts an argument value before it's passed to the driver. Used via
+`RegisterArgConverter`.
+*/
+type ConvertFunc func(src interface{}) (interface{}, error)
+
+/*
+Registers a function that converts query arguments of the given type before
+they're passed to the driver. Applies to all queries executed by Gos, including
+`Query`, `QueryScanner` and their variants. This is the argument-side
+counterpart of `RegisterFieldDecoder` and `RegisterColumnDecoder`, useful for
+types the driver doesn't support, or for normalizing values. Example:
+
+	gos.RegisterArgConverter(UserId(0), func(src interface{}) (interface{}, error) {
+		return int64(src.(UserId)), nil
+	})
+
+Matches the exact dynamic type of the argument: converters registered for `T`
+don't apply to `*T`. Registering another converter for the same type replaces
+the previous one. Should be called during initialization. For arguments passed
+to other APIs, such as `database/sql` directly, see `ConvertArgs`.
+*/
+func RegisterArgConverter(typ interface{}, fun ConvertFunc) {
+	argConverters.Lock()
+	defer argConverters.Unlock()
+	argConverters.types[reflect.TypeOf(typ)] = fun
+}
+
+/*
+Converts query arguments the same way as queries executed by Gos: via the
+converters registered with `RegisterArgConverter`, and the built-in ones, such
+as for byte arrays. `RedactedArg` values are unwrapped. Useful for arguments
+passed to other APIs, for example the output of `StructArgs` or the arguments
+of a "sqlb" query executed via "database/sql":
+
+	args, err := gos.ConvertArgs(gos.StructArgs(person))
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, query, args...)
+
+Returns the input as-is if there's nothing to convert, otherwise a modified
+copy, without mutating the input. Conversion errors are `ErrInvalidInput`.
+*/
+func ConvertArgs(args []interface{}) ([]interface{}, error) {
+	return convertArgs(args)
+}
+
+/* Internal */
+
+func structArg(rval reflect.Value, spec tColSpec) interface{} {
+	val := rvalFieldByPathOrNil(rval, spec.fieldPath)
+	if sfieldHasColumnOpt(spec.sfield, `zeronull`) && isZeroArg(val) {
+		return nil
+	}
+	if sfieldHasColumnOpt(spec.sfield, `emptynull`) && isEmptyStringArg(val) {
+		return nil
+	}
+	if sfieldHasColumnOpt(spec.sfield, `redact`) && !refut.IsNil(val) {
+		return RedactedArg{val}
+	}
+	return val
+}
+
+func isZeroArg(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+
+	rval := reflect.ValueOf(val)
+	if rval.IsZero() {
+		return true
+	}
+
+	zeroer, ok := val.(interface{ IsZero() bool })
+	return ok && zeroer.IsZero()
+}
+
+// True for empty strings, including named string types and pointers to them.
+func isEmptyStringArg(val interface{}) bool {
+	rval := refut.RvalDeref(reflect.ValueOf(val))
+	return rval.IsValid() && rval.Kind() == reflect.String && rval.Len() == 0
+}
+
+var argConverters = struct {
+	sync.RWMutex
+	types map[reflect.Type]ConvertFunc
+}{types: map[reflect.Type]ConvertFunc{}}
+
+/*
+Returns the input as-is if there's nothing to convert. Otherwise returns a
+modified copy, without mutating the input.
+*/
+func convertArgs(args []interface{}) ([]interface{}, error) {
+	var out []interface{}
+	for i, arg := range args {
+		val, ok, err := convertArg(arg)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			return nil, Err{
+				Code:  ErrCodeInvalidInput,
+				While: fmt.Sprintf(`converting argument %d`, i+1),
+				Cause: err,
+			}
+		}
+
+		if out == nil {
+			out = copyInterfaceSlice(args)
+		}
+		out[i] = val
+	}
+
+	if out == nil {
+		return args, nil
+	}
+	return out, nil
+}
+
+/*
+Returns the converted argument and true, or the original argument and false if
+there's nothing to convert. Redacted arguments are unwrapped, see `RedactedArg`.
+*/
+func convertArg(arg interface{}) (interface{}, bool, error) {
+	redacted, ok := arg.(RedactedArg)
+	if ok {
+		val, _, err := convertArg(redacted.Val)
+		return val, true, err
+	}
+
+	fun := findArgConverter(reflect.TypeOf(arg))
+	if fun == nil {
+		return arg, false, nil
+	}
+
+	val, err := fun(arg)
+	return val, true, err
+}
+
+/*
+Finds the converter for the given argument type: registered converters take
+priority over built-in ones. Built-in converters don't apply to types which
+implement `driver.Valuer`, which are converted by the driver. The lock is
+released before returning, which allows converters to register other
+converters.
+*/
+func findArgConverter(rtype reflect.Type) ConvertFunc {
+	argConverters.RLock()
+	fun := argConverters.types[rtype]
+	argConverters.RUnlock()
+
+	if fun != nil {
+		return fun
+	}
+
+	if isRtypeValuer(rtype) {
+		return nil
+	}
+	if isRtypeByteArray(rtype) {
+		return convertByteArray
+	}
+	return nil
+}
+
+func isRtypeValuer(rtype reflect.Type) bool {
+	return rtype != nil && rtype.Implements(driverValuerRtype)
+}
+
+var driverValuerRtype = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
@@ -0,0 +1,176 @@
+package gos
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+Describes a statement executed by Gos, passed to the `AuditSink`. Arguments are
+recorded as passed to Gos, before conversion via `RegisterArgConverter`, and
+redacted according to `Audit.Rules`.
+*/
+type AuditEntry struct {
+	Query    string
+	Args     []interface{}
+	Start    time.Time
+	Duration time.Duration // Time until the driver returned rows or a result.
+	Err      error
+}
+
+/*
+Receives audit entries, typically writing them to a log or a compliance store.
+Called synchronously after each statement, and must be safe for concurrent use.
+*/
+type AuditSink func(ctx context.Context, entry AuditEntry)
+
+/*
+Redacts a query argument before it's passed to the `AuditSink`. Receives the
+query, the zero-based index of the argument, and the argument itself. Returns
+the replacement and true if the argument must be redacted. Rules don't affect
+the arguments passed to the database.
+*/
+type RedactRule func(query string, index int, arg interface{}) (interface{}, bool)
+
+// Replacement used for redacted arguments by the built-in rules.
+const Redacted = `[REDACTED]`
+
+/*
+Returns a rule that redacts every argument whose index is in the given list,
+for queries equal to the given one.
+*/
+func RedactArgsAt(query string, indexes ...int) RedactRule {
+	return func(val string, index int, _ interface{}) (interface{}, bool) {
+		return Redacted, val == query && intIndex(indexes, index) >= 0
+	}
+}
+
+// Returns a rule that redacts every argument that satisfies the predicate.
+func RedactArgsWhere(fun func(arg interface{}) bool) RedactRule {
+	return func(_ string, _ int, arg interface{}) (interface{}, bool) {
+		return Redacted, fun(arg)
+	}
+}
+
+/*
+Wraps a sensitive query argument. Gos unwraps it before passing it to the
+database, but the audit log always records it as `Redacted`, regardless of
+`Audit.Rules`. When formatted via "fmt" with any verb, including "%#v", for
+example in debug logs, the value is masked as well. Produced by `StructArgs`
+for fields tagged with `redact`, and may be used directly:
+
+	err := gos.Query(ctx, conn, nil, query, []interface{}{id, gos.RedactedArg{password}})
+*/
+type RedactedArg struct{ Val interface{} }
+
+// Implement `fmt.Stringer`, masking the value.
+func (self RedactedArg) String() string { return Redacted }
+
+// Implement `fmt.Formatter`, masking the value for every verb.
+func (self RedactedArg) Format(out fmt.State, _ rune) { _, _ = io.WriteString(out, Redacted) }
+
+/*
+Implement `driver.Valuer`, for use outside of Gos, which otherwise unwraps the
+value before passing it to the driver.
+*/
+func (self RedactedArg) Value() (driver.Value, error) {
+	return driver.DefaultParameterConverter.ConvertValue(self.Val)
+}
+
+/*
+Configuration of audit logging. The zero value disables auditing. See
+`SetAudit`.
+*/
+type Audit struct {
+	// Receives an entry for every statement executed by Gos. Required.
+	Sink AuditSink
+	// Applied to arguments in order; the first matching rule wins.
+	Rules []RedactRule
+}
+
+/*
+Enables audit logging for every statement executed by Gos, including `Query`,
+`QueryScanner` and their variants, recording the query and its arguments after
+applying the redaction rules. Example:
+
+	gos.SetAudit(gos.Audit{
+		Sink: func(ctx context.Context, entry gos.AuditEntry) {
+			log.Printf(`query: %v; args: %v; err: %v`, entry.Query, entry.Args, entry.Err)
+		},
+		Rules: []gos.RedactRule{
+			gos.RedactArgsAt(`update persons set password = $2 where id = $1`, 1),
+		},
+	})
+
+Arguments of type `RedactedArg`, such as those produced by `StructArgs` for
+fields tagged with `redact`, are always redacted. The zero value disables
+auditing. Should be called during initialization.
+*/
+func SetAudit(val Audit) {
+	audit.Lock()
+	audit.val = val
+	audit.Unlock()
+}
+
+/* Internal */
+
+var audit struct {
+	sync.RWMutex
+	val Audit
+}
+
+func getAudit() Audit {
+	audit.RLock()
+	defer audit.RUnlock()
+	return audit.val
+}
+
+/*
+Starts recording a statement. Returns nil if auditing is disabled. Otherwise
+the returned function must be called with the outcome of the statement.
+*/
+func auditStart(ctx context.Context, query string, args []interface{}) func(error) {
+	conf := getAudit()
+	if conf.Sink == nil {
+		return nil
+	}
+
+	start := time.Now()
+	return func(err error) {
+		conf.Sink(ctx, AuditEntry{
+			Query:    query,
+			Args:     redactArgs(conf.Rules, query, args),
+			Start:    start,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+	}
+}
+
+// Returns a redacted copy of the arguments, without mutating the input.
+func redactArgs(rules []RedactRule, query string, args []interface{}) []interface{} {
+	out := copyInterfaceSlice(args)
+	for index, arg := range out {
+		out[index] = redactArg(rules, query, index, arg)
+	}
+	return out
+}
+
+func redactArg(rules []RedactRule, query string, index int, arg interface{}) interface{} {
+	_, ok := arg.(RedactedArg)
+	if ok {
+		return Redacted
+	}
+
+	for _, rule := range rules {
+		val, ok := rule(query, index, arg)
+		if ok {
+			return val
+		}
+	}
+	return arg
+}
@@ -0,0 +1,77 @@
+package gos
+
+import "context"
+
+/*
+Queue of independent queries, which are executed together by `RunBatch`,
+reducing round trips where the driver supports pipelining. Each item has its
+own destination and its own error:
+
+	var batch gos.Batch
+	var person Person
+	var count int64
+	batch.Queue(`select * from persons where id = $1`, []interface{}{id}, &person)
+	batch.Queue(`select count(*) from events`, nil, &count)
+	batch.Queue(`update stats set visits = visits + 1`, nil, nil)
+
+	err := gos.RunBatch(ctx, conn, &batch)
+
+With "database/sql", items are executed sequentially, since the package has no
+pipelining; see "github.com/mitranim/gos/gospgx" for pipelined execution via
+pgx. The zero value is an empty batch ready to use.
+*/
+type Batch struct {
+	Items []BatchItem
+}
+
+// Single query of a `Batch`. Same as the arguments of `Query`.
+type BatchItem struct {
+	Query string
+	Args  []interface{}
+	Dest  interface{} // Nil for queries without results.
+}
+
+/*
+Appends a query to the batch. The destination follows the same rules as for
+`Query`, and may be nil for queries without results.
+*/
+func (self *Batch) Queue(query string, args []interface{}, dest interface{}) {
+	self.Items = append(self.Items, BatchItem{Query: query, Args: args, Dest: dest})
+}
+
+// Returns the amount of queued items.
+func (self *Batch) Len() int { return len(self.Items) }
+
+/*
+Executes every item of the batch via `Query`, in order. Items are independent:
+a failed item doesn't prevent executing the next ones. Returns nil when every
+item has succeeded, otherwise `BatchErr` with one entry per item. Note that in
+a transaction, Postgres rejects further queries after an error, so the items
+after a failed one will fail too.
+*/
+func RunBatch(ctx context.Context, conn QueryExecer, batch *Batch) error {
+	return Conf{}.RunBatch(ctx, conn, batch)
+}
+
+// Variant of `RunBatch` that uses the given configuration.
+func (self Conf) RunBatch(ctx context.Context, conn QueryExecer, batch *Batch) error {
+	if batch == nil {
+		return nil
+	}
+
+	var errs BatchErr
+	for i, item := range batch.Items {
+		err := self.Query(ctx, conn, item.Dest, item.Query, item.Args)
+		if err != nil {
+			if errs == nil {
+				errs = make(BatchErr, len(batch.Items))
+			}
+			errs[i] = err
+		}
+	}
+
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
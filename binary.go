@@ -0,0 +1,78 @@
+package gos
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Decodes a binary column into a fixed-size byte array such as `[32]byte`, which
+is convenient for hashes and binary keys. The column length must match the
+array length exactly. Used as a `DecodeFunc` for fields whose type satisfies
+`isRtypeByteArray`, and for scalar destinations of such types. Pointers are
+allocated as needed, and nil pointers accept nulls.
+*/
+func decodeByteArray(src interface{}, dest reflect.Value) error {
+	if dest.Kind() == reflect.Ptr {
+		if src == nil {
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		return decodeByteArray(src, dest.Elem())
+	}
+
+	if src == nil {
+		return ErrNull.because(fmt.Errorf(`can't decode null into non-nilable %q`, dest.Type()))
+	}
+
+	var buf []byte
+	switch src := src.(type) {
+	case []byte:
+		buf = src
+	case string:
+		buf = []byte(src)
+	default:
+		return fmt.Errorf(`can't decode %T into %q`, src, dest.Type())
+	}
+
+	if len(buf) != dest.Len() {
+		return fmt.Errorf(`can't decode %d bytes into %q: length mismatch`, len(buf), dest.Type())
+	}
+
+	reflect.Copy(dest, reflect.ValueOf(buf))
+	return nil
+}
+
+/*
+Converts a fixed-size byte array, or a pointer to one, into a byte slice, which
+is supported by drivers. Used by `convertArgs` for types without a registered
+converter.
+*/
+func convertByteArray(src interface{}) (interface{}, error) {
+	rval := reflect.ValueOf(src)
+	if refut.IsRvalNil(rval) {
+		return nil, nil
+	}
+	rval = refut.RvalDeref(rval)
+
+	out := make([]byte, rval.Len())
+	reflect.Copy(reflect.ValueOf(out), rval)
+	return out, nil
+}
+
+/*
+True for fixed-size byte arrays, or pointers to them, that don't implement
+`sql.Scanner`.
+*/
+func isRtypeByteArray(rtype reflect.Type) bool {
+	rtype = refut.RtypeDeref(rtype)
+	return rtype != nil &&
+		rtype.Kind() == reflect.Array &&
+		rtype.Elem().Kind() == reflect.Uint8 &&
+		!isRtypeScannable(rtype)
+}
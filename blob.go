@@ -0,0 +1,80 @@
+package gos
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+/*
+Destination for large binary or text columns, which writes the column contents
+into the given writer during scanning, instead of keeping them in the result.
+Useful for serving files stored in the database:
+
+	var file struct {
+		Name string   `db:"name"`
+		Body gos.Blob `db:"body"`
+	}
+	file.Body.Writer = httpResponseWriter
+	err := gos.Query(ctx, conn, &file, `select name, body from files where id = $1`, args)
+
+Note that `database/sql` doesn't support streaming individual column values:
+drivers always read the entire value into memory, and "database/sql" copies it
+once more when scanning it for the field decoder. This doesn't retain the
+contents after scanning, but doesn't reduce the peak memory usage below the
+size of the value.
+
+The writer must be set before scanning. This means `Blob` fields are usable
+with single-struct destinations and with `Scanner.Scan` on a reused struct, but
+not with slice destinations, where the elements are allocated by Gos.
+*/
+type Blob struct {
+	// Destination of the column contents. Required.
+	Writer io.Writer
+	// Amount of bytes written by the last scan.
+	Len int64
+	// True if the column was null during the last scan.
+	Null bool
+}
+
+// Implement `sql.Scanner`.
+func (self *Blob) Scan(src interface{}) error {
+	self.Len = 0
+	self.Null = src == nil
+
+	if self.Null {
+		return nil
+	}
+
+	if self.Writer == nil {
+		return fmt.Errorf(`can't scan into %T without a writer`, self)
+	}
+
+	var count int
+	var err error
+
+	switch src := src.(type) {
+	case []byte:
+		count, err = self.Writer.Write(src)
+	case string:
+		count, err = io.WriteString(self.Writer, src)
+	default:
+		return fmt.Errorf(`can't scan %T into %T`, src, self)
+	}
+
+	self.Len = int64(count)
+	return err
+}
+
+/* Internal */
+
+/*
+Used as a `DecodeFunc` for `Blob` fields. Unlike the default decoding of
+`sql.Scanner` fields, this scans into the existing field, preserving its
+writer.
+*/
+func decodeBlob(src interface{}, dest reflect.Value) error {
+	return dest.Addr().Interface().(*Blob).Scan(src)
+}
+
+var blobRtype = reflect.TypeOf(Blob{})
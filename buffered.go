@@ -0,0 +1,213 @@
+package gos
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+Wraps the scanner, buffering decoded rows up to the given limit, which allows
+to iterate them again via `BufferedScanner.Rewind` without re-querying. Useful
+for modest result sets that need two passes, such as a validation pass followed
+by a processing pass:
+
+	scan, err := gos.QueryScanner(ctx, conn, query, args)
+	if err != nil {
+		return err
+	}
+
+	buf := gos.BufferScanner(scan, 1024)
+	defer buf.Close()
+
+	for buf.Next() {
+		var val Person
+		err := buf.Scan(&val)
+		// Validate.
+	}
+
+	buf.Rewind()
+
+	for buf.Next() {
+		var val Person
+		err := buf.Scan(&val)
+		// Process.
+	}
+
+Rows are buffered when decoded via `Scan`, including via `ScanChunk` or
+`ScanScalars`, during the first pass; rows skipped during the first pass can't
+be decoded later. Buffered values are deep-copied into each destination, so
+callers may freely modify them. Exceeding the limit stops the iteration with
+`ErrInvalidInput`, see `BufferedScanner.Err`. A non-positive limit means no
+limit. Replaying works after `Close`, which only releases the underlying rows.
+*/
+func BufferScanner(scan Scanner, limit int) *BufferedScanner {
+	return &BufferedScanner{scan: scan, limit: limit, index: -1}
+}
+
+/*
+Scanner with support for multiple passes, returned by `BufferScanner`.
+Implements `Scanner`. Not safe for concurrent use.
+*/
+type BufferedScanner struct {
+	scan  Scanner
+	limit int
+	rows  [][]reflect.Value // Nil for rows not decoded during the first pass.
+	index int
+	done  bool
+	err   error
+}
+
+// Implement `Scanner`. Closes the underlying scanner, keeping buffered rows.
+func (self *BufferedScanner) Close() error { return self.scan.Close() }
+
+// Implement `Scanner`. Replays buffered rows, then resumes the underlying scanner.
+func (self *BufferedScanner) Next() bool {
+	if self.err != nil {
+		return false
+	}
+
+	if self.index+1 < len(self.rows) {
+		self.index++
+		return true
+	}
+
+	if self.done || !self.scan.Next() {
+		self.done = true
+		return false
+	}
+
+	if self.limit > 0 && len(self.rows) >= self.limit {
+		self.err = ErrInvalidInput.while(`buffering rows`).because(
+			fmt.Errorf(`exceeded the limit of %v rows`, self.limit),
+		)
+		return false
+	}
+
+	self.rows = append(self.rows, nil)
+	self.index++
+	return true
+}
+
+// Implement `Scanner`.
+func (self *BufferedScanner) Err() error {
+	if self.err != nil {
+		return self.err
+	}
+	return self.scan.Err()
+}
+
+// Implement `Scanner`.
+func (self *BufferedScanner) Scan(dest interface{}) error {
+	dests, ok := dest.([]interface{})
+	if !ok {
+		dests = []interface{}{dest}
+	}
+
+	return self.decode(dests, func() error {
+		return self.scan.Scan(dest)
+	})
+}
+
+/*
+Optional method of `Scanner`, see `PeekRow`. Copies the next buffered row, or
+peeks via the underlying scanner when the next row hasn't been buffered yet.
+*/
+func (self *BufferedScanner) Peek(dest interface{}) error {
+	err := validateDestPtr(dest)
+	if err != nil {
+		return err
+	}
+
+	if self.index+1 < len(self.rows) {
+		return self.copyRow(self.index+1, []interface{}{dest})
+	}
+	if self.done || self.err != nil {
+		return ErrNoRows.while(`peeking row`)
+	}
+	return PeekRow(self.scan, dest)
+}
+
+/*
+Optional method of `Scanner`, see `GetScanStats`. Returns the statistics of the
+underlying scanner, which don't include replayed rows.
+*/
+func (self *BufferedScanner) Stats() ScanStats { return GetScanStats(self.scan) }
+
+/*
+Optional method of `Scanner`, see `NextResultSet`. Always returns false:
+buffering supports only one result set.
+*/
+func (self *BufferedScanner) NextResultSet() bool { return false }
+
+/*
+Restarts the iteration from the first buffered row. Rows which haven't been
+reached yet are read from the underlying scanner as usual.
+*/
+func (self *BufferedScanner) Rewind() { self.index = -1 }
+
+// Returns the amount of buffered rows.
+func (self *BufferedScanner) Len() int { return len(self.rows) }
+
+/* Internal */
+
+/*
+Decodes the current row: during the first pass via the given function, which
+decodes into the destinations and is followed by buffering copies of the
+decoded values, and afterwards by copying the buffered values.
+*/
+func (self *BufferedScanner) decode(dests []interface{}, fun func() error) error {
+	if self.index < 0 || self.index >= len(self.rows) {
+		return ErrInvalidInput.while(`decoding buffered row`).because(
+			fmt.Errorf(`no current row, call Next first`),
+		)
+	}
+
+	for _, dest := range dests {
+		err := validateDestPtr(dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	if self.index == len(self.rows)-1 && !self.done && self.rows[self.index] == nil {
+		err := fun()
+		if err != nil {
+			return err
+		}
+
+		vals := make([]reflect.Value, len(dests))
+		for i, dest := range dests {
+			vals[i] = rvalDeepCopy(reflect.ValueOf(dest).Elem())
+		}
+		self.rows[self.index] = vals
+		return nil
+	}
+
+	return self.copyRow(self.index, dests)
+}
+
+// Copies the buffered values of the given row into the destinations.
+func (self *BufferedScanner) copyRow(index int, dests []interface{}) error {
+	vals := self.rows[index]
+	if vals == nil {
+		return ErrScan.while(`decoding buffered row`).because(
+			fmt.Errorf(`row %v wasn't decoded during the first pass`, index),
+		)
+	}
+
+	if len(vals) != len(dests) {
+		return ErrInvalidDest.while(`decoding buffered row`).because(fmt.Errorf(
+			`expected %v destinations, got %v`, len(vals), len(dests),
+		))
+	}
+
+	for i, dest := range dests {
+		rval := reflect.ValueOf(dest).Elem()
+		err := validateMatchingDestType(vals[i].Type(), rval.Type())
+		if err != nil {
+			return err
+		}
+		rval.Set(rvalDeepCopy(vals[i]))
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package gos
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Clears all cached data: generated column lists and decoding specs, which are
+derived from types and column sets. Gos caches this data per type, for the
+lifetime of the process. This is normally fine, since the amount of types in a
+program is finite. Long-running processes that generate types dynamically, for
+example via `reflect.StructOf` or by reloading plugins, may use this to release
+memory.
+*/
+func ClearCaches() {
+	cache.clear()
+}
+
+/*
+Clears all cached data for the given type. Accepts the same inputs as `Cols`,
+but doesn't panic on other inputs.
+*/
+func ClearCachesFor(typ interface{}) {
+	cache.clearType(cacheRtype(reflect.TypeOf(typ)))
+}
+
+// Describes the current state of Gos caches. Returned by `GetCacheStats`.
+type CacheStats struct {
+	// Count of types with cached data.
+	Types int
+	// Total count of cached entries across all types.
+	Entries int
+}
+
+// Returns the current size of Gos caches. See `ClearCaches`.
+func GetCacheStats() CacheStats {
+	return cache.stats()
+}
+
+/*
+Pre-builds and caches the data Gos derives from the given destination types, so
+the first query after startup doesn't pay the cost of reflection, and mapping
+problems in rarely used types surface at startup instead of in production
+traffic. Should be called during initialization, after registering decoders
+and mappers:
+
+	func init() {
+		gos.Register(Person{}, Order{})
+	}
+
+Accepts the same inputs as `Cols`. Panics on the problems reported by
+`ValidateDest`. Caches the output of `Cols`, and the decoding spec for the
+columns listed by `Cols` in the same order, which covers queries that select
+`Cols` of a struct or a slice of structs, with the default `Conf`. Decoding
+specs for other column sets are built on first use, as usual, and so are all
+decoding specs while column decoders are registered, since those depend on
+database types, see `RegisterColumnDecoder`.
+*/
+func Register(types ...interface{}) {
+	for _, typ := range types {
+		err := ValidateDest(typ)
+		if err != nil {
+			panic(err)
+		}
+
+		rtype := colsRtype(typ, `registering type`)
+		Cols(typ)
+
+		_, ok := getMapper(rtype)
+		if ok || hasColumnDecoders() {
+			continue
+		}
+
+		colNames := appendColAliases(nil, structRtypeColSpecs(rtype), nil)
+		_, err = cachedDestSpec(reflect.PtrTo(rtype), colNames, nil, Conf{}.specOpts())
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+/* Internal */
+
+var cache = tCache{types: map[reflect.Type]map[interface{}]interface{}{}}
+
+/*
+Stores arbitrary data, grouped by type to allow per-type invalidation. Cached
+values must never be mutated once stored.
+*/
+type tCache struct {
+	sync.RWMutex
+	types map[reflect.Type]map[interface{}]interface{}
+}
+
+func (self *tCache) get(rtype reflect.Type, key interface{}) (interface{}, bool) {
+	self.RLock()
+	defer self.RUnlock()
+	val, ok := self.types[cacheRtype(rtype)][key]
+	return val, ok
+}
+
+func (self *tCache) set(rtype reflect.Type, key interface{}, val interface{}) {
+	rtype = cacheRtype(rtype)
+
+	self.Lock()
+	defer self.Unlock()
+
+	vals := self.types[rtype]
+	if vals == nil {
+		vals = map[interface{}]interface{}{}
+		self.types[rtype] = vals
+	}
+	vals[key] = val
+}
+
+func (self *tCache) clear() {
+	self.Lock()
+	defer self.Unlock()
+	self.types = map[reflect.Type]map[interface{}]interface{}{}
+}
+
+func (self *tCache) clearType(rtype reflect.Type) {
+	self.Lock()
+	defer self.Unlock()
+	delete(self.types, rtype)
+}
+
+func (self *tCache) stats() (out CacheStats) {
+	self.RLock()
+	defer self.RUnlock()
+	out.Types = len(self.types)
+	for _, vals := range self.types {
+		out.Entries += len(vals)
+	}
+	return
+}
+
+/*
+Dereferences pointers and slices, so that `T`, `*T` and `[]*T` share cache
+entries and are invalidated together.
+*/
+func cacheRtype(rtype reflect.Type) reflect.Type {
+	rtype = refut.RtypeDeref(rtype)
+	if rtype != nil && rtype.Kind() == reflect.Slice {
+		rtype = refut.RtypeDeref(rtype.Elem())
+	}
+	return rtype
+}
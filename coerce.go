@@ -0,0 +1,206 @@
+package gos
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/*
+Implements `Conf.Coerce`, and is used as a `DecodeFunc`. Converts a raw column
+value, as returned by the driver, into a destination of a primitive type,
+accepting the following mismatches in addition to exact matches:
+
+Integers of any width are accepted by any integer or float, as long as they
+fit. Floats without fractional parts are accepted by integers. Numeric strings,
+including byte strings, are accepted by numbers. Integers 0 and 1 and strings
+accepted by `strconv.ParseBool`, such as "t" and "f", are accepted by bools.
+Numbers and bools are accepted by strings, formatted as usual.
+
+Pointers are allocated as needed, and nil pointers accept nulls.
+*/
+func coerce(src interface{}, dest reflect.Value) error {
+	if dest.Kind() == reflect.Ptr {
+		if src == nil {
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		return coerce(src, dest.Elem())
+	}
+
+	if src == nil {
+		return ErrNull.because(fmt.Errorf(`can't coerce null into non-nilable %q`, dest.Type()))
+	}
+
+	buf, ok := src.([]byte)
+	if ok {
+		src = string(buf)
+	}
+
+	switch dest.Kind() {
+	case reflect.Bool:
+		ok = coerceBool(src, dest)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		ok = coerceInt(src, dest)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		ok = coerceUint(src, dest)
+	case reflect.Float32, reflect.Float64:
+		ok = coerceFloat(src, dest)
+	case reflect.String:
+		ok = coerceString(src, dest)
+	}
+
+	if !ok {
+		return fmt.Errorf(`can't coerce %T %v into %q`, src, src, dest.Type())
+	}
+	return nil
+}
+
+func coerceBool(src interface{}, dest reflect.Value) bool {
+	switch src := src.(type) {
+	case bool:
+		dest.SetBool(src)
+		return true
+	case int64:
+		if src == 0 || src == 1 {
+			dest.SetBool(src == 1)
+			return true
+		}
+	case string:
+		val, err := strconv.ParseBool(strings.TrimSpace(src))
+		if err == nil {
+			dest.SetBool(val)
+			return true
+		}
+	}
+	return false
+}
+
+func coerceInt(src interface{}, dest reflect.Value) bool {
+	var val int64
+
+	switch src := src.(type) {
+	case int64:
+		val = src
+	case float64:
+		if src != math.Trunc(src) || src < math.MinInt64 || src >= math.MaxInt64 {
+			return false
+		}
+		val = int64(src)
+	case string:
+		var err error
+		val, err = strconv.ParseInt(strings.TrimSpace(src), 10, 64)
+		if err != nil {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if dest.OverflowInt(val) {
+		return false
+	}
+	dest.SetInt(val)
+	return true
+}
+
+func coerceUint(src interface{}, dest reflect.Value) bool {
+	var val uint64
+
+	switch src := src.(type) {
+	case int64:
+		if src < 0 {
+			return false
+		}
+		val = uint64(src)
+	case float64:
+		if src != math.Trunc(src) || src < 0 || src >= math.MaxUint64 {
+			return false
+		}
+		val = uint64(src)
+	case string:
+		var err error
+		val, err = strconv.ParseUint(strings.TrimSpace(src), 10, 64)
+		if err != nil {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if dest.OverflowUint(val) {
+		return false
+	}
+	dest.SetUint(val)
+	return true
+}
+
+func coerceFloat(src interface{}, dest reflect.Value) bool {
+	var val float64
+
+	switch src := src.(type) {
+	case int64:
+		val = float64(src)
+	case float64:
+		val = src
+	case string:
+		var err error
+		val, err = strconv.ParseFloat(strings.TrimSpace(src), 64)
+		if err != nil {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if dest.OverflowFloat(val) {
+		return false
+	}
+	dest.SetFloat(val)
+	return true
+}
+
+func coerceString(src interface{}, dest reflect.Value) bool {
+	switch src := src.(type) {
+	case string:
+		dest.SetString(src)
+	case int64:
+		dest.SetString(strconv.FormatInt(src, 10))
+	case float64:
+		dest.SetString(strconv.FormatFloat(src, 'f', -1, 64))
+	case bool:
+		dest.SetString(strconv.FormatBool(src))
+	default:
+		return false
+	}
+	return true
+}
+
+/*
+True for primitive types, or pointers to them, that don't implement
+`sql.Scanner`. Other types are decoded as usual even when coercion is enabled.
+*/
+func isRtypeCoercible(rtype reflect.Type) bool {
+	for rtype.Kind() == reflect.Ptr {
+		rtype = rtype.Elem()
+	}
+
+	if isRtypeScannable(rtype) {
+		return false
+	}
+
+	switch rtype.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
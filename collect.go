@@ -0,0 +1,80 @@
+package gos
+
+/*
+Decodes every row of the scanner into a new slice of `T`, then closes the
+scanner. `T` may be any type supported by `Scanner.Scan`, such as a struct or
+a scalar. Example:
+
+	scan, err := gos.QueryScanner(ctx, conn, `select * from persons`, nil)
+	if err != nil {
+		return err
+	}
+	persons, err := gos.CollectSlice[Person](scan)
+
+Unlike `Query`, this doesn't require a pointer to a destination, and the result
+is nil when there are no rows.
+*/
+func CollectSlice[T any](scan Scanner) ([]T, error) {
+	var out []T
+	err := collect(scan, func(val T) {
+		out = append(out, val)
+	})
+	return out, err
+}
+
+/*
+Decodes every row of the scanner into a map, keyed by the result of the given
+function, then closes the scanner. When several rows have the same key, the
+last one wins. Example:
+
+	personsById, err := gos.CollectMap(scan, func(val Person) string { return val.Id })
+*/
+func CollectMap[K comparable, V any](scan Scanner, key func(V) K) (map[K]V, error) {
+	out := map[K]V{}
+	err := collect(scan, func(val V) {
+		out[key(val)] = val
+	})
+	return out, err
+}
+
+/*
+Decodes every row of the scanner into a map of slices, grouped by the result of
+the given function, then closes the scanner. Within each group, rows retain
+their original order. Example:
+
+	postsByAuthor, err := gos.CollectGrouped(scan, func(val Post) string { return val.AuthorId })
+*/
+func CollectGrouped[K comparable, V any](scan Scanner, key func(V) K) (map[K][]V, error) {
+	out := map[K][]V{}
+	err := collect(scan, func(val V) {
+		k := key(val)
+		out[k] = append(out[k], val)
+	})
+	return out, err
+}
+
+/* Internal */
+
+func collect[T any](scan Scanner, fun func(T)) (err error) {
+	defer func() {
+		closeErr := scan.Close()
+		if err == nil && closeErr != nil {
+			err = Err{While: `closing scanner`, Cause: closeErr}
+		}
+	}()
+
+	for scan.Next() {
+		var val T
+		err = scan.Scan(&val)
+		if err != nil {
+			return err
+		}
+		fun(val)
+	}
+
+	err = scan.Err()
+	if err != nil {
+		return Err{While: `iterating rows`, Cause: err}
+	}
+	return nil
+}
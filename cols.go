@@ -0,0 +1,697 @@
+package gos
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Takes a struct and generates a string of column names suitable for inclusion
+into `select`. Columns are matched to struct fields by `db` tags, following the
+rules outlined in the package overview, which guarantees that the resulting
+columns are decoded by `Query` without errors. Nested structs are selected as
+fields of composite values, aliased in accordance with the convention for
+nested columns. Example:
+
+	type Inner struct {
+		InnerVal string `db:"inner_val"`
+	}
+	type Outer struct {
+		OuterVal string `db:"outer_val"`
+		Inner    Inner  `db:"inner"`
+	}
+
+	Cols(Outer{})
+
+	// Output:
+	"outer_val", ("inner")."inner_val" as "inner.inner_val"
+
+Also accepts a struct pointer, struct slice, or struct slice pointer. Nil slices
+and pointers are fine, as long as they carry a struct type. Any other input
+causes a panic.
+
+The output is deterministic: columns always follow the order of struct fields,
+depth-first. It's generated once per combination of type and arguments, and
+cached, which makes repeated calls cheap. See `ClearCaches`.
+
+The optional mask restricts the output to a subset of fields, which allows to
+reuse one canonical struct for narrow projections. Each mask entry is a path to
+a field, where each path segment is either a Go field name or a column name,
+and nested fields are separated with dots. A path to a nested struct selects
+all of its fields. A path that doesn't match any field causes a panic. Example:
+
+	Cols(Outer{}, `outer_val`, `Inner.inner_val`)
+*/
+func Cols(dest interface{}, mask ...string) string {
+	return ColsPrefixed(dest, "", mask...)
+}
+
+/*
+Variant of `Cols` that qualifies every column with the given table name or
+alias, which is included verbatim, without quoting. This allows to include the
+column list into queries with joins, where unqualified names would be
+ambiguous. An empty prefix is equivalent to `Cols`. Example:
+
+	ColsPrefixed(Outer{}, `t`)
+
+	// Output:
+	t."outer_val", (t."inner")."inner_val" as "inner.inner_val"
+*/
+func ColsPrefixed(dest interface{}, prefix string, mask ...string) string {
+	rtype := colsRtype(dest, `generating struct columns for select clause`)
+	key := tColsKey{kind: colsKindSelect, rtype: rtype, prefix: prefix, mask: joinMask(mask)}
+
+	return cachedCols(key, func() string {
+		specs, err := maskColSpecs(structRtypeColSpecs(rtype), mask)
+		if err != nil {
+			panic(err)
+		}
+		return string(appendCols(nil, specs, prefix, nil))
+	})
+}
+
+/*
+Variant of `Cols` that omits nilable nested structs (pointers to structs),
+which are typically used for outer joins, unless explicitly included. This
+allows list queries to avoid selecting, and computing, joined records they
+never use. Paths in `include` follow the same format as the mask in `Cols`,
+and select the entire nested struct. Example:
+
+	type Outer struct {
+		Id    string `db:"id"`
+		Inner *Inner `db:"inner"`
+	}
+
+	ColsShallow(Outer{})
+
+	// Output:
+	"id"
+
+	ColsShallow(Outer{}, `inner`)
+
+	// Output:
+	"id", ("inner")."inner_val" as "inner.inner_val"
+*/
+func ColsShallow(dest interface{}, include ...string) string {
+	rtype := colsRtype(dest, `generating struct columns for select clause`)
+	key := tColsKey{kind: colsKindShallow, rtype: rtype, mask: joinMask(include)}
+
+	return cachedCols(key, func() string {
+		specs := structRtypeColSpecs(rtype)
+		colMask, err := newColMask(specs, include)
+		if err != nil {
+			panic(err)
+		}
+		specs = colMask.skipNilable(specs)
+		return string(appendCols(nil, specs, "", nil))
+	})
+}
+
+/*
+Variant of `Cols` that selects each nested struct as a single composite column,
+instead of one aliased column per nested field. For deeply nested structs, this
+keeps the select list short and avoids exceeding identifier length limits.
+`Query` decodes each composite column into the matching nested struct from
+the text format of the composite, assigning its attributes to the struct's
+fields positionally, in the order of `Cols`, which must match the order of the
+composite type. The columns also work with `QueryJson`, which converts them to
+nested JSON objects; note that JSON keys are named after the columns, which
+must match the `json` tags. Accepts the same inputs as `Cols`. Example:
+
+	ColsComposite(Outer{})
+
+	// Output:
+	"outer_val", "inner"
+
+	// Usage:
+	query := fmt.Sprintf(`select %v from outers`, ColsComposite(result))
+	err := Query(ctx, conn, &result, query, args)
+*/
+func ColsComposite(dest interface{}) string {
+	rtype := colsRtype(dest, `generating struct columns for select clause`)
+	key := tColsKey{kind: colsKindComposite, rtype: rtype}
+
+	return cachedCols(key, func() string {
+		return string(appendColsComposite(nil, structRtypeColSpecs(rtype)))
+	})
+}
+
+/*
+Takes a struct type and generates a list of columns suitable for `insert`
+statements, such as `insert into some_table (<cols>)`. Unlike `Cols`, doesn't
+expand nested structs, which are treated as single composite columns. Fields
+whose `db` tag includes the `readonly` option, such as generated or identity
+columns, are omitted. Accepts the same inputs as `Cols`. Example:
+
+	type Person struct {
+		Id   string `db:"id,readonly"`
+		Name string `db:"name"`
+		Addr Addr   `db:"addr"`
+	}
+
+	ColsInsert(Person{})
+
+	// Output:
+	"name", "addr"
+
+Unlike column lists generated from values, this is driven by the type alone,
+and is cached like `Cols`. The values for these columns, in the same order, can
+be obtained via `StructArgs`.
+*/
+func ColsInsert(dest interface{}) string {
+	rtype := colsRtype(dest, `generating struct columns for insert clause`)
+	key := tColsKey{kind: colsKindInsert, rtype: rtype}
+
+	return cachedCols(key, func() string {
+		return string(appendColsInsert(nil, structRtypeColSpecs(rtype)))
+	})
+}
+
+/*
+Takes a struct type and generates assignments suitable for `update` statements,
+such as `update some_table set <assignments>`, using ordinal parameters that
+start after the given offset, which should be the count of preceding arguments.
+Columns are the same as in `ColsInsert`, in the same order, and match the
+arguments returned by `StructArgs`. Accepts the same inputs as `Cols`. Example:
+
+	ColsAssign(Person{}, 1)
+
+	// Output:
+	"name" = $2, "addr" = $3
+
+	// Usage:
+	query := fmt.Sprintf(`update persons set %v where id = $1`, ColsAssign(person, 1))
+	args := append([]interface{}{person.Id}, StructArgs(person)...)
+*/
+func ColsAssign(dest interface{}, offset int) string {
+	rtype := colsRtype(dest, `generating struct columns for set clause`)
+	key := tColsKey{kind: colsKindAssign, rtype: rtype, offset: offset}
+
+	return cachedCols(key, func() string {
+		return string(appendColsAssign(nil, structRtypeColSpecs(rtype), offset))
+	})
+}
+
+/*
+Takes a struct and generates an expression that builds the entire row as one
+JSON object, suitable for inclusion into `select`. Nested structs become nested
+JSON objects. Accepts the same inputs and mask as `Cols`.
+
+Columns are matched to struct fields by `db` tags, following the rules outlined
+in the package overview. JSON keys are named after `json` tags, falling back on
+Go field names, which allows to decode the resulting object via `QueryJsonCol`.
+Fields tagged with `json:"-"` are omitted. Example:
+
+	type Inner struct {
+		InnerVal string `db:"inner_val" json:"innerVal"`
+	}
+	type Outer struct {
+		OuterVal string `db:"outer_val" json:"outerVal"`
+		Inner    *Inner `db:"inner"     json:"inner"`
+	}
+
+	ColsJson(Outer{})
+
+	// Output (formatted for readability):
+	jsonb_build_object(
+		'outerVal', "outer_val",
+		'inner', case when ("inner") is null then null else jsonb_build_object(
+			'innerVal', ("inner")."inner_val"
+		) end
+	)
+
+Nilable nested structs (pointers) whose columns are all null become JSON null,
+mirroring the null-record convention of `Query`.
+
+Requires Postgres or another database that supports `jsonb_build_object`.
+*/
+func ColsJson(dest interface{}, mask ...string) string {
+	rtype := colsRtype(dest, `generating JSON object for select clause`)
+	key := tColsKey{kind: colsKindJson, rtype: rtype, mask: joinMask(mask)}
+
+	return cachedCols(key, func() string {
+		specs, err := maskColSpecs(structRtypeColSpecs(rtype), mask)
+		if err != nil {
+			panic(err)
+		}
+		return string(appendColsJson(nil, specs, nil))
+	})
+}
+
+/* Internal */
+
+// Describes a column or a group of nested columns, derived from a struct field.
+type tColSpec struct {
+	sfield    reflect.StructField
+	fieldPath []int // Relative to the enclosing non-embedded struct.
+	colName   string
+	cols      []tColSpec // Non-nil for nested non-scannable structs and one-to-many fields.
+}
+
+func (self tColSpec) isNested() bool { return self.cols != nil }
+
+type tColsKind byte
+
+const (
+	colsKindSelect tColsKind = iota
+	colsKindShallow
+	colsKindJson
+	colsKindInsert
+	colsKindAssign
+	colsKindComposite
+)
+
+type tColsKey struct {
+	kind   tColsKind
+	rtype  reflect.Type
+	prefix string
+	mask   string
+	offset int
+}
+
+// Cache key for `[]tColSpec`.
+type tColSpecsKey struct{}
+
+func cachedCols(key tColsKey, fun func() string) string {
+	val, ok := cache.get(key.rtype, key)
+	if ok {
+		return val.(string)
+	}
+
+	out := fun()
+	cache.set(key.rtype, key, out)
+	return out
+}
+
+// Assumes that mask paths don't contain newlines.
+func joinMask(mask []string) string {
+	return strings.Join(mask, "\n")
+}
+
+/*
+Dereferences the input to a struct type, as documented in `Cols`. Panics if
+the input is not a struct type.
+*/
+func colsRtype(dest interface{}, while string) reflect.Type {
+	rtype := refut.RtypeDeref(reflect.TypeOf(dest))
+	if rtype != nil && rtype.Kind() == reflect.Slice {
+		rtype = refut.RtypeDeref(rtype.Elem())
+	}
+
+	if rtype == nil || rtype.Kind() != reflect.Struct {
+		panic(ErrInvalidInput.while(while).because(
+			fmt.Errorf(`expected struct, got %q`, rtype),
+		))
+	}
+	return rtype
+}
+
+func structRtypeColSpecs(rtype reflect.Type) []tColSpec {
+	val, ok := cache.get(rtype, tColSpecsKey{})
+	if ok {
+		return val.([]tColSpec)
+	}
+
+	out := makeColSpecs(rtype)
+	cache.set(rtype, tColSpecsKey{}, out)
+	return out
+}
+
+/*
+Flattens embedded structs and ignores fields without `db` tags, following the
+same rules as decoding.
+*/
+func makeColSpecs(rtype reflect.Type) []tColSpec {
+	specs := []tColSpec{}
+
+	err := traverseStructRtype(rtype, func(sfield reflect.StructField, fieldPath []int) error {
+		colName := sfieldColumnName(sfield)
+		if colName == "" {
+			return nil
+		}
+
+		spec := tColSpec{sfield: sfield, fieldPath: copyIntSlice(fieldPath), colName: colName}
+		if isRtypeStructNonScannable(sfield.Type) && !isSfieldSingleCol(sfield) {
+			spec.cols = makeColSpecs(refut.RtypeDeref(sfield.Type))
+		} else if isRtypeManyStruct(sfield.Type) && !isSfieldSingleCol(sfield) {
+			spec.cols = makeColSpecs(refut.RtypeDeref(sfield.Type.Elem()))
+		}
+		specs = append(specs, spec)
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return specs
+}
+
+/*
+True for fields decoded from a single column regardless of their type, such as
+XML fields and fields of types with registered decoders.
+*/
+func isSfieldSingleCol(sfield reflect.StructField) bool {
+	return isSfieldXml(sfield) || findTypeDecoder(sfield.Type) != nil
+}
+
+/*
+Describes which fields are selected by a mask. Fields are keyed by their index
+in the corresponding `[]tColSpec`.
+*/
+type tColMask struct {
+	whole  bool
+	fields map[int]*tColMask
+}
+
+/*
+Same as `Cols`, but reports an invalid mask as an error rather than a panic,
+and doesn't cache the output. Used for masks derived from request input, where
+caching every distinct mask would grow memory without bound.
+*/
+func colsMasked(rtype reflect.Type, mask []string) (string, error) {
+	specs, err := maskColSpecs(structRtypeColSpecs(rtype), mask)
+	if err != nil {
+		return "", err
+	}
+	return string(appendCols(nil, specs, "", nil)), nil
+}
+
+// Returns the input as-is if the mask is empty.
+func maskColSpecs(specs []tColSpec, mask []string) ([]tColSpec, error) {
+	if len(mask) == 0 {
+		return specs, nil
+	}
+	colMask, err := newColMask(specs, mask)
+	if err != nil {
+		return nil, err
+	}
+	return colMask.apply(specs), nil
+}
+
+func newColMask(specs []tColSpec, paths []string) (*tColMask, error) {
+	out := &tColMask{}
+	for _, path := range paths {
+		err := out.add(specs, strings.Split(path, `.`), path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (self *tColMask) add(specs []tColSpec, path []string, fullPath string) error {
+	index := colSpecIndex(specs, path[0])
+	if index < 0 {
+		return ErrInvalidInput.while(`masking struct columns`).because(
+			fmt.Errorf(`mask path %q doesn't match any field`, fullPath),
+		)
+	}
+
+	if self.fields == nil {
+		self.fields = map[int]*tColMask{}
+	}
+	sub := self.fields[index]
+	if sub == nil {
+		sub = &tColMask{}
+		self.fields[index] = sub
+	}
+
+	if len(path) == 1 {
+		sub.whole = true
+		return nil
+	}
+
+	if !specs[index].isNested() {
+		return ErrInvalidInput.while(`masking struct columns`).because(
+			fmt.Errorf(`mask path %q traverses non-nested field %q`, fullPath, path[0]),
+		)
+	}
+	return sub.add(specs[index].cols, path[1:], fullPath)
+}
+
+func (self *tColMask) apply(specs []tColSpec) []tColSpec {
+	if self.whole {
+		return specs
+	}
+
+	out := make([]tColSpec, 0, len(self.fields))
+	for i, spec := range specs {
+		sub := self.fields[i]
+		if sub == nil {
+			continue
+		}
+		if spec.isNested() {
+			spec.cols = sub.apply(spec.cols)
+		}
+		out = append(out, spec)
+	}
+	return out
+}
+
+/*
+Omits nilable nested structs not mentioned in the mask. Unlike `.apply`, keeps
+fields not mentioned in the mask. Safe to call on a nil mask.
+*/
+func (self *tColMask) skipNilable(specs []tColSpec) []tColSpec {
+	if self != nil && self.whole {
+		return specs
+	}
+
+	out := make([]tColSpec, 0, len(specs))
+	for i, spec := range specs {
+		var sub *tColMask
+		if self != nil {
+			sub = self.fields[i]
+		}
+
+		if spec.isNested() {
+			if sub == nil && isRtypeNilable(spec.sfield.Type) {
+				continue
+			}
+			spec.cols = sub.skipNilable(spec.cols)
+		}
+		out = append(out, spec)
+	}
+	return out
+}
+
+// Matches either the column name or the Go field name.
+func colSpecIndex(specs []tColSpec, name string) int {
+	for i, spec := range specs {
+		if spec.colName == name || spec.sfield.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func appendCols(buf []byte, specs []tColSpec, prefix string, path []string) []byte {
+	for _, spec := range specs {
+		path := append(path, spec.colName)
+
+		if spec.isNested() {
+			buf = appendCols(buf, spec.cols, prefix, path)
+			continue
+		}
+
+		if len(buf) > 0 {
+			buf = append(buf, `, `...)
+		}
+
+		buf = appendColPath(buf, prefix, path)
+		if len(path) > 1 {
+			buf = append(buf, ` as `...)
+			buf = appendColAlias(buf, path)
+		}
+	}
+	return buf
+}
+
+/*
+Returns the column aliases that would be generated by `appendCols`, in the same
+order, such as "outer_field.inner_field". Used for positional mapping.
+*/
+func appendColAliases(out []string, specs []tColSpec, path []string) []string {
+	for _, spec := range specs {
+		path := append(path, spec.colName)
+
+		if spec.isNested() {
+			out = appendColAliases(out, spec.cols, path)
+			continue
+		}
+
+		out = append(out, strings.Join(path, aliasSeparator()))
+	}
+	return out
+}
+
+func appendColsInsert(buf []byte, specs []tColSpec) []byte {
+	return appendColsComposite(buf, writableColSpecs(specs))
+}
+
+func appendColsComposite(buf []byte, specs []tColSpec) []byte {
+	for _, spec := range specs {
+		if len(buf) > 0 {
+			buf = append(buf, `, `...)
+		}
+		buf = appendIdent(buf, spec.colName)
+	}
+	return buf
+}
+
+func appendColsAssign(buf []byte, specs []tColSpec, offset int) []byte {
+	for i, spec := range writableColSpecs(specs) {
+		if i > 0 {
+			buf = append(buf, `, `...)
+		}
+		buf = appendIdent(buf, spec.colName)
+		buf = append(buf, ` = $`...)
+		buf = strconv.AppendInt(buf, int64(offset+i+1), 10)
+	}
+	return buf
+}
+
+/*
+Columns used by `ColsInsert`, `ColsAssign` and `StructArgs`: top-level only,
+excluding those marked as `readonly`.
+*/
+func writableColSpecs(specs []tColSpec) []tColSpec {
+	out := make([]tColSpec, 0, len(specs))
+	for _, spec := range specs {
+		if !sfieldHasColumnOpt(spec.sfield, `readonly`) {
+			out = append(out, spec)
+		}
+	}
+	return out
+}
+
+func appendColsJson(buf []byte, specs []tColSpec, path []string) []byte {
+	buf = append(buf, `jsonb_build_object(`...)
+
+	var count int
+	for _, spec := range specs {
+		key := sfieldJsonName(spec.sfield)
+		if key == "" {
+			continue
+		}
+
+		if count > 0 {
+			buf = append(buf, `, `...)
+		}
+		count++
+
+		buf = appendSqlString(buf, key)
+		buf = append(buf, `, `...)
+
+		path := append(path, spec.colName)
+
+		// One-to-many fields can't be aggregated per row.
+		if !spec.isNested() || isRtypeManyStruct(spec.sfield.Type) {
+			buf = appendColPath(buf, "", path)
+			continue
+		}
+
+		if !isRtypeNilable(spec.sfield.Type) {
+			buf = appendColsJson(buf, spec.cols, path)
+			continue
+		}
+
+		buf = append(buf, `case when `...)
+		buf = appendColPathGroup(buf, "", path)
+		buf = append(buf, ` is null then null else `...)
+		buf = appendColsJson(buf, spec.cols, path)
+		buf = append(buf, ` end`...)
+	}
+
+	buf = append(buf, `)`...)
+	return buf
+}
+
+/*
+Appends a reference to a possibly-nested column, such as `"one"` or
+`("one")."two"."three"`, optionally qualified with a prefix such as `t."one"`.
+*/
+func appendColPath(buf []byte, prefix string, path []string) []byte {
+	for i, name := range path {
+		if i == 0 && len(path) > 1 {
+			buf = append(buf, `(`...)
+			buf = appendPrefixedIdent(buf, prefix, name)
+			buf = append(buf, `)`...)
+		} else if i == 0 {
+			buf = appendPrefixedIdent(buf, prefix, name)
+		} else {
+			buf = appendIdent(buf, name)
+		}
+		if i < len(path)-1 {
+			buf = append(buf, `.`...)
+		}
+	}
+	return buf
+}
+
+// Same as `appendColPath`, but always parenthesized.
+func appendColPathGroup(buf []byte, prefix string, path []string) []byte {
+	buf = append(buf, `(`...)
+	buf = appendColPath(buf, prefix, path)
+	buf = append(buf, `)`...)
+	return buf
+}
+
+/*
+Appends an alias for a nested column, such as `"one.two.three"`, using the
+separator from `SetAliasSeparator`.
+*/
+func appendColAlias(buf []byte, path []string) []byte {
+	sep := aliasSeparator()
+	buf = append(buf, `"`...)
+	for i, name := range path {
+		if i > 0 {
+			buf = append(buf, sep...)
+		}
+		buf = append(buf, name...)
+	}
+	buf = append(buf, `"`...)
+	return buf
+}
+
+func appendPrefixedIdent(buf []byte, prefix string, name string) []byte {
+	if prefix != "" {
+		buf = append(buf, prefix...)
+		buf = append(buf, `.`...)
+	}
+	return appendIdent(buf, name)
+}
+
+func appendIdent(buf []byte, name string) []byte {
+	buf = append(buf, `"`...)
+	buf = append(buf, name...)
+	buf = append(buf, `"`...)
+	return buf
+}
+
+func appendSqlString(buf []byte, str string) []byte {
+	buf = append(buf, `'`...)
+	buf = append(buf, strings.ReplaceAll(str, `'`, `''`)...)
+	buf = append(buf, `'`...)
+	return buf
+}
+
+/*
+Returns the key used by `encoding/json` for this field, or "" if the field is
+excluded from JSON.
+*/
+func sfieldJsonName(sfield reflect.StructField) string {
+	tag := sfield.Tag.Get(`json`)
+	if tag == `-` {
+		return ""
+	}
+	name := refut.TagIdent(tag)
+	if name == "" {
+		return sfield.Name
+	}
+	return name
+}
@@ -0,0 +1,210 @@
+package gos
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Decodes the result column-wise into a struct whose fields are slices, one
+element per row. For analytics-style processing, this representation is much
+more cache- and memory-friendly than a slice of wide structs. Example:
+
+	var dest struct {
+		Ids   []int64  `db:"id"`
+		Names []string `db:"name"`
+	}
+	err := gos.QueryColumnar(ctx, conn, &dest, `select id, name from persons`, nil)
+
+Columns are matched to fields by the same rules as for regular structs, but
+only top-level fields are considered, and every field with a column name must
+be a slice. Elements are decoded like scalars: they must be supported by the
+driver or implement `sql.Scanner`, and must be nilable to accept nulls. Note
+that a `[]byte` field is a column of bytes; for a column of byte strings, use
+`[][]byte`. Fields are truncated before decoding. Fields without matching
+columns are left empty. Columns without matching fields cause `ErrNoColDest`,
+and several columns with the same name cause `ErrRedundantCol`.
+*/
+func QueryColumnar(ctx context.Context, conn Queryer, dest interface{}, query string, args []interface{}) error {
+	return Conf{}.QueryColumnar(ctx, conn, dest, query, args)
+}
+
+/*
+Variant of `QueryColumnar` that uses the given configuration. Supports
+`Conf.MaxRows` and `Conf.Coerce`. Elements are decoded via decoders registered
+for their type, see `RegisterDecoder` and `RegisterColumnDecoder`, if any.
+*/
+func (self Conf) QueryColumnar(ctx context.Context, conn Queryer, dest interface{}, query string, args []interface{}) error {
+	err := validateDestPtr(dest)
+	if err != nil {
+		return err
+	}
+
+	rval := reflect.ValueOf(dest).Elem()
+	if rval.Kind() != reflect.Struct {
+		return ErrInvalidDest.while(`decoding columns`).because(fmt.Errorf(
+			`destination must be a pointer to a struct, received %#v`, dest,
+		))
+	}
+
+	fields, err := columnarFields(rval.Type())
+	if err != nil {
+		return err
+	}
+
+	rows, err := queryRows(ctx, conn, query, args)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cols, err := columnarCols(rows, rval.Type(), fields, self)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range fields {
+		truncateSliceRval(rval.Field(index))
+	}
+
+	ptrs := make([]reflect.Value, len(cols))
+	ptrInterfaces := make([]interface{}, len(cols))
+	srcs := make([]interface{}, len(cols))
+	var count int
+
+	for rows.Next() {
+		err := self.checkMaxRows(count)
+		if err != nil {
+			return err
+		}
+
+		for i, col := range cols {
+			if col.decoder != nil {
+				ptrInterfaces[i] = &srcs[i]
+				continue
+			}
+			ptrs[i] = reflect.New(rval.Field(col.index).Type().Elem())
+			ptrInterfaces[i] = ptrs[i].Interface()
+		}
+
+		err = rows.Scan(ptrInterfaces...)
+		if err != nil {
+			return ErrScan.because(err)
+		}
+
+		for i, col := range cols {
+			field := rval.Field(col.index)
+			if col.decoder == nil {
+				field.Set(reflect.Append(field, ptrs[i].Elem()))
+				continue
+			}
+
+			field.Set(reflect.Append(field, reflect.Zero(field.Type().Elem())))
+			err := col.decoder(srcs[i], field.Index(field.Len()-1))
+			if err != nil {
+				return Err{Code: ErrCodeScan, While: fmt.Sprintf(`decoding column %q`, col.name), Cause: err}
+			}
+		}
+		count++
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return Err{While: `iterating rows`, Cause: err}
+	}
+	return nil
+}
+
+/* Internal */
+
+// Maps column names to indexes of top-level slice fields.
+func columnarFields(rtype reflect.Type) (map[string]int, error) {
+	out := map[string]int{}
+
+	for i := 0; i < rtype.NumField(); i++ {
+		sfield := rtype.Field(i)
+		if !refut.IsSfieldExported(sfield) {
+			continue
+		}
+
+		colName := sfieldColumnName(sfield)
+		if colName == "" {
+			continue
+		}
+
+		if sfield.Type.Kind() != reflect.Slice {
+			return nil, ErrInvalidDest.while(`decoding columns`).because(fmt.Errorf(
+				`field %q of type %q must be a slice, found %q`, sfield.Name, rtype, sfield.Type,
+			))
+		}
+
+		_, ok := out[colName]
+		if ok {
+			return nil, ErrRedundantCol.while(`decoding columns`).because(fmt.Errorf(
+				`column %q is matched by multiple fields of type %q`, colName, rtype,
+			))
+		}
+		out[colName] = i
+	}
+
+	return out, nil
+}
+
+// Column of `QueryColumnar`, decoded into the top-level field with the given
+// index.
+type tColumnarCol struct {
+	name    string
+	index   int
+	decoder DecodeFunc
+}
+
+// Matches columns to fields found by `columnarFields`, each at most once.
+func columnarCols(rows *sql.Rows, rtype reflect.Type, fields map[string]int, conf Conf) ([]tColumnarCol, error) {
+	colNames, err := rows.Columns()
+	if err != nil {
+		return nil, Err{While: `getting columns`, Cause: err}
+	}
+
+	dbTypes, err := rowsColDbTypes(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]tColumnarCol, len(colNames))
+	seen := make(map[int]struct{}, len(colNames))
+
+	for i, colName := range colNames {
+		index, ok := fields[colName]
+		if !ok {
+			return nil, ErrNoColDest.while(`decoding columns`).because(fmt.Errorf(
+				`column %q doesn't have a matching field in type %q`, colName, rtype,
+			))
+		}
+
+		_, ok = seen[index]
+		if ok {
+			return nil, ErrRedundantCol.while(`decoding columns`).because(fmt.Errorf(
+				`redundant occurrence of column %q`, colName,
+			))
+		}
+		seen[index] = struct{}{}
+
+		var dbType string
+		if dbTypes != nil {
+			dbType = dbTypes[i]
+		}
+
+		elemRtype := rtype.Field(index).Type.Elem()
+		decoder := findScalarDecoder(elemRtype, dbType)
+		if decoder == nil {
+			decoder = builtinScalarDecoder(elemRtype, conf)
+		}
+		out[i] = tColumnarCol{name: colName, index: index, decoder: decoder}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,232 @@
+package gos
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Decodes a Postgres composite value, such as the result of `select tbl from tbl`,
+into a nested struct. Used as a `DecodeFunc` for non-scannable struct fields
+whose column alias matches a column, rather than a group of nested columns.
+The composite is decoded from its text format, such as `(10,"some text",)`,
+and its attributes are assigned to the struct's fields positionally, in the
+order of `Cols`, which must match the order of the composite type. Nilable
+fields accept nulls.
+*/
+func decodeComposite(src interface{}, dest reflect.Value) error {
+	if src == nil {
+		if isRtypeNilable(dest.Type()) {
+			rvalZero(dest)
+			return nil
+		}
+		return ErrNull.because(fmt.Errorf(`can't decode null into non-nilable %q`, dest.Type()))
+	}
+
+	var str string
+	switch src := src.(type) {
+	case []byte:
+		str = string(src)
+	case string:
+		str = src
+	default:
+		return fmt.Errorf(`can't decode %T into %q as composite`, src, dest.Type())
+	}
+
+	vals, err := parseComposite(str)
+	if err != nil {
+		return err
+	}
+
+	dest = refut.RvalDerefAlloc(dest)
+	rvalZero(dest)
+	fieldPaths := compositeFieldPaths(dest.Type())
+
+	if len(vals) != len(fieldPaths) {
+		return fmt.Errorf(
+			`can't decode composite with %d attributes into %q with %d columns`,
+			len(vals), dest.Type(), len(fieldPaths),
+		)
+	}
+
+	for i, val := range vals {
+		err := decodeCompositeAttr(val, refut.RvalFieldByPathAlloc(dest, fieldPaths[i]))
+		if err != nil {
+			return fmt.Errorf(`failed to decode composite attribute %d into %q: %w`, i, dest.Type(), err)
+		}
+	}
+	return nil
+}
+
+/* Internal */
+
+/*
+Decodes a single attribute of a composite value, given in the text format.
+Nulls are represented as nil pointers.
+*/
+func decodeCompositeAttr(src *string, dest reflect.Value) error {
+	if reflect.PtrTo(dest.Type()).Implements(sqlScannerRtype) {
+		var val interface{}
+		if src != nil {
+			val = *src
+		}
+		return dest.Addr().Interface().(sql.Scanner).Scan(val)
+	}
+
+	if dest.Kind() == reflect.Ptr {
+		if src == nil {
+			rvalZero(dest)
+			return nil
+		}
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		return decodeCompositeAttr(src, dest.Elem())
+	}
+
+	if src == nil {
+		if isRtypeNilable(dest.Type()) {
+			rvalZero(dest)
+			return nil
+		}
+		return ErrNull.because(fmt.Errorf(`can't decode null into non-nilable %q`, dest.Type()))
+	}
+
+	switch {
+	case dest.Type() == timeRtype:
+		val, err := parseCompositeTime(*src)
+		if err != nil {
+			return err
+		}
+		dest.Set(reflect.ValueOf(val))
+		return nil
+
+	case dest.Type() == bytesRtype:
+		val, err := parseCompositeBytes(*src)
+		if err != nil {
+			return err
+		}
+		dest.SetBytes(val)
+		return nil
+
+	case isRtypeStructNonScannable(dest.Type()):
+		return decodeComposite(*src, dest)
+
+	case isRtypeCoercible(dest.Type()):
+		return coerce(*src, dest)
+	}
+
+	return fmt.Errorf(`unsupported composite attribute type %q`, dest.Type())
+}
+
+// Paths of the fields which have column names, in the order of `Cols`.
+func compositeFieldPaths(rtype reflect.Type) [][]int {
+	var out [][]int
+	err := traverseStructRtype(rtype, func(sfield reflect.StructField, fieldPath []int) error {
+		if sfieldColumnName(sfield) != `` {
+			out = append(out, copyIntSlice(fieldPath))
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+/*
+Parses the text format of a Postgres composite value into its attributes,
+where nil represents null. Unquoted empty attributes are nulls, while quoted
+ones are empty strings. Inside quotes, `""` and `\"` represent a quote, and a
+backslash escapes the next character.
+*/
+func parseComposite(src string) ([]*string, error) {
+	if len(src) < 2 || src[0] != '(' || src[len(src)-1] != ')' {
+		return nil, fmt.Errorf(`malformed composite %q: expected parentheses`, src)
+	}
+
+	var out []*string
+	var buf strings.Builder
+	body := src[1 : len(src)-1]
+	quoted := false
+	inQuotes := false
+
+	for i := 0; i < len(body); i++ {
+		char := body[i]
+
+		switch {
+		case inQuotes && char == '"' && i+1 < len(body) && body[i+1] == '"':
+			buf.WriteByte('"')
+			i++
+
+		case char == '"':
+			inQuotes = !inQuotes
+			quoted = true
+
+		case char == '\\':
+			if i+1 >= len(body) {
+				return nil, fmt.Errorf(`malformed composite %q: trailing backslash`, src)
+			}
+			buf.WriteByte(body[i+1])
+			i++
+
+		case char == ',' && !inQuotes:
+			out = appendCompositeAttr(out, &buf, quoted)
+			quoted = false
+
+		default:
+			buf.WriteByte(char)
+		}
+	}
+
+	if inQuotes {
+		return nil, fmt.Errorf(`malformed composite %q: unterminated quote`, src)
+	}
+	return appendCompositeAttr(out, &buf, quoted), nil
+}
+
+func appendCompositeAttr(out []*string, buf *strings.Builder, quoted bool) []*string {
+	if buf.Len() == 0 && !quoted {
+		out = append(out, nil)
+	} else {
+		val := buf.String()
+		out = append(out, &val)
+	}
+	buf.Reset()
+	return out
+}
+
+// Layouts of Postgres timestamps, timestamps with time zones, and dates.
+var compositeTimeLayouts = []string{
+	`2006-01-02 15:04:05.999999999Z07:00:00`,
+	`2006-01-02 15:04:05.999999999Z07:00`,
+	`2006-01-02 15:04:05.999999999Z07`,
+	`2006-01-02 15:04:05.999999999`,
+	`2006-01-02`,
+}
+
+func parseCompositeTime(src string) (time.Time, error) {
+	for _, layout := range compositeTimeLayouts {
+		val, err := time.Parse(layout, src)
+		if err == nil {
+			return val, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf(`can't parse %q as time`, src)
+}
+
+// Parses the hex format of `bytea`, such as `\x0102`.
+func parseCompositeBytes(src string) ([]byte, error) {
+	if !strings.HasPrefix(src, `\x`) {
+		return []byte(src), nil
+	}
+	return hex.DecodeString(src[2:])
+}
+
+var bytesRtype = reflect.TypeOf([]byte(nil))
@@ -0,0 +1,160 @@
+package gos
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+Optional configuration for querying and decoding. The zero value is the
+default, used by package-level functions such as `Query`. A `Conf` may be
+created once and reused, or created on the fly for a specific query:
+
+	err := gos.Conf{NoCache: true}.Query(ctx, conn, &dest, query, args)
+*/
+type Conf struct {
+	// Bypasses the cache of decoding specs: the spec is built from scratch and
+	// not stored. Useful for queries whose column sets are dynamic, such as
+	// pivot queries or queries with optional joins, which would otherwise
+	// pollute the cache with rarely reused entries. See `ClearCaches`.
+	NoCache bool
+
+	// For `QueryMap` and map destinations in `Query`: when several rows have the
+	// same key, keep the last value instead of failing with `ErrDuplicateKey`.
+	AllowDuplicateKeys bool
+
+	// For map destinations in `Query`: column name of the struct field that
+	// provides map keys, instead of the field tagged with the `key` option,
+	// such as `db:"id,key"`. Must refer to a top-level or embedded field.
+	MapKey string
+
+	// Enables lenient decoding of primitive types: integers of different widths,
+	// numeric strings into numbers, 0/1 and "t"/"f" into bools, and so on,
+	// instead of failing with driver conversion errors. Useful with legacy
+	// schemas whose column types don't match the Go types. Applies to fields
+	// and scalar destinations of primitive types, excluding `sql.Scanner`
+	// implementations and fields with custom decoders.
+	Coerce bool
+
+	// When every column of a nested non-nilable struct is null or missing,
+	// leaves the struct zero-valued, treating it as "present but empty",
+	// instead of failing with `ErrNull`. Nilable nested structs are still left
+	// nil. Useful for models that avoid pointer fields.
+	ZeroNullStructs bool
+
+	// Skips result columns that have no matching struct field, or no matching
+	// input of a registered mapper, instead of failing with `ErrNoColDest`.
+	// Useful for sharing one query between several destination types, or for
+	// `select *` against wide tables. Skipped columns are still fetched, so
+	// selecting only the needed columns, such as via `Cols`, remains cheaper.
+	// Structs with a field tagged `db:",rest"` collect such columns instead.
+	IgnoreUnknownCols bool
+
+	// Fails with `ErrMissingCol` when the result set lacks the columns of some
+	// struct fields, listing their aliases, instead of leaving those fields
+	// untouched. Meant for development and tests, where it catches typos in
+	// column aliases. Doesn't apply to mappers, see `RegisterMapper`.
+	StrictFields bool
+
+	// Matches columns to struct fields by position rather than by name, in the
+	// same order as the columns generated by `Cols`. The result may have fewer
+	// columns than the struct, but not more. Useful when column names are
+	// unavailable or meaningless, such as "?column?" for anonymous records from
+	// `select (expr).*` or set-returning functions. Structs without any column
+	// names, including nested ones, use every exported field in declaration
+	// order, except those tagged `db:"-"`, which allows ad-hoc structs without
+	// tags, mirroring the select list.
+	Positional bool
+
+	// Limits the time spent fetching each row via `Scanner.Next`, including the
+	// first one, so that a stalled connection surfaces promptly instead of
+	// hanging indefinitely. When exceeded, the query is canceled via its
+	// context, and the scanner reports `ErrTimeout`. Interrupting a stalled
+	// fetch requires the driver to support context cancellation, which is the
+	// case for common Postgres drivers. Zero means no limit.
+	RowTimeout time.Duration
+
+	// For slice and map destinations in `Query`: fails with `ErrTooManyRows`
+	// when the result has more rows than this, instead of buffering all of
+	// them. Protects services from accidentally loading huge tables into
+	// memory, for example when a query is missing a `limit`. Rows merged into
+	// one-to-many fields count individually. Zero means no limit.
+	MaxRows int
+
+	// For `QueryCursor`: the amount of rows fetched from the cursor per round
+	// trip. Larger sizes need fewer round trips but more memory. Defaults to
+	// 1024.
+	FetchSize int
+
+	// For `Retry` and `RetryTx`: the maximum amount of attempts, including the
+	// first one. Defaults to 5.
+	RetryAttempts int
+
+	// For `Retry` and `RetryTx`: the delay before the first retry, doubled for
+	// every next retry, with random jitter to avoid repeating the same conflict.
+	// Defaults to 10ms.
+	RetryDelay time.Duration
+
+	// For `Retry` and `RetryTx`: the upper limit of the delay between retries,
+	// which stops the doubling of `RetryDelay`. Defaults to 1s.
+	RetryMaxDelay time.Duration
+}
+
+const (
+	defaultFetchSize     = 1024
+	defaultRetryAttempts = 5
+	defaultRetryDelay    = 10 * time.Millisecond
+	defaultRetryMaxDelay = time.Second
+)
+
+// Implements `Conf.MaxRows`, given the amount of rows decoded so far.
+func (self Conf) checkMaxRows(count int) error {
+	if self.MaxRows > 0 && count >= self.MaxRows {
+		return ErrTooManyRows.while(`decoding rows`).because(fmt.Errorf(
+			`result exceeds the limit of %v rows, see Conf.MaxRows`, self.MaxRows,
+		))
+	}
+	return nil
+}
+
+// Implements the default of `Conf.FetchSize`.
+func (self Conf) fetchSize() int {
+	if self.FetchSize > 0 {
+		return self.FetchSize
+	}
+	return defaultFetchSize
+}
+
+// Implements the default of `Conf.RetryAttempts`.
+func (self Conf) retryAttempts() int {
+	if self.RetryAttempts > 0 {
+		return self.RetryAttempts
+	}
+	return defaultRetryAttempts
+}
+
+// Implements the default of `Conf.RetryDelay`.
+func (self Conf) retryDelay() time.Duration {
+	if self.RetryDelay > 0 {
+		return self.RetryDelay
+	}
+	return defaultRetryDelay
+}
+
+// Implements the default of `Conf.RetryMaxDelay`.
+func (self Conf) retryMaxDelay() time.Duration {
+	if self.RetryMaxDelay > 0 {
+		return self.RetryMaxDelay
+	}
+	return defaultRetryMaxDelay
+}
+
+func (self Conf) specOpts() tSpecOpts {
+	return tSpecOpts{
+		coerce:            self.Coerce,
+		zeroNullStructs:   self.ZeroNullStructs,
+		ignoreUnknownCols: self.IgnoreUnknownCols,
+		strictFields:      self.StrictFields,
+		positional:        self.Positional,
+	}
+}
@@ -0,0 +1,90 @@
+package gos
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+/*
+Returns a context that carries the given connection, typically the current
+transaction, which is used by `ContextConn`. Allows deeply nested code to
+participate in the caller's transaction without passing the connection through
+every function:
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = createOrder(gos.ContextWithConn(ctx, tx), order)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+*/
+func ContextWithConn(ctx context.Context, conn QueryExecer) context.Context {
+	return context.WithValue(ctx, connCtxKey{}, conn)
+}
+
+// Returns the connection carried by the context, see `ContextWithConn`.
+func ConnFromContext(ctx context.Context) (QueryExecer, bool) {
+	conn, ok := ctx.Value(connCtxKey{}).(QueryExecer)
+	return conn, ok && conn != nil
+}
+
+/*
+Implements `QueryExecer` by using the connection carried by the context, see
+`ContextWithConn`, falling back on the default connection. Passing it to
+`Query` and other functions allows code to use the caller's transaction when
+there is one, and the database otherwise:
+
+	var conn = gos.ContextConn{Default: db}
+
+	func createOrder(ctx context.Context, order Order) error {
+		return gos.Query(ctx, conn, nil, query, gos.StructArgs(order))
+	}
+
+Without a connection in the context and without a default connection, queries
+fail with `ErrInvalidInput`.
+*/
+type ContextConn struct {
+	// Used when the context doesn't carry a connection. Optional.
+	Default QueryExecer
+}
+
+// Implement `Queryer`.
+func (self ContextConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	conn, err := self.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.QueryContext(ctx, query, args...)
+}
+
+// Implement `Execer`.
+func (self ContextConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	conn, err := self.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.ExecContext(ctx, query, args...)
+}
+
+/* Internal */
+
+type connCtxKey struct{}
+
+func (self ContextConn) conn(ctx context.Context) (QueryExecer, error) {
+	conn, ok := ConnFromContext(ctx)
+	if ok {
+		return conn, nil
+	}
+	if self.Default != nil {
+		return self.Default, nil
+	}
+	return nil, ErrInvalidInput.while(`resolving connection`).because(
+		fmt.Errorf(`missing connection in context and missing default connection`),
+	)
+}
@@ -0,0 +1,140 @@
+package gos
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+Bulk-loads structs into the given table via Postgres `copy ... from stdin`,
+which is much faster than multi-row `insert` for large loads. Returns the
+amount of copied rows. Columns and values are the same as for
+`ColsInsert` and `StructArgs`: fields tagged `readonly` are omitted, and
+options such as `zeronull` apply. Example:
+
+	count, err := gos.CopyFrom(ctx, db, `persons`, persons)
+
+The table name is used as-is, which allows schema-qualified names, and must not
+come from user input. Values are converted like query arguments, see
+`ConvertArgs`.
+
+Requires a driver that implements `copy` via prepared statements, such as
+"github.com/lib/pq". Copying exists only inside transactions. When the
+connection can begin transactions, such as `*sql.DB` or `*sql.Conn`, a
+transaction is begun for the copy and committed after success. Otherwise the
+connection must already be a transaction, such as `*sql.Tx`. The query guard
+and auditing apply to the generated `copy` statement.
+*/
+func CopyFrom[T any](ctx context.Context, conn QueryPreparer, table string, rows []T) (int64, error) {
+	var index int
+	return copyFrom(ctx, conn, table, func() (T, bool, error) {
+		if index >= len(rows) {
+			var zero T
+			return zero, false, nil
+		}
+		index++
+		return rows[index-1], true, nil
+	})
+}
+
+/*
+Streaming variant of `CopyFrom`, which copies the values received from the
+channel until it's closed. Allows to load data sets that don't fit in memory,
+such as rows produced by another goroutine while reading a file. Fails when the
+context is canceled while waiting for values.
+*/
+func CopyFromChan[T any](ctx context.Context, conn QueryPreparer, table string, rows <-chan T) (int64, error) {
+	return copyFrom(ctx, conn, table, func() (T, bool, error) {
+		select {
+		case val, ok := <-rows:
+			return val, ok, nil
+		case <-ctx.Done():
+			var zero T
+			return zero, false, ctx.Err()
+		}
+	})
+}
+
+/* Internal */
+
+func copyFrom[T any](ctx context.Context, conn QueryPreparer, table string, next func() (T, bool, error)) (count int64, err error) {
+	var zero T
+	query := `copy ` + table + ` (` + ColsInsert(zero) + `) from stdin`
+
+	err = guardQuery(query)
+	if err != nil {
+		return 0, err
+	}
+
+	beginner, ok := conn.(TxBeginner)
+	if ok {
+		tx, err := beginner.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, Err{While: `beginning copy transaction`, Cause: err}
+		}
+		conn = tx
+
+		defer func() {
+			if err != nil {
+				_ = tx.Rollback()
+				return
+			}
+			err = tx.Commit()
+			if err != nil {
+				count = 0
+				err = Err{While: `committing copy transaction`, Cause: err}
+			}
+		}()
+	}
+
+	done := auditStart(ctx, query, nil)
+	count, err = copyRows(ctx, conn, query, next)
+	if done != nil {
+		done(err)
+	}
+	return count, err
+}
+
+func copyRows[T any](ctx context.Context, conn QueryPreparer, query string, next func() (T, bool, error)) (int64, error) {
+	stmt, err := conn.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, Err{While: `preparing copy`, Cause: err}
+	}
+	defer stmt.Close()
+
+	var count int64
+	for {
+		val, ok, err := next()
+		if err != nil {
+			return count, Err{While: `copying rows`, Cause: err}
+		}
+		if !ok {
+			break
+		}
+
+		args, err := convertArgs(StructArgs(val))
+		if err != nil {
+			return count, err
+		}
+
+		// Executing without arguments would finish the copy.
+		if len(args) == 0 {
+			return count, ErrInvalidInput.while(`copying rows`).because(fmt.Errorf(
+				`row %v has no values`, count,
+			))
+		}
+
+		_, err = stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return count, Err{While: `copying rows`, Cause: fmt.Errorf(`row %v: %w`, count, err)}
+		}
+		count++
+	}
+
+	// Without arguments, flushes the remaining rows and finishes the copy.
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return count, Err{While: `finishing copy`, Cause: err}
+	}
+	return count, nil
+}
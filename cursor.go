@@ -0,0 +1,221 @@
+package gos
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync/atomic"
+)
+
+/*
+Variant of `QueryScanner` that streams the result through a Postgres
+server-side cursor, declared via `declare ... cursor for <query>` and read via
+`fetch forward <n>` in batches of `Conf.FetchSize` rows. Unlike `QueryScanner`,
+this keeps memory usage bounded even with drivers that buffer whole result sets,
+which makes it suitable for exporting huge tables:
+
+	scan, err := gos.Conf{FetchSize: 4096}.QueryCursor(ctx, db, `select * from events`, nil)
+	if err != nil {
+		return err
+	}
+	defer scan.Close()
+
+	for scan.Next() {
+		var event Event
+		err := scan.Scan(&event)
+		// Process `event`.
+	}
+
+Cursors exist only inside transactions. When the connection can begin
+transactions, such as `*sql.DB` or `*sql.Conn`, a transaction is begun for the
+cursor and committed when the scanner is closed, or rolled back after an
+error. Otherwise the connection must already be a transaction, such as
+`*sql.Tx`. The query guard and auditing apply to the given query. The scanner
+MUST be closed after finishing.
+*/
+func QueryCursor(ctx context.Context, conn QueryExecer, query string, args []interface{}) (Scanner, error) {
+	return Conf{}.QueryCursor(ctx, conn, query, args)
+}
+
+// Variant of `QueryCursor` that uses the given configuration.
+func (self Conf) QueryCursor(ctx context.Context, conn QueryExecer, query string, args []interface{}) (Scanner, error) {
+	err := guardQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := convertArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var cancel context.CancelFunc
+	if self.RowTimeout > 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	rows, err := openCursor(ctx, conn, query, args, converted, self.fetchSize())
+	if err != nil {
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
+	}
+	return &scanner{Rows: rows, conf: self, cancel: cancel}, nil
+}
+
+/* Internal */
+
+var cursorCount uint64
+
+/*
+Implements `Rows` over a server-side cursor, see `QueryCursor`. Each batch is
+fetched when the previous one is exhausted. A batch shorter than the fetch size
+is the last one.
+*/
+type tCursorRows struct {
+	ctx    context.Context
+	conn   QueryExecer
+	tx     *sql.Tx // Only when begun by `openCursor`.
+	name   string
+	size   int
+	batch  *sql.Rows
+	count  int // Rows of the current batch reached so far.
+	done   bool
+	closed bool
+	err    error
+}
+
+func openCursor(
+	ctx context.Context, conn QueryExecer,
+	query string, args []interface{}, converted []interface{}, size int,
+) (*tCursorRows, error) {
+	out := &tCursorRows{
+		ctx:  ctx,
+		conn: conn,
+		name: `gos_cursor_` + strconv.FormatUint(atomic.AddUint64(&cursorCount, 1), 10),
+		size: size,
+	}
+
+	beginner, ok := conn.(TxBeginner)
+	if ok {
+		tx, err := beginner.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, Err{While: `beginning cursor transaction`, Cause: err}
+		}
+		out.tx = tx
+		out.conn = tx
+	}
+
+	done := auditStart(ctx, query, args)
+	_, err := out.conn.ExecContext(ctx, `declare `+out.name+` no scroll cursor for `+query, converted...)
+	if done != nil {
+		done(err)
+	}
+	if err == nil {
+		err = out.fetch()
+	}
+
+	if err != nil {
+		if out.tx != nil {
+			_ = out.tx.Rollback()
+		}
+		return nil, Err{While: `declaring cursor`, Cause: err}
+	}
+	return out, nil
+}
+
+func (self *tCursorRows) fetch() error {
+	rows, err := self.conn.QueryContext(self.ctx, `fetch forward `+strconv.Itoa(self.size)+` from `+self.name)
+	if err != nil {
+		return err
+	}
+	self.batch = rows
+	self.count = 0
+	return nil
+}
+
+func (self *tCursorRows) Columns() ([]string, error) { return self.batch.Columns() }
+
+func (self *tCursorRows) ColumnDbTypes() ([]string, error) {
+	colTypes, err := self.batch.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, len(colTypes))
+	for i, colType := range colTypes {
+		out[i] = colType.DatabaseTypeName()
+	}
+	return out, nil
+}
+
+func (self *tCursorRows) Next() bool {
+	if self.err != nil || self.closed {
+		return false
+	}
+
+	if self.batch.Next() {
+		self.count++
+		return true
+	}
+
+	err := self.batch.Err()
+	if err != nil {
+		self.err = err
+		return false
+	}
+	if self.done || self.count < self.size {
+		self.done = true
+		return false
+	}
+
+	err = self.batch.Close()
+	if err == nil {
+		err = self.fetch()
+	}
+	if err != nil {
+		self.err = Err{While: `fetching from cursor`, Cause: err}
+		return false
+	}
+	return self.Next()
+}
+
+func (self *tCursorRows) Scan(dests ...interface{}) error { return self.batch.Scan(dests...) }
+
+func (self *tCursorRows) Err() error {
+	if self.err != nil {
+		return self.err
+	}
+	return self.batch.Err()
+}
+
+/*
+Closes the current batch and the cursor, and finishes the transaction begun
+by `openCursor`, if any: commits it after success, and rolls it back after an
+error.
+*/
+func (self *tCursorRows) Close() error {
+	if self.closed {
+		return nil
+	}
+	self.closed = true
+
+	err := self.batch.Close()
+	if err == nil {
+		_, err = self.conn.ExecContext(self.ctx, `close `+self.name)
+	}
+
+	if self.tx != nil {
+		if err != nil || self.err != nil {
+			_ = self.tx.Rollback()
+		} else {
+			err = self.tx.Commit()
+		}
+	}
+
+	if err != nil {
+		return Err{While: `closing cursor`, Cause: err}
+	}
+	return nil
+}
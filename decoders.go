@@ -0,0 +1,199 @@
+package gos
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Custom decoding function, invoked instead of the default assignment of a column
+value to a struct field. Receives the raw column value, as returned by the
+driver, or nil if the column is null. The destination is the settable field,
+with any enclosing struct pointers already allocated.
+*/
+type DecodeFunc func(src interface{}, dest reflect.Value) error
+
+/*
+Registers a custom decoding function for a specific struct field, identified by
+the struct type and the Go field name. For fields of embedded structs, register
+the decoder on the embedded type. Useful for legacy columns whose format
+doesn't match the field type, such as epochs stored as strings:
+
+	gos.RegisterFieldDecoder(Event{}, `Time`, func(src interface{}, dest reflect.Value) error {
+		str, _ := src.(string)
+		sec, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return err
+		}
+		dest.Set(reflect.ValueOf(time.Unix(sec, 0)))
+		return nil
+	})
+
+Takes priority over `RegisterColumnDecoder`. The field may have any type,
+including a nested struct, which is then decoded from one column. Panics if the
+type is not a struct or doesn't have the field. Should be called during
+initialization. Clears cached data, see `ClearCaches`.
+*/
+func RegisterFieldDecoder(typ interface{}, fieldName string, fun DecodeFunc) {
+	rtype := refut.RtypeDeref(reflect.TypeOf(typ))
+	if rtype == nil || rtype.Kind() != reflect.Struct {
+		panic(ErrInvalidInput.while(`registering field decoder`).because(
+			fmt.Errorf(`expected struct, got %q`, rtype),
+		))
+	}
+
+	sfield, ok := rtype.FieldByName(fieldName)
+	if !ok || len(sfield.Index) != 1 {
+		panic(ErrInvalidInput.while(`registering field decoder`).because(
+			fmt.Errorf(`type %q doesn't have field %q`, rtype, fieldName),
+		))
+	}
+
+	decoders.Lock()
+	decoders.fields[tFieldDecoderKey{rtype, fieldName}] = fun
+	decoders.Unlock()
+	ClearCaches()
+}
+
+/*
+Registers a custom decoding function for every field of the given Go type
+whose column has the given database type, as reported by
+`sql.ColumnType.DatabaseTypeName`, for example "TEXT" or "INT4". Database type
+names are driver-specific and compared case-insensitively. Example:
+
+	gos.RegisterColumnDecoder(`TEXT`, time.Time{}, decodeEpochString)
+
+Should be called during initialization. Clears cached data, see `ClearCaches`.
+*/
+func RegisterColumnDecoder(dbType string, typ interface{}, fun DecodeFunc) {
+	decoders.Lock()
+	decoders.columns[tColumnDecoderKey{strings.ToUpper(dbType), reflect.TypeOf(typ)}] = fun
+	decoders.Unlock()
+	ClearCaches()
+}
+
+/*
+Registers a custom decoding function for every field of the given Go type, and
+for scalar destinations of that type. A package-level extension point for
+types that don't implement `sql.Scanner`, such as geometric types or enums
+defined elsewhere:
+
+	gos.RegisterDecoder(Point{}, func(src interface{}, dest reflect.Value) error {
+		str, _ := src.(string)
+		var point Point
+		_, err := fmt.Sscanf(str, `(%f,%f)`, &point.X, &point.Y)
+		dest.Set(reflect.ValueOf(point))
+		return err
+	})
+
+Matches the exact type: decoders registered for `T` don't apply to `*T`.
+Structs of such types are decoded from one column rather than nested columns.
+Field and column decoders take priority, see `RegisterFieldDecoder` and
+`RegisterColumnDecoder`, while built-in decoding, such as for `time.Duration`
+or "math/big" types, applies only to types without registered decoders.
+Registering another decoder for the same type replaces the previous one.
+Should be called during initialization. Clears cached data, see `ClearCaches`.
+*/
+func RegisterDecoder(typ interface{}, fun DecodeFunc) {
+	decoders.Lock()
+	decoders.types[reflect.TypeOf(typ)] = fun
+	decoders.Unlock()
+	ClearCaches()
+}
+
+/* Internal */
+
+type tFieldDecoderKey struct {
+	rtype     reflect.Type
+	fieldName string
+}
+
+type tColumnDecoderKey struct {
+	dbType string
+	rtype  reflect.Type
+}
+
+var decoders = struct {
+	sync.RWMutex
+	fields  map[tFieldDecoderKey]DecodeFunc
+	columns map[tColumnDecoderKey]DecodeFunc
+	types   map[reflect.Type]DecodeFunc
+}{
+	fields:  map[tFieldDecoderKey]DecodeFunc{},
+	columns: map[tColumnDecoderKey]DecodeFunc{},
+	types:   map[reflect.Type]DecodeFunc{},
+}
+
+var interfaceRtype = reflect.TypeOf((*interface{})(nil)).Elem()
+
+/*
+Reports whether any decoders depend on database column types, which requires
+the decoding spec to take them into account.
+*/
+func hasColumnDecoders() bool {
+	decoders.RLock()
+	defer decoders.RUnlock()
+	return len(decoders.columns) > 0
+}
+
+// Reports whether any column decoders are registered for the given Go type.
+func hasColumnDecodersFor(rtype reflect.Type) bool {
+	decoders.RLock()
+	defer decoders.RUnlock()
+	for key := range decoders.columns {
+		if key.rtype == rtype {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Finds the decoder for the given field of the given struct type, if any. The
+database type may be empty.
+*/
+func findDecoder(rtype reflect.Type, sfield reflect.StructField, dbType string) DecodeFunc {
+	decoders.RLock()
+	defer decoders.RUnlock()
+
+	fun := decoders.fields[tFieldDecoderKey{rtype, sfield.Name}]
+	if fun != nil {
+		return fun
+	}
+
+	if dbType != "" {
+		fun = decoders.columns[tColumnDecoderKey{strings.ToUpper(dbType), sfield.Type}]
+		if fun != nil {
+			return fun
+		}
+	}
+	return decoders.types[sfield.Type]
+}
+
+/*
+Finds the decoder for a scalar of the given type decoded from a column of the
+given database type, if any. The database type may be empty.
+*/
+func findScalarDecoder(rtype reflect.Type, dbType string) DecodeFunc {
+	decoders.RLock()
+	defer decoders.RUnlock()
+
+	if dbType != "" {
+		fun := decoders.columns[tColumnDecoderKey{strings.ToUpper(dbType), rtype}]
+		if fun != nil {
+			return fun
+		}
+	}
+	return decoders.types[rtype]
+}
+
+// Finds the decoder registered via `RegisterDecoder`, if any.
+func findTypeDecoder(rtype reflect.Type) DecodeFunc {
+	decoders.RLock()
+	defer decoders.RUnlock()
+	return decoders.types[rtype]
+}
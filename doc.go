@@ -5,7 +5,8 @@ NOT AN ORM, and should be used instead of an ORM, in combination with a simple
 query builder (see below).
 
 See the sibling library "github.com/mitranim/sqlb": a simple query builder that
-supports converting structs into named arguments.
+supports converting structs into named arguments. Its queries can be passed
+directly to `QuerySqlb()` and `QueryScannerSqlb()`.
 
 Key Features
 
@@ -17,6 +18,8 @@ Key Features
 
 • Supports streaming. See `QueryScanner()`.
 
+• Supports decoding deeply nested results via JSON. See `QueryJson()`.
+
 Struct Decoding Rules
 
 When decoding a row into a struct, Gos observes the following rules.
@@ -49,6 +52,11 @@ Same as:
 		B string `db:"b"`
 	}
 
+An embedded struct with a column name in its `db` tag is not flattened, and is
+treated like a nested non-embedded struct, described below. This allows to
+reuse the same group of columns several times in one destination, under
+different prefixes.
+
 3. Fields of nested non-embedded structs are matched with columns whose aliases
 look like `"outer_field.inner_field.innermost_field"` with arbitrary nesting.
 Example:
@@ -70,7 +78,9 @@ Example:
 4. If every column from a nested struct is null or missing, the entire nested
 struct is considered null. If the field is not nilable (struct, not pointer
 to struct), this will produce an error. Otherwise, the field is left nil and
-not allocated. This convention is extremely useful for outer joins, where
+not allocated. Null columns count as null regardless of the field type, even
+for types such as `sql.NullString` or other implementations of
+`sql.Scanner`. This convention is extremely useful for outer joins, where
 nested records are often null. Example:
 
 	-- Query:
@@ -90,6 +100,90 @@ nested records are often null. Example:
 	// Output:
 	Outer{OuterVal: "one", Inner: nil}
 
+5. Fields of type `interface{}` receive raw column values, as returned by the
+driver, with nulls represented as nil. Byte slices are copied, and remain valid
+after the rows are closed. This is useful for generic tooling that stores "the
+rest of the row" alongside typed fields.
+
+6. Fields of fixed-size byte array types, such as `[32]byte`, are decoded from
+binary columns whose length must match exactly. This is convenient for hashes
+and binary keys. Byte arrays are also supported as query arguments.
+
+7. Fields that implement `xml.Unmarshaler`, or whose `db` tag includes the `xml`
+option, such as `db:"payload,xml"`, are decoded from XML columns via
+"encoding/xml". Such fields always correspond to a single column, even if
+they're structs.
+
+8. Fields which are slices of non-scannable structs are decoded as one-to-many
+relations from a join that repeats the parent row. Their columns are nested,
+as in rule 3. Rows with the same key, marked by the `key` option, such as
+`db:"id,key"`, are merged into one parent, appending the children. A child
+whose columns are all null, as in a left join without matches, is skipped.
+Children with keys are merged in the same way, which supports multiple levels
+of joins. Keys of types such as `sql.NullInt64` or `sql.Null[T]` count as null
+when not valid. Merging applies to `Query()` and `QuerySlice()`, but not to
+`QueryScanner()`, which decodes each row separately. Example:
+
+	-- Query:
+	select persons.*, orders.id as "orders.id"
+	from persons left join orders on orders.person_id = persons.id;
+
+	// Go types:
+	type Person struct {
+		Id     string  `db:"id,key"`
+		Orders []Order `db:"orders"`
+	}
+	type Order struct {
+		Id string `db:"id"`
+	}
+
+9. A nested struct may also be decoded from a single Postgres composite value,
+whose column alias matches the field's alias, instead of nested columns. The
+attributes of the composite are assigned to the fields positionally, in the
+order of `Cols`, which must match the composite type. This supports selecting
+whole rows, as in `select persons, orders.* from ...`. Example:
+
+	-- Query:
+	select persons as "person", orders.id from persons join orders on ...;
+
+	// Go types:
+	type Order struct {
+		Id     string `db:"id"`
+		Person Person `db:"person"`
+	}
+	type Person struct {
+		Id   string `db:"id"`
+		Name string `db:"name"`
+	}
+
+10. Fields of types such as `map[string]string` and `map[string]*string` are
+decoded from Postgres `hstore` columns. Null values require pointers, and null
+columns produce nil maps. Such maps are passed to the driver as-is when used as
+query arguments; to encode an argument as `hstore`, use `Hstore`.
+
+11. Fields of type `time.Duration` are decoded from Postgres `interval`
+columns, counting days as 24 hours. Intervals with months are rejected, since
+their length is ambiguous; use `Interval` for those. Integer columns are
+decoded as nanoseconds, as usual.
+
+12. Fields of types `big.Int`, `big.Rat` and `big.Float` from "math/big", and
+pointers to them, are decoded from `numeric` and other numeric columns without
+losing precision. Other decimal types can be supported by implementing
+`sql.Scanner`, or by registering decoders, which take priority over built-in
+decoding, see `RegisterColumnDecoder`.
+
+13. A top-level or embedded field of type `map[string]interface{}` whose `db`
+tag has the `rest` option and no column name, such as `db:",rest"`, receives
+every column that has no other destination, keyed by column name, with raw
+values as in rule 5. Without such columns, the map is nil. This takes priority
+over `Conf.IgnoreUnknownCols`, and is useful for queries with dynamic extra
+columns. Example:
+
+	type Person struct {
+		Id    string                 `db:"id"`
+		Extra map[string]interface{} `db:",rest"`
+	}
+
 Differences From sqlx
 
 Gos is somewhat similar to https://github.com/jmoiron/sqlx. Key differences:
@@ -104,7 +198,9 @@ DB will optimize them out of the query.
 
 • Explicit field-column mapping, no hidden renaming.
 
-• Has only one tiny dependency (most deps in `go.mod` are test-only).
+• Has only two tiny dependencies (most deps in `go.mod` are test-only). The pgx
+adapter "github.com/mitranim/gos/gospgx" is a separate module with its own
+dependencies.
 
 • ... probably more
 
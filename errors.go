@@ -13,15 +13,20 @@ variables with `errors.Is`.
 type ErrCode string
 
 const (
-	ErrCodeUnknown      ErrCode = ""
-	ErrCodeNoRows       ErrCode = "ErrNoRows"
-	ErrCodeMultipleRows ErrCode = "ErrMultipleRows"
-	ErrCodeInvalidDest  ErrCode = "ErrInvalidDest"
-	ErrCodeInvalidInput ErrCode = "ErrInvalidInput"
-	ErrCodeNoColDest    ErrCode = "ErrNoColDest"
-	ErrCodeRedundantCol ErrCode = "ErrRedundantCol"
-	ErrCodeNull         ErrCode = "ErrNull"
-	ErrCodeScan         ErrCode = "ErrScan"
+	ErrCodeUnknown         ErrCode = ""
+	ErrCodeNoRows          ErrCode = "ErrNoRows"
+	ErrCodeMultipleRows    ErrCode = "ErrMultipleRows"
+	ErrCodeInvalidDest     ErrCode = "ErrInvalidDest"
+	ErrCodeInvalidInput    ErrCode = "ErrInvalidInput"
+	ErrCodeNoColDest       ErrCode = "ErrNoColDest"
+	ErrCodeRedundantCol    ErrCode = "ErrRedundantCol"
+	ErrCodeNull            ErrCode = "ErrNull"
+	ErrCodeScan            ErrCode = "ErrScan"
+	ErrCodeDuplicateKey    ErrCode = "ErrDuplicateKey"
+	ErrCodeTimeout         ErrCode = "ErrTimeout"
+	ErrCodeQueryNotAllowed ErrCode = "ErrQueryNotAllowed"
+	ErrCodeMissingCol      ErrCode = "ErrMissingCol"
+	ErrCodeTooManyRows     ErrCode = "ErrTooManyRows"
 )
 
 /*
@@ -36,14 +41,19 @@ include additional details about the circumstances. When compared by
 `errors.Is`, they compare `.Cause` and fall back on `.Code`.
 */
 var (
-	ErrNoRows       Err = Err{Code: ErrCodeNoRows, Cause: sql.ErrNoRows}
-	ErrMultipleRows Err = Err{Code: ErrCodeMultipleRows, Cause: errors.New(`expected one row, got multiple`)}
-	ErrInvalidDest  Err = Err{Code: ErrCodeInvalidDest, Cause: errors.New(`invalid destination`)}
-	ErrInvalidInput Err = Err{Code: ErrCodeInvalidInput, Cause: errors.New(`invalid input`)}
-	ErrNoColDest    Err = Err{Code: ErrCodeNoColDest, Cause: errors.New(`column has no matching destination`)}
-	ErrRedundantCol Err = Err{Code: ErrCodeRedundantCol, Cause: errors.New(`redundant column occurrence`)}
-	ErrNull         Err = Err{Code: ErrCodeNull, Cause: errors.New(`null column for non-nilable field`)}
-	ErrScan         Err = Err{Code: ErrCodeScan, Cause: errors.New(`error while scanning row`)}
+	ErrNoRows          Err = Err{Code: ErrCodeNoRows, Cause: sql.ErrNoRows}
+	ErrMultipleRows    Err = Err{Code: ErrCodeMultipleRows, Cause: errors.New(`expected one row, got multiple`)}
+	ErrInvalidDest     Err = Err{Code: ErrCodeInvalidDest, Cause: errors.New(`invalid destination`)}
+	ErrInvalidInput    Err = Err{Code: ErrCodeInvalidInput, Cause: errors.New(`invalid input`)}
+	ErrNoColDest       Err = Err{Code: ErrCodeNoColDest, Cause: errors.New(`column has no matching destination`)}
+	ErrRedundantCol    Err = Err{Code: ErrCodeRedundantCol, Cause: errors.New(`redundant column occurrence`)}
+	ErrNull            Err = Err{Code: ErrCodeNull, Cause: errors.New(`null column for non-nilable field`)}
+	ErrScan            Err = Err{Code: ErrCodeScan, Cause: errors.New(`error while scanning row`)}
+	ErrDuplicateKey    Err = Err{Code: ErrCodeDuplicateKey, Cause: errors.New(`duplicate key`)}
+	ErrTimeout         Err = Err{Code: ErrCodeTimeout, Cause: errors.New(`timeout`)}
+	ErrQueryNotAllowed Err = Err{Code: ErrCodeQueryNotAllowed, Cause: errors.New(`query not allowed`)}
+	ErrMissingCol      Err = Err{Code: ErrCodeMissingCol, Cause: errors.New(`field has no matching column`)}
+	ErrTooManyRows     Err = Err{Code: ErrCodeTooManyRows, Cause: errors.New(`too many rows`)}
 )
 
 // Describes a Gos error.
@@ -94,3 +104,39 @@ func (self Err) because(cause error) Err {
 	self.Cause = cause
 	return self
 }
+
+/*
+Error returned by `Conf.RunBatch` when some items of a batch have failed.
+Contains one entry per batch item, in the same order, which is nil for items
+that succeeded. `errors.Is` checks every entry.
+*/
+type BatchErr []error
+
+// Implement `error`.
+func (self BatchErr) Error() string {
+	var count int
+	var first error
+	for _, err := range self {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			count++
+		}
+	}
+
+	if first == nil {
+		return ``
+	}
+	return fmt.Sprintf(`%v of %v batch items failed, first error: %v`, count, len(self), first)
+}
+
+// Implement a hidden interface in "errors".
+func (self BatchErr) Is(other error) bool {
+	for _, err := range self {
+		if err != nil && errors.Is(err, other) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package gos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/*
+Options for `Explain`, corresponding to the options of the Postgres `explain`
+command. The zero value produces a plain `explain`.
+*/
+type ExplainOpts struct {
+	// Executes the query to collect actual timings. Beware of side effects.
+	Analyze bool
+	Verbose bool
+	Buffers bool
+	// One of "text", "xml", "json" or "yaml". Empty means "text".
+	Format string
+}
+
+/*
+Shortcut for `ExplainOpts{}.Explain`. Runs `explain` for the given query and
+decodes the plan into the destination, which allows tooling around query
+analysis to avoid shelling out to "psql".
+*/
+func Explain(ctx context.Context, conn Queryer, dest interface{}, query string, args []interface{}) error {
+	return ExplainOpts{}.Explain(ctx, conn, dest, query, args)
+}
+
+/*
+Runs `explain` with the given options for the given query, and decodes the plan
+into the destination. In text, xml and yaml formats, Postgres returns one or
+more rows with a single column named "QUERY PLAN", which are decoded like any
+other query result, for example into `[]string`, or into structs with the
+corresponding `db` tag:
+
+	type PlanLine struct {
+		Line string `db:"QUERY PLAN"`
+	}
+
+	var plan []PlanLine
+	err := gos.Explain(ctx, conn, &plan, query, args)
+
+In json format, the plan is a single JSON document. Destinations of type
+`string`, `[]byte` or `json.RawMessage` receive the raw JSON, and other
+destinations are decoded via "encoding/json":
+
+	var plan []struct {
+		Plan struct {
+			NodeType  string  `json:"Node Type"`
+			TotalCost float64 `json:"Total Cost"`
+		}
+	}
+	err := gos.ExplainOpts{Format: `json`}.Explain(ctx, conn, &plan, query, args)
+
+When the query guard is enabled, the `explain` statement must be allowed
+separately from the query, see `SetQueryGuard`.
+*/
+func (self ExplainOpts) Explain(ctx context.Context, conn Queryer, dest interface{}, query string, args []interface{}) error {
+	query, err := self.query(query)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(self.Format, `json`) {
+		return Conf{}.queryInto(ctx, conn, dest, query, args)
+	}
+
+	err = validateDestPtr(dest)
+	if err != nil {
+		return err
+	}
+
+	var str string
+	err = Conf{}.queryInto(ctx, conn, &str, query, args)
+	if err != nil {
+		return err
+	}
+
+	switch dest := dest.(type) {
+	case *string:
+		*dest = str
+	case *[]byte:
+		*dest = []byte(str)
+	case *json.RawMessage:
+		*dest = json.RawMessage(str)
+	default:
+		err := json.Unmarshal([]byte(str), dest)
+		if err != nil {
+			return Err{Code: ErrCodeScan, While: `decoding JSON plan`, Cause: err}
+		}
+	}
+	return nil
+}
+
+/* Internal */
+
+func (self ExplainOpts) query(query string) (string, error) {
+	var opts []string
+	if self.Analyze {
+		opts = append(opts, `analyze`)
+	}
+	if self.Verbose {
+		opts = append(opts, `verbose`)
+	}
+	if self.Buffers {
+		opts = append(opts, `buffers`)
+	}
+
+	if self.Format != `` {
+		format := strings.ToLower(self.Format)
+		if stringIndex(explainFormats, format) < 0 {
+			return ``, ErrInvalidInput.while(`preparing explain`).because(fmt.Errorf(
+				`unsupported format %q, expected one of: %v`, self.Format, strings.Join(explainFormats, `, `),
+			))
+		}
+		opts = append(opts, `format `+format)
+	}
+
+	if len(opts) == 0 {
+		return `explain ` + query, nil
+	}
+	return `explain (` + strings.Join(opts, `, `) + `) ` + query, nil
+}
+
+var explainFormats = []string{`text`, `xml`, `json`, `yaml`}
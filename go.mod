@@ -1,12 +1,14 @@
 module github.com/mitranim/gos
 
-go 1.13
+go 1.18
 
 // Actual dependencies.
-require github.com/mitranim/refut v0.1.3
-
-// Test-only dependencies.
 require (
-	github.com/lib/pq v1.3.0
+	github.com/mitranim/refut v0.1.3
 	github.com/mitranim/sqlb v0.1.16
 )
+
+// Test-only dependencies.
+require github.com/lib/pq v1.3.0
+
+require github.com/mitranim/sqlp v0.1.4 // indirect
@@ -0,0 +1,96 @@
+package gospgx
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mitranim/gos"
+)
+
+/*
+Database connection required by `RunBatch`. Satisfied by `*pgx.Conn`,
+`*pgxpool.Pool` and `pgx.Tx`.
+*/
+type Batcher interface {
+	SendBatch(context.Context, *pgx.Batch) pgx.BatchResults
+}
+
+/*
+Same as `gos.RunBatch`, but for pgx, which pipelines the batch: every item is
+sent in a single round trip, and the results are decoded in order, following
+the same rules as `Query`. Returns nil when every item has succeeded, otherwise
+`gos.BatchErr` with one entry per item. Every query is checked against the
+query guard, see `gos.SetQueryGuard`, before sending the batch; if any query
+is not allowed, nothing is sent, and the guard error is returned as-is.
+
+Postgres executes a pipelined batch in an implicit transaction, unless the
+connection is already in a transaction. After an item fails, the remaining
+items fail too, and the changes of the previous items are rolled back.
+Channel destinations are not supported.
+*/
+func RunBatch(ctx context.Context, conn Batcher, batch *gos.Batch) error {
+	return RunBatchConf(ctx, conn, gos.Conf{}, batch)
+}
+
+// Variant of `RunBatch` that uses the given configuration.
+func RunBatchConf(ctx context.Context, conn Batcher, conf gos.Conf, batch *gos.Batch) error {
+	if batch == nil || len(batch.Items) == 0 {
+		return nil
+	}
+
+	var pgxBatch pgx.Batch
+	for _, item := range batch.Items {
+		err := gos.GuardQuery(item.Query)
+		if err != nil {
+			return err
+		}
+		pgxBatch.Queue(item.Query, item.Args...)
+	}
+
+	results := conn.SendBatch(ctx, &pgxBatch)
+
+	var errs gos.BatchErr
+	for i, item := range batch.Items {
+		err := runBatchItem(results, conf, item)
+		if err != nil {
+			if errs == nil {
+				errs = make(gos.BatchErr, len(batch.Items))
+			}
+			errs[i] = err
+		}
+	}
+
+	err := results.Close()
+	if err != nil && errs == nil {
+		return gos.Err{While: `closing batch`, Cause: err}
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+func runBatchItem(results pgx.BatchResults, conf gos.Conf, item gos.BatchItem) error {
+	if isNil(item.Dest) {
+		_, err := results.Exec()
+		if err != nil {
+			return gos.Err{While: `executing query`, Cause: err}
+		}
+		return nil
+	}
+
+	rows, err := results.Query()
+	if err != nil {
+		return gos.Err{While: `querying rows`, Cause: err}
+	}
+	return conf.ScanRows(item.Dest, Rows(rows))
+}
+
+func isNil(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+	rval := reflect.ValueOf(val)
+	return rval.Kind() == reflect.Ptr && rval.IsNil()
+}
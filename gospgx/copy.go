@@ -0,0 +1,52 @@
+package gospgx
+
+import (
+	"context"
+	"io"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mitranim/gos"
+)
+
+/*
+Connection required by `CopyTo`. Satisfied by `*pgx.Conn`. For `pgx.Tx`, use
+`tx.Conn()`; for `*pgxpool.Pool`, acquire a connection first.
+*/
+type PgConner interface {
+	PgConn() *pgconn.PgConn
+}
+
+/*
+Streams the result of the query into the writer via Postgres `copy ... to
+stdout`, without the per-row overhead of the regular protocol, and returns the
+amount of copied rows. Meant for ETL-style exports of large results, such as
+writing a CSV file or an HTTP response. The options, if any, are passed to the
+`with` clause, for example "format csv, header" or "format binary"; without
+options, the output uses the Postgres text format. Example:
+
+	count, err := gospgx.CopyTo(ctx, conn, file, `select * from events`, `format csv, header`)
+
+`copy` doesn't support query parameters, so the query must be complete, and
+must not include unescaped user input. Like other functions of this package,
+this checks the query guard, see `gos.SetQueryGuard`, for the given query.
+Rows are written as they arrive, so the writer may receive a partial result
+when the query fails midway. To decode a large result into structs in batches
+instead, see `gos.QueryCursor` and `gos.ScanSlice`.
+*/
+func CopyTo(ctx context.Context, conn PgConner, out io.Writer, query string, opts string) (int64, error) {
+	err := gos.GuardQuery(query)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `copy (` + query + `) to stdout`
+	if opts != `` {
+		stmt += ` with (` + opts + `)`
+	}
+
+	tag, err := conn.PgConn().CopyTo(ctx, out, stmt)
+	if err != nil {
+		return 0, gos.Err{While: `copying rows`, Cause: err}
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,18 @@
+module github.com/mitranim/gos/gospgx
+
+go 1.19
+
+require (
+	github.com/jackc/pgx/v5 v5.5.5
+	github.com/mitranim/gos v0.1.11
+)
+
+require (
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/mitranim/refut v0.1.3 // indirect
+	github.com/mitranim/sqlb v0.1.16 // indirect
+	github.com/mitranim/sqlp v0.1.4 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
@@ -0,0 +1,115 @@
+/*
+Adapter for using Gos with pgx ("github.com/jackc/pgx/v5") natively, without
+"database/sql". Works with `*pgx.Conn`, `*pgxpool.Pool` and `pgx.Tx`:
+
+	var persons []Person
+	err := gospgx.Query(ctx, pool, &persons, `select * from persons`, nil)
+
+Decoding follows the same rules as `gos.Query`, while scanning of individual
+columns is performed by pgx. Queries are checked against the query guard, see
+`gos.SetQueryGuard`, but are otherwise executed by pgx directly, without the
+argument conversion and audit hooks of Gos, which apply to "database/sql"
+connections. Arguments such as `gos.StructArgs` must be converted by the
+caller.
+*/
+package gospgx
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mitranim/gos"
+)
+
+/*
+Database connection required by `Query` and `QueryScanner`. Satisfied by
+`*pgx.Conn`, `*pgxpool.Pool` and `pgx.Tx`.
+*/
+type Querier interface {
+	Query(context.Context, string, ...interface{}) (pgx.Rows, error)
+}
+
+// Same as `gos.Query`, but for pgx. The destination must be non-nil.
+func Query(ctx context.Context, conn Querier, dest interface{}, query string, args []interface{}) error {
+	return QueryConf(ctx, conn, gos.Conf{}, dest, query, args)
+}
+
+// Variant of `Query` that uses the given configuration.
+func QueryConf(ctx context.Context, conn Querier, conf gos.Conf, dest interface{}, query string, args []interface{}) error {
+	err := gos.GuardQuery(query)
+	if err != nil {
+		return err
+	}
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return gos.Err{While: `querying rows`, Cause: err}
+	}
+	return conf.ScanRows(dest, Rows(rows))
+}
+
+// Same as `gos.QueryScanner`, but for pgx. The scanner MUST be closed.
+func QueryScanner(ctx context.Context, conn Querier, query string, args []interface{}) (gos.Scanner, error) {
+	return QueryScannerConf(ctx, conn, gos.Conf{}, query, args)
+}
+
+// Variant of `QueryScanner` that uses the given configuration.
+func QueryScannerConf(ctx context.Context, conn Querier, conf gos.Conf, query string, args []interface{}) (gos.Scanner, error) {
+	err := gos.GuardQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, gos.Err{While: `querying rows`, Cause: err}
+	}
+	return conf.NewScanner(Rows(rows)), nil
+}
+
+/*
+Adapts `pgx.Rows` to `gos.Rows`, for use with `gos.NewScanner` and
+`gos.ScanRows`.
+*/
+func Rows(rows pgx.Rows) gos.Rows { return pgxRows{rows} }
+
+type pgxRows struct{ pgx.Rows }
+
+func (self pgxRows) Columns() ([]string, error) {
+	fields := self.FieldDescriptions()
+	out := make([]string, len(fields))
+	for i, field := range fields {
+		out[i] = field.Name
+	}
+	return out, nil
+}
+
+// Unlike `(*sql.Rows).Close`, `pgx.Rows.Close` doesn't return an error.
+func (self pgxRows) Close() error {
+	self.Rows.Close()
+	return nil
+}
+
+/*
+Optional method of `gos.Rows`. Uses the same uppercase names as
+`(*sql.ColumnType).DatabaseTypeName`. Unknown types have empty names.
+*/
+func (self pgxRows) ColumnDbTypes() ([]string, error) {
+	fields := self.FieldDescriptions()
+	out := make([]string, len(fields))
+
+	conn := self.Conn()
+	if conn == nil {
+		return out, nil
+	}
+
+	types := conn.TypeMap()
+	for i, field := range fields {
+		typ, ok := types.TypeForOID(field.DataTypeOID)
+		if ok {
+			out[i] = strings.ToUpper(typ.Name)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,287 @@
+package gospgx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/user"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mitranim/gos"
+)
+
+const testDbName = `gospgx_test_db`
+
+var testConn *pgx.Conn
+
+func TestMain(m *testing.M) {
+	os.Exit(runTestMain(m))
+}
+
+// This is a separate function to allow `defer` before `os.Exit`.
+func runTestMain(m *testing.M) int {
+	ctx := context.Background()
+
+	/**
+	Same setup as the tests of the parent package: use the current OS user as
+	the Postgres user, and create a test database, dropping it at the end.
+	*/
+	usr, err := user.Current()
+	if err != nil {
+		panic(err)
+	}
+	connParams := []string{`host=localhost`, `sslmode=disable`, `user=` + usr.Username}
+
+	dropDb(ctx, connParams, testDbName)
+	err = withPostgresDb(ctx, connParams, func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, `create database `+testDbName)
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer dropDb(ctx, connParams, testDbName)
+
+	conn, err := pgx.Connect(ctx, strings.Join(append(connParams, `dbname=`+testDbName), ` `))
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close(ctx)
+	testConn = conn
+
+	return m.Run()
+}
+
+func TestRows(t *testing.T) {
+	ctx, tx := testInit(t)
+
+	rows, err := tx.Query(ctx, `select 1::int8 as one, 'two'::text as two, null::jsonb as three`)
+	try(t, err)
+
+	adapted := Rows(rows)
+	defer adapted.Close()
+
+	cols, err := adapted.Columns()
+	try(t, err)
+	eq(t, []string{`one`, `two`, `three`}, cols)
+
+	dbTypes, err := adapted.(pgxRows).ColumnDbTypes()
+	try(t, err)
+	eq(t, []string{`INT8`, `TEXT`, `JSONB`}, dbTypes)
+}
+
+func TestQuery(t *testing.T) {
+	ctx, tx := testInit(t)
+
+	type Pair struct {
+		One int64   `db:"one"`
+		Two *string `db:"two"`
+	}
+
+	var result []Pair
+	try(t, Query(ctx, tx, &result, `select * from (values (1::int8, 'two'), (3, null)) as _ (one, two)`, nil))
+
+	two := `two`
+	eq(t, []Pair{{1, &two}, {3, nil}}, result)
+}
+
+func TestCopyTo(t *testing.T) {
+	ctx, tx := testInit(t)
+
+	const query = `select * from (values (1, 'one'), (2, 'two, three')) as _ (id, name)`
+
+	var buf bytes.Buffer
+	count, err := CopyTo(ctx, tx.Conn(), &buf, query, `format csv, header`)
+	try(t, err)
+	eq(t, int64(2), count)
+	eq(t, "id,name\n1,one\n2,\"two, three\"\n", buf.String())
+
+	buf.Reset()
+	count, err = CopyTo(ctx, tx.Conn(), &buf, `select 'one' as val`, ``)
+	try(t, err)
+	eq(t, int64(1), count)
+	eq(t, "one\n", buf.String())
+}
+
+func TestCopyTo_guard(t *testing.T) {
+	ctx, tx := testInit(t)
+
+	gos.SetQueryGuard(true)
+	defer gos.SetQueryGuard(false)
+
+	const query = `select 'guarded' as val`
+
+	var buf bytes.Buffer
+	_, err := CopyTo(ctx, tx.Conn(), &buf, query, ``)
+	if !errors.Is(err, gos.ErrQueryNotAllowed) {
+		t.Fatalf(`expected ErrQueryNotAllowed, got %+v`, err)
+	}
+	eq(t, 0, buf.Len())
+
+	gos.AllowQueries(query)
+	_, err = CopyTo(ctx, tx.Conn(), &buf, query, ``)
+	try(t, err)
+	eq(t, "guarded\n", buf.String())
+}
+
+func TestQuery_guard(t *testing.T) {
+	ctx, tx := testInit(t)
+
+	gos.SetQueryGuard(true)
+	defer gos.SetQueryGuard(false)
+
+	const query = `select 'guarded query' as val`
+
+	var val string
+	err := Query(ctx, tx, &val, query, nil)
+	if !errors.Is(err, gos.ErrQueryNotAllowed) {
+		t.Fatalf(`expected ErrQueryNotAllowed, got %+v`, err)
+	}
+
+	_, err = QueryScanner(ctx, tx, query, nil)
+	if !errors.Is(err, gos.ErrQueryNotAllowed) {
+		t.Fatalf(`expected ErrQueryNotAllowed, got %+v`, err)
+	}
+
+	gos.AllowQueries(query)
+	try(t, Query(ctx, tx, &val, query, nil))
+	eq(t, `guarded query`, val)
+}
+
+func TestRunBatch_guard(t *testing.T) {
+	ctx, tx := testInit(t)
+
+	gos.SetQueryGuard(true)
+	defer gos.SetQueryGuard(false)
+
+	const allowed = `select 'allowed batch item' as val`
+	const denied = `select 'denied batch item' as val`
+	gos.AllowQueries(allowed)
+
+	var one, two string
+	var batch gos.Batch
+	batch.Queue(allowed, nil, &one)
+	batch.Queue(denied, nil, &two)
+
+	err := RunBatch(ctx, tx, &batch)
+	if !errors.Is(err, gos.ErrQueryNotAllowed) {
+		t.Fatalf(`expected ErrQueryNotAllowed, got %+v`, err)
+	}
+	eq(t, ``, one)
+	eq(t, ``, two)
+}
+
+func TestRunBatch(t *testing.T) {
+	ctx, tx := testInit(t)
+
+	_, err := tx.Exec(ctx, `create temp table batch_test (val text)`)
+	try(t, err)
+
+	var batch gos.Batch
+	var one int64
+	var names []string
+	var pair struct {
+		One int64  `db:"one"`
+		Two string `db:"two"`
+	}
+	batch.Queue(`insert into batch_test values ($1), ($2)`, []interface{}{`one`, `two`}, nil)
+	batch.Queue(`select $1::int8`, []interface{}{1}, &one)
+	batch.Queue(`select val from batch_test order by val`, nil, &names)
+	batch.Queue(`select 1::int8 as one, 'two' as two`, nil, &pair)
+
+	try(t, RunBatch(ctx, tx, &batch))
+	eq(t, int64(1), one)
+	eq(t, []string{`one`, `two`}, names)
+	eq(t, int64(1), pair.One)
+	eq(t, `two`, pair.Two)
+}
+
+func TestRunBatch_errors(t *testing.T) {
+	ctx, tx := testInit(t)
+
+	var batch gos.Batch
+	var one, two, three int64
+	batch.Queue(`select 1::int8`, nil, &one)
+	batch.Queue(`select 2::int8 where false`, nil, &two)
+	batch.Queue(`select 3::int8`, nil, &three)
+
+	err := RunBatch(ctx, tx, &batch)
+	errs, ok := err.(gos.BatchErr)
+	if !ok {
+		t.Fatalf(`expected gos.BatchErr, got %+v`, err)
+	}
+	eq(t, 3, len(errs))
+	try(t, errs[0])
+	try(t, errs[2])
+	if !errors.Is(errs[1], gos.ErrNoRows) || !errors.Is(err, gos.ErrNoRows) {
+		t.Fatalf(`expected ErrNoRows, got %+v`, err)
+	}
+	eq(t, int64(1), one)
+	eq(t, int64(3), three)
+
+	// A database error aborts the pipeline, failing the remaining items.
+	batch = gos.Batch{}
+	batch.Queue(`select 1::int8`, nil, &one)
+	batch.Queue(`select 1 / 0`, nil, &two)
+	batch.Queue(`select 3::int8`, nil, &three)
+
+	err = RunBatch(ctx, tx, &batch)
+	errs, ok = err.(gos.BatchErr)
+	if !ok {
+		t.Fatalf(`expected gos.BatchErr, got %+v`, err)
+	}
+	try(t, errs[0])
+	if errs[1] == nil || errs[2] == nil {
+		t.Fatalf(`expected errors for the failed item and the next one, got %+v`, errs)
+	}
+}
+
+func testInit(t *testing.T) (context.Context, pgx.Tx) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	tx, err := testConn.Begin(ctx)
+	if err != nil {
+		t.Fatalf("failed to start DB transaction: %+v", err)
+	}
+	t.Cleanup(func() { _ = tx.Rollback(context.Background()) })
+
+	return ctx, tx
+}
+
+func dropDb(ctx context.Context, connParams []string, dbName string) {
+	err := withPostgresDb(ctx, connParams, func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, `drop database if exists `+dbName)
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func withPostgresDb(ctx context.Context, connParams []string, fun func(*pgx.Conn) error) error {
+	conn, err := pgx.Connect(ctx, strings.Join(append(connParams, `dbname=postgres`), ` `))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	return fun(conn)
+}
+
+func try(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+}
+
+func eq(t testing.TB, exp, act interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(exp, act) {
+		t.Fatalf("expected: %#v\nactual: %#v\n", exp, act)
+	}
+}
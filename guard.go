@@ -0,0 +1,214 @@
+package gos
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+Enables or disables the query guard. When enabled, every statement executed by
+Gos, including `Query`, `QueryScanner` and their variants, must be
+registered ahead of time via `AllowQueries`, `AllowFingerprints` or
+`RegisterNamedQuery`. Anything else fails with `ErrQueryNotAllowed` before
+reaching the database. Useful for locking down services that previously built
+SQL from strings:
+
+	var queryPersons = gos.RegisterNamedQuery(`persons`, `select * from persons`)
+
+	func init() { gos.SetQueryGuard(true) }
+
+Helpers that wrap the given query, such as `QueryMasked` and `QueryJson`,
+check the given query rather than the wrapped one, so the registered text is
+the same regardless of the helper.
+
+Disabled by default. Registration works regardless of this setting, which
+allows to register queries first and enable enforcement later. Should be called
+during initialization.
+*/
+func SetQueryGuard(enforce bool) {
+	guard.Lock()
+	guard.enforce = enforce
+	guard.Unlock()
+}
+
+/*
+Returns the fingerprint of the query, used by the query guard: a hex-encoded
+SHA-256 hash of the query text, where every sequence of whitespace is collapsed
+into a single space, and leading and trailing whitespace is removed. Queries
+that differ only in formatting have the same fingerprint.
+*/
+func QueryFingerprint(query string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(query), ` `)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Allows the given queries to execute when the query guard is enabled.
+func AllowQueries(queries ...string) {
+	guard.Lock()
+	defer guard.Unlock()
+	for _, query := range queries {
+		guard.fingerprints[QueryFingerprint(query)] = struct{}{}
+	}
+}
+
+/*
+Allows queries with the given fingerprints to execute when the query guard is
+enabled. Fingerprints can be obtained via `QueryFingerprint`, or from the
+errors reported for queries which are not allowed, and stored separately from
+the queries, for example in a configuration file.
+*/
+func AllowFingerprints(fingerprints ...string) {
+	guard.Lock()
+	defer guard.Unlock()
+	for _, val := range fingerprints {
+		guard.fingerprints[val] = struct{}{}
+	}
+}
+
+/*
+Registers the query under the given name and allows it to execute when the
+query guard is enabled. Returns the query as-is, for use in variable
+declarations. The name is included in errors and may be used to find the query
+via `NamedQuery`. Panics if another query is already registered under the same
+name.
+*/
+func RegisterNamedQuery(name string, query string) string {
+	return registerNamedQuery(name, query, nil)
+}
+
+/*
+Variant of `RegisterNamedQuery` that also declares the destination type of the
+query, which allows `ValidateNamedQueries` to check the result columns against
+it. The destination is a value of the type passed to `Query`, without the
+outer pointer:
+
+	var queryPersons = gos.RegisterNamedQueryDest(
+		`persons`, `select * from persons`, []Person(nil),
+	)
+*/
+func RegisterNamedQueryDest(name string, query string, dest interface{}) string {
+	rtype := reflect.TypeOf(dest)
+	if rtype == nil {
+		panic(ErrInvalidInput.while(`registering named query`).because(
+			fmt.Errorf(`missing destination type for name %q`, name),
+		))
+	}
+	return registerNamedQuery(name, query, rtype)
+}
+
+// Returns the query registered under the given name via `RegisterNamedQuery`.
+func NamedQuery(name string) (string, bool) {
+	guard.RLock()
+	defer guard.RUnlock()
+	val, ok := guard.names[name]
+	return val.query, ok
+}
+
+/*
+Checks the query against the query guard, see `SetQueryGuard`. Returns nil
+when the guard is disabled or the query is allowed, and `ErrQueryNotAllowed`
+otherwise. Gos checks queries automatically; this is meant for adapters that
+execute queries by other means, such as "github.com/mitranim/gos/gospgx".
+*/
+func GuardQuery(query string) error { return guardQuery(query) }
+
+/* Internal */
+
+var guard = struct {
+	sync.RWMutex
+	enforce      bool
+	fingerprints map[string]struct{}
+	names        map[string]tNamedQuery
+}{
+	fingerprints: map[string]struct{}{},
+	names:        map[string]tNamedQuery{},
+}
+
+type tNamedQuery struct {
+	query string
+	rtype reflect.Type // Destination type; nil if not declared.
+}
+
+func registerNamedQuery(name string, query string, rtype reflect.Type) string {
+	guard.Lock()
+	defer guard.Unlock()
+
+	val := tNamedQuery{query: query, rtype: rtype}
+	prev, ok := guard.names[name]
+	if ok && prev != val {
+		panic(ErrInvalidInput.while(`registering named query`).because(
+			fmt.Errorf(`redundant query for name %q`, name),
+		))
+	}
+
+	guard.names[name] = val
+	guard.fingerprints[QueryFingerprint(query)] = struct{}{}
+	return query
+}
+
+// Returns the registered named queries, sorted by name.
+func namedQueries() ([]string, []tNamedQuery) {
+	guard.RLock()
+	defer guard.RUnlock()
+
+	names := make([]string, 0, len(guard.names))
+	for name := range guard.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vals := make([]tNamedQuery, len(names))
+	for i, name := range names {
+		vals[i] = guard.names[name]
+	}
+	return names, vals
+}
+
+type guardedQueryCtxKey struct{}
+
+/*
+Checks the caller's query before it's wrapped by a helper such as
+`QueryMasked`, and returns a context that exempts the wrapped query from the
+check in `guardQueryCtx`.
+*/
+func guardWrapped(ctx context.Context, query string, wrapped string) (context.Context, error) {
+	err := guardQuery(query)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, guardedQueryCtxKey{}, wrapped), nil
+}
+
+// Same as `guardQuery`, but skips the query already checked by `guardWrapped`.
+func guardQueryCtx(ctx context.Context, query string) error {
+	wrapped, _ := ctx.Value(guardedQueryCtxKey{}).(string)
+	if wrapped != `` && wrapped == query {
+		return nil
+	}
+	return guardQuery(query)
+}
+
+func guardQuery(query string) error {
+	guard.RLock()
+	defer guard.RUnlock()
+
+	if !guard.enforce {
+		return nil
+	}
+
+	fingerprint := QueryFingerprint(query)
+	_, ok := guard.fingerprints[fingerprint]
+	if ok {
+		return nil
+	}
+
+	return ErrQueryNotAllowed.while(`checking query guard`).because(
+		fmt.Errorf(`query with fingerprint %v is not registered`, fingerprint),
+	)
+}
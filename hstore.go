@@ -0,0 +1,264 @@
+package gos
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Postgres `hstore`, with nil values representing nulls. Implements `sql.Scanner`,
+decoding the text format of `hstore`, and `driver.Valuer`, encoding the same
+format, with keys in sorted order. Nil maps correspond to nulls. Plain maps
+such as `map[string]string` are decoded from `hstore` columns without this
+type, but are not encoded as `hstore` when passed as query arguments, since
+drivers may support them natively, for example as JSON. Conversion is
+explicit:
+
+	args := []interface{}{gos.Hstore{`one`: &one, `two`: nil}}
+*/
+type Hstore map[string]*string
+
+// Implement `sql.Scanner`. Nulls produce a nil map.
+func (self *Hstore) Scan(src interface{}) error {
+	return decodeHstore(src, reflect.ValueOf(self).Elem())
+}
+
+// Implement `driver.Valuer`. Nil maps produce nulls.
+func (self Hstore) Value() (driver.Value, error) {
+	val, err := convertHstore(self)
+	if val == nil || err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+/*
+Decodes a Postgres `hstore` column, such as `"one"=>"1", "two"=>NULL`, into a
+map whose type satisfies `isRtypeHstore`, such as `map[string]string` or
+`map[string]*string`. Used as a `DecodeFunc` for fields of such types, and for
+scalar destinations of such types. Null values are decoded as nil pointers,
+and are rejected by maps of non-pointer strings. Null columns produce nil maps.
+*/
+func decodeHstore(src interface{}, dest reflect.Value) error {
+	if dest.Kind() == reflect.Ptr {
+		if src == nil {
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		return decodeHstore(src, dest.Elem())
+	}
+
+	if src == nil {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+
+	var str string
+	switch src := src.(type) {
+	case []byte:
+		str = string(src)
+	case string:
+		str = src
+	default:
+		return fmt.Errorf(`can't decode %T into %q as hstore`, src, dest.Type())
+	}
+
+	pairs, err := parseHstore(str)
+	if err != nil {
+		return err
+	}
+
+	rtype := dest.Type()
+	out := reflect.MakeMapWithSize(rtype, len(pairs))
+
+	for _, pair := range pairs {
+		val := reflect.New(rtype.Elem()).Elem()
+
+		if pair.val == nil {
+			if rtype.Elem().Kind() != reflect.Ptr {
+				return ErrNull.because(fmt.Errorf(
+					`can't decode null value of hstore key %q into %q`, pair.key, rtype,
+				))
+			}
+		} else if rtype.Elem().Kind() == reflect.Ptr {
+			val.Set(reflect.New(rtype.Elem().Elem()))
+			val.Elem().SetString(*pair.val)
+		} else {
+			val.SetString(*pair.val)
+		}
+
+		out.SetMapIndex(reflect.ValueOf(pair.key).Convert(rtype.Key()), val)
+	}
+
+	dest.Set(out)
+	return nil
+}
+
+/*
+Converts a map whose type satisfies `isRtypeHstore`, or a pointer to one, into
+the text format of `hstore`, with keys in sorted order. Nil maps become nulls.
+Used by `Hstore.Value`.
+*/
+func convertHstore(src interface{}) (interface{}, error) {
+	rval := reflect.ValueOf(src)
+	if refut.IsRvalNil(rval) {
+		return nil, nil
+	}
+	rval = refut.RvalDeref(rval)
+	if rval.IsNil() {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, rval.Len())
+	for _, key := range rval.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteString(`, `)
+		}
+		appendHstoreStr(&buf, key)
+		buf.WriteString(`=>`)
+
+		val := rval.MapIndex(reflect.ValueOf(key).Convert(rval.Type().Key()))
+		if val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				buf.WriteString(`NULL`)
+				continue
+			}
+			val = val.Elem()
+		}
+		appendHstoreStr(&buf, val.String())
+	}
+	return buf.String(), nil
+}
+
+/*
+True for maps, or pointers to them, with string keys and string or string
+pointer values, that don't implement `sql.Scanner`.
+*/
+func isRtypeHstore(rtype reflect.Type) bool {
+	rtype = refut.RtypeDeref(rtype)
+	if rtype == nil || rtype.Kind() != reflect.Map || isRtypeScannable(rtype) {
+		return false
+	}
+
+	elem := rtype.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return rtype.Key().Kind() == reflect.String && elem.Kind() == reflect.String
+}
+
+/* Internal */
+
+type tHstorePair struct {
+	key string
+	val *string // Nil for null.
+}
+
+/*
+Parses the text format of `hstore`. Keys and values may be quoted, with
+backslashes escaping the next character. An unquoted `NULL` value is null.
+*/
+func parseHstore(src string) ([]tHstorePair, error) {
+	var out []tHstorePair
+	rest := strings.TrimSpace(src)
+
+	for rest != `` {
+		key, quoted, tail, err := parseHstoreToken(rest)
+		if err != nil {
+			return nil, fmt.Errorf(`malformed hstore %q: %w`, src, err)
+		}
+		if !quoted && strings.EqualFold(key, `NULL`) {
+			return nil, fmt.Errorf(`malformed hstore %q: null key`, src)
+		}
+
+		tail = strings.TrimSpace(tail)
+		if !strings.HasPrefix(tail, `=>`) {
+			return nil, fmt.Errorf(`malformed hstore %q: expected "=>" after key %q`, src, key)
+		}
+
+		val, quoted, tail, err := parseHstoreToken(strings.TrimSpace(tail[len(`=>`):]))
+		if err != nil {
+			return nil, fmt.Errorf(`malformed hstore %q: %w`, src, err)
+		}
+
+		pair := tHstorePair{key: key}
+		if quoted || !strings.EqualFold(val, `NULL`) {
+			pair.val = &val
+		}
+		out = append(out, pair)
+
+		rest = strings.TrimSpace(tail)
+		if rest == `` {
+			break
+		}
+		if rest[0] != ',' {
+			return nil, fmt.Errorf(`malformed hstore %q: expected "," after value of key %q`, src, key)
+		}
+		rest = strings.TrimSpace(rest[1:])
+	}
+
+	return out, nil
+}
+
+// Returns the token, whether it was quoted, and the remaining input.
+func parseHstoreToken(src string) (string, bool, string, error) {
+	if src == `` {
+		return ``, false, ``, fmt.Errorf(`unexpected end of input`)
+	}
+
+	var buf strings.Builder
+
+	if src[0] != '"' {
+		for i := 0; i < len(src); i++ {
+			char := src[i]
+			if char == ',' || char == '=' || char == ' ' {
+				return buf.String(), false, src[i:], nil
+			}
+			if char == '\\' && i+1 < len(src) {
+				i++
+				char = src[i]
+			}
+			buf.WriteByte(char)
+		}
+		return buf.String(), false, ``, nil
+	}
+
+	for i := 1; i < len(src); i++ {
+		char := src[i]
+		if char == '"' {
+			return buf.String(), true, src[i+1:], nil
+		}
+		if char == '\\' && i+1 < len(src) {
+			i++
+			char = src[i]
+		}
+		buf.WriteByte(char)
+	}
+	return ``, false, ``, fmt.Errorf(`unterminated quote`)
+}
+
+func appendHstoreStr(buf *strings.Builder, val string) {
+	buf.WriteByte('"')
+	for i := 0; i < len(val); i++ {
+		char := val[i]
+		if char == '"' || char == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(char)
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,224 @@
+package gos
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Postgres `interval`, with the same components as stored by Postgres. Unlike
+`time.Duration`, can represent months and days, whose length varies. Implements
+`sql.Scanner`, decoding the default "postgres" output style, such as
+"1 year 2 mons 3 days 04:05:06.5", and `driver.Valuer`, for use as a query
+argument. See also the decoding of `time.Duration` in the package docs.
+*/
+type Interval struct {
+	Months       int32
+	Days         int32
+	Microseconds int64
+}
+
+// Implement `sql.Scanner`. Nulls produce a zero value.
+func (self *Interval) Scan(src interface{}) error {
+	var str string
+	switch src := src.(type) {
+	case nil:
+		*self = Interval{}
+		return nil
+	case []byte:
+		str = string(src)
+	case string:
+		str = src
+	default:
+		return fmt.Errorf(`can't decode %T into %T`, src, self)
+	}
+
+	val, err := parseInterval(str)
+	if err != nil {
+		return err
+	}
+	*self = val
+	return nil
+}
+
+// Implement `driver.Valuer`.
+func (self Interval) Value() (driver.Value, error) {
+	return fmt.Sprintf(`%d months %d days %d microseconds`, self.Months, self.Days, self.Microseconds), nil
+}
+
+/*
+Converts to `time.Duration`, counting days as 24 hours. Fails for intervals with
+months, whose length is ambiguous, and for those exceeding the range of
+`time.Duration`.
+*/
+func (self Interval) Duration() (time.Duration, error) {
+	if self.Months != 0 {
+		return 0, fmt.Errorf(`can't convert interval with %d months into time.Duration`, self.Months)
+	}
+
+	const usPerDay = int64(24 * time.Hour / time.Microsecond)
+	const maxUs = math.MaxInt64 / int64(time.Microsecond)
+
+	us := int64(self.Days)*usPerDay + self.Microseconds
+	if us > maxUs || us < -maxUs {
+		return 0, fmt.Errorf(`interval %v exceeds the range of time.Duration`, self)
+	}
+	return time.Duration(us) * time.Microsecond, nil
+}
+
+/*
+Decodes a Postgres `interval` column into `time.Duration`, see
+`Interval.Duration`. Integers, including numeric strings, are accepted as
+nanoseconds, as usual. Used as a `DecodeFunc` for fields of type
+`time.Duration` and pointers to it, and for scalar destinations of such types.
+Pointers are allocated as needed, and nil pointers accept nulls.
+*/
+func decodeDuration(src interface{}, dest reflect.Value) error {
+	if dest.Kind() == reflect.Ptr {
+		if src == nil {
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		return decodeDuration(src, dest.Elem())
+	}
+
+	if src == nil {
+		return ErrNull.because(fmt.Errorf(`can't decode null into non-nilable %q`, dest.Type()))
+	}
+
+	var str string
+	switch src := src.(type) {
+	case int64:
+		dest.SetInt(src)
+		return nil
+	case []byte:
+		str = string(src)
+	case string:
+		str = src
+	default:
+		return fmt.Errorf(`can't decode %T into %q`, src, dest.Type())
+	}
+
+	num, err := strconv.ParseInt(str, 10, 64)
+	if err == nil {
+		dest.SetInt(num)
+		return nil
+	}
+
+	interval, err := parseInterval(str)
+	if err != nil {
+		return err
+	}
+
+	val, err := interval.Duration()
+	if err != nil {
+		return err
+	}
+	dest.SetInt(int64(val))
+	return nil
+}
+
+// True for `time.Duration` and pointers to it.
+func isRtypeDuration(rtype reflect.Type) bool {
+	return refut.RtypeDeref(rtype) == durationRtype
+}
+
+/* Internal */
+
+var durationRtype = reflect.TypeOf(time.Duration(0))
+
+/*
+Parses the "postgres" output style of `interval`: optional pairs of numbers and
+units, such as "1 year 2 mons 3 days", followed by an optional time of day, such
+as "-04:05:06.5". Each component may have its own sign.
+*/
+func parseInterval(src string) (Interval, error) {
+	var out Interval
+	fields := strings.Fields(src)
+
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+
+		if strings.Contains(field, `:`) {
+			us, err := parseIntervalTime(field)
+			if err != nil {
+				return out, fmt.Errorf(`malformed interval %q: %w`, src, err)
+			}
+			out.Microseconds += us
+			continue
+		}
+
+		num, err := strconv.ParseInt(field, 10, 32)
+		if err != nil || i+1 >= len(fields) {
+			return out, fmt.Errorf(`malformed interval %q`, src)
+		}
+		i++
+
+		switch strings.TrimSuffix(fields[i], `s`) {
+		case `year`:
+			out.Months += int32(num) * 12
+		case `mon`:
+			out.Months += int32(num)
+		case `day`:
+			out.Days += int32(num)
+		default:
+			return out, fmt.Errorf(`malformed interval %q: unknown unit %q`, src, fields[i])
+		}
+	}
+
+	return out, nil
+}
+
+// Parses "[-+]HH:MM:SS[.ffffff]" into microseconds.
+func parseIntervalTime(src string) (int64, error) {
+	sign := int64(1)
+	if strings.HasPrefix(src, `-`) {
+		sign = -1
+		src = src[1:]
+	} else {
+		src = strings.TrimPrefix(src, `+`)
+	}
+
+	parts := strings.Split(src, `:`)
+	if len(parts) != 3 {
+		return 0, fmt.Errorf(`malformed time %q`, src)
+	}
+
+	hours, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	mins, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	secs, frac, _ := strings.Cut(parts[2], `.`)
+	wholeSecs, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	var us int64
+	if frac != `` {
+		if len(frac) > 6 {
+			frac = frac[:6]
+		}
+		us, err = strconv.ParseInt(frac+strings.Repeat(`0`, 6-len(frac)), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return sign * (((hours*60+mins)*60+wholeSecs)*1_000_000 + us), nil
+}
@@ -0,0 +1,53 @@
+//go:build go1.23
+
+package gos
+
+import (
+	"context"
+	"iter"
+)
+
+/*
+Variant of `QueryTypedScanner` for range-over-func loops, which closes the
+scanner automatically when the loop exits, including via `break` or `return`:
+
+	for person, err := range gos.QueryIter[Person](ctx, conn, `select * from persons`, nil) {
+		if err != nil {
+			return err
+		}
+		// Process `person`.
+	}
+
+The query is executed when the loop starts, and again for each loop over the
+same sequence. Query and iteration errors are yielded with zero values, after
+which the loop ends. Decoding errors are yielded for the corresponding rows,
+and the loop continues unless the caller breaks out of it. Requires Go 1.23.
+*/
+func QueryIter[T any](ctx context.Context, conn Queryer, query string, args []interface{}) iter.Seq2[T, error] {
+	return QueryIterConf[T](ctx, conn, Conf{}, query, args)
+}
+
+// Variant of `QueryIter` that uses the given configuration.
+func QueryIterConf[T any](ctx context.Context, conn Queryer, conf Conf, query string, args []interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		scan, err := QueryTypedScannerConf[T](ctx, conn, conf, query, args)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer scan.Close()
+
+		for scan.Next() {
+			if !yield(scan.Scan()) {
+				return
+			}
+		}
+
+		err = scan.Err()
+		if err != nil {
+			yield(zero, Err{While: `iterating rows`, Cause: err})
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build go1.23
+
+package gos
+
+import (
+	"testing"
+)
+
+func TestQueryIter(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	var vals []int
+	for val, err := range QueryIter[int](ctx, conn, `select generate_series(1, 5)`, nil) {
+		try(t, err)
+		vals = append(vals, val)
+		if val == 3 {
+			break
+		}
+	}
+	eq(t, []int{1, 2, 3}, vals)
+
+	for _, err := range QueryIter[int](ctx, conn, `select invalid_column`, nil) {
+		if err == nil {
+			t.Fatalf(`expected a query error`)
+		}
+	}
+}
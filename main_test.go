@@ -3,12 +3,18 @@ package gos
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"math/big"
 	"os"
 	"os/user"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 	"unsafe"
@@ -734,21 +740,3220 @@ func TestQuery_write_to_existing_pointer(t *testing.T) {
 	eq(t, `val`, target)
 }
 
+func TestQueryMasked(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Nested struct {
+		One string `db:"one"`
+		Two string `db:"two"`
+	}
+	type Nesting struct {
+		Val    string  `db:"val"`
+		Other  string  `db:"other"`
+		Nested *Nested `db:"nested"`
+	}
+
+	var result Nesting
+	query := `select 'val' as val, 'other' as other, nested from (select 'one' as one, 'two' as two) as nested`
+	try(t, QueryMasked(ctx, conn, &result, query, nil, []string{`val`, `nested.two`}))
+
+	expected := Nesting{Val: "val", Nested: &Nested{Two: "two"}}
+	eq(t, expected, result)
+
+	for _, mask := range [][]string{{`missing`}, {`val.nested`}} {
+		err := QueryMasked(ctx, conn, &result, query, nil, mask)
+		if !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf(`expected ErrInvalidInput for mask %q, got %+v`, mask, err)
+		}
+	}
+
+	ClearCaches()
+	try(t, QueryMasked(ctx, conn, &result, query, nil, []string{`other`}))
+	try(t, QueryMasked(ctx, conn, &result, query, nil, []string{`nested.one`}))
+	eq(t, CacheStats{Types: 1, Entries: 1}, GetCacheStats())
+}
+
+func TestQueryJson(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Nested struct {
+		Val string `json:"val"`
+	}
+	type Nesting struct {
+		Val    string  `json:"val"`
+		Nested *Nested `json:"nested"`
+	}
+
+	{
+		var result Nesting
+		query := `select 'one' as val, (select nested from (select 'two' as val) as nested) as nested`
+		try(t, QueryJson(ctx, conn, &result, query, nil))
+
+		expected := Nesting{Val: "one", Nested: &Nested{Val: "two"}}
+		eq(t, expected, result)
+	}
+
+	{
+		var results []Nesting
+		query := `select * from (values ('one', null::jsonb), ('two', '{"val": "three"}')) as vals (val, nested)`
+		try(t, QueryJson(ctx, conn, &results, query, nil))
+
+		expected := []Nesting{{Val: "one"}, {Val: "two", Nested: &Nested{Val: "three"}}}
+		eq(t, expected, results)
+	}
+
+	{
+		var result Nesting
+		query := `select * from (values ('one'), ('two')) as vals (val)`
+		err := QueryJson(ctx, conn, &result, query, nil)
+		if !errors.Is(err, ErrMultipleRows) {
+			t.Fatalf(`expected error ErrMultipleRows, got %+v`, err)
+		}
+	}
+}
+
+func TestQueryJsonCol(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Nested struct {
+		Val string `db:"val" json:"val"`
+	}
+	type Nesting struct {
+		Val    string  `db:"val"    json:"val"`
+		Nested *Nested `db:"nested" json:"nested"`
+	}
+
+	var results []Nesting
+	query := fmt.Sprintf(`
+	select %v from (
+		select 'one' as val, nested from (select 'two' as val) as nested
+	) as _
+	`, ColsJson(results))
+	try(t, QueryJsonCol(ctx, conn, &results, query, nil))
+
+	expected := []Nesting{{Val: "one", Nested: &Nested{Val: "two"}}}
+	eq(t, expected, results)
+}
+
+func TestColsJson(t *testing.T) {
+	type Nested struct {
+		Val  string `db:"val"  json:"value"`
+		Skip string `db:"skip" json:"-"`
+	}
+
+	type Nesting struct {
+		Val    string  `db:"val"`
+		Nested *Nested `db:"nested"`
+		Other  string
+	}
+
+	actual := ColsJson(Nesting{})
+	expected := `jsonb_build_object('Val', "val", 'Nested', case when ("nested") is null then null else jsonb_build_object('value', ("nested")."val") end)`
+	eq(t, expected, actual)
+}
+
 func TestCols(t *testing.T) {
 	type Nested struct {
 		Val *string `db:"val"`
 	}
 
-	type Nesting struct {
-		Val    string  `db:"val"`
-		Nested *Nested `db:"nested"`
+	type Nesting struct {
+		Val    string  `db:"val"`
+		Nested *Nested `db:"nested"`
+	}
+
+	actual := sqlb.Cols(Nesting{})
+	expected := `"val", ("nested")."val" as "nested.val"`
+	if expected != actual {
+		t.Fatalf(`expected Cols() to produce %q, got %q`, expected, actual)
+	}
+}
+
+func TestCols_matches_sqlb(t *testing.T) {
+	type Embedded struct {
+		Emb string `db:"emb"`
+	}
+
+	type Nested struct {
+		Val  *string   `db:"val"`
+		Time time.Time `db:"time"`
+	}
+
+	type Nesting struct {
+		Embedded
+		Val    string  `db:"val"`
+		Nested *Nested `db:"nested"`
+		Deep   struct {
+			Nested Nested `db:"nested"`
+		} `db:"deep"`
+		Ignored string
+	}
+
+	eq(t, sqlb.Cols(Nesting{}), Cols(Nesting{}))
+	eq(t, sqlb.Cols([]*Nesting(nil)), Cols([]*Nesting(nil)))
+}
+
+func TestColsPrefixed(t *testing.T) {
+	type Nested struct {
+		Val *string `db:"val"`
+	}
+
+	type Nesting struct {
+		Val    string  `db:"val"`
+		Nested *Nested `db:"nested"`
+	}
+
+	eq(t, `t."val", (t."nested")."val" as "nested.val"`, ColsPrefixed(Nesting{}, `t`))
+	eq(t, Cols(Nesting{}), ColsPrefixed(Nesting{}, ``))
+}
+
+func TestCols_mask(t *testing.T) {
+	type Nested struct {
+		One string `db:"one"`
+		Two string `db:"two"`
+	}
+
+	type Nesting struct {
+		Val    string  `db:"val"`
+		Other  string  `db:"other"`
+		Nested *Nested `db:"nested"`
+	}
+
+	eq(t, `"val"`, Cols(Nesting{}, `val`))
+	eq(t, `"val"`, Cols(Nesting{}, `Val`))
+	eq(t, `"other", ("nested")."two" as "nested.two"`, Cols(Nesting{}, `Nested.two`, `other`))
+	eq(t, `("nested")."one" as "nested.one", ("nested")."two" as "nested.two"`, Cols(Nesting{}, `nested`))
+	eq(t, `t."val"`, ColsPrefixed(Nesting{}, `t`, `val`))
+
+	testPanic := func(mask string) {
+		defer func() {
+			err, _ := recover().(error)
+			if !errors.Is(err, ErrInvalidInput) {
+				t.Fatalf(`expected mask %q to panic with ErrInvalidInput, got %+v`, mask, err)
+			}
+		}()
+		Cols(Nesting{}, mask)
+	}
+
+	testPanic(`missing`)
+	testPanic(`val.one`)
+	testPanic(`nested.missing`)
+}
+
+func TestColsShallow(t *testing.T) {
+	type Inner struct {
+		Val string `db:"val"`
+	}
+
+	type Nested struct {
+		Val   string `db:"val"`
+		Inner *Inner `db:"inner"`
+	}
+
+	type Nesting struct {
+		Val      string  `db:"val"`
+		Nested   Nested  `db:"nested"`
+		Nilable  *Nested `db:"nilable"`
+		Included *Inner  `db:"included"`
+	}
+
+	eq(t, `"val", ("nested")."val" as "nested.val"`, ColsShallow(Nesting{}))
+
+	eq(
+		t,
+		`"val", ("nested")."val" as "nested.val", ("nested")."inner"."val" as "nested.inner.val", ("included")."val" as "included.val"`,
+		ColsShallow(Nesting{}, `nested.inner`, `Included`),
+	)
+
+	eq(t, Cols(Nesting{}, `val`, `nested`, `nilable`), ColsShallow(Nesting{}, `nested.inner`, `nilable`))
+}
+
+func TestCols_cached(t *testing.T) {
+	type Nested struct {
+		Val string `db:"val"`
+	}
+
+	type Nesting struct {
+		Val    string  `db:"val"`
+		Nested *Nested `db:"nested"`
+	}
+
+	expected := `"val", ("nested")."val" as "nested.val"`
+	for i := 0; i < 3; i++ {
+		eq(t, expected, Cols(Nesting{}))
+		eq(t, expected, Cols([]*Nesting(nil)))
+	}
+
+	key := tColsKey{kind: colsKindSelect, rtype: reflect.TypeOf(Nesting{})}
+	val, ok := cache.get(key.rtype, key)
+	if !ok {
+		t.Fatalf(`expected Cols output to be cached`)
+	}
+	eq(t, expected, val)
+}
+
+func TestColsComposite(t *testing.T) {
+	type Nested struct {
+		Val string `db:"val"`
+	}
+
+	type Nesting struct {
+		Id     string  `db:"id,readonly"`
+		Val    string  `db:"val"`
+		Nested *Nested `db:"nested"`
+	}
+
+	eq(t, `"id", "val", "nested"`, ColsComposite(Nesting{}))
+}
+
+func TestQueryJson_composite(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Nested struct {
+		Val string `db:"val" json:"val"`
+	}
+	type Nesting struct {
+		Val    string  `db:"val"    json:"val"`
+		Nested *Nested `db:"nested" json:"nested"`
+	}
+
+	var result Nesting
+	query := fmt.Sprintf(`
+	select %v from (
+		select 'one' as val, nested from (select 'two' as val) as nested
+	) as _
+	`, ColsComposite(result))
+	try(t, QueryJson(ctx, conn, &result, query, nil))
+
+	expected := Nesting{Val: "one", Nested: &Nested{Val: "two"}}
+	eq(t, expected, result)
+}
+
+func TestColsInsert(t *testing.T) {
+	type Embedded struct {
+		Created time.Time `db:"created,readonly"`
+		Updated time.Time `db:"updated"`
+	}
+
+	type Nested struct {
+		Val string `db:"val"`
+	}
+
+	type Person struct {
+		Id     string `db:"id,readonly"`
+		Name   string `db:"name"`
+		Nested Nested `db:"nested"`
+		Embedded
+		Ignored string
+	}
+
+	eq(t, `"name", "nested", "updated"`, ColsInsert(Person{}))
+	eq(t, `"name", "nested", "updated"`, ColsInsert([]*Person(nil)))
+}
+
+func TestColsAssign(t *testing.T) {
+	type Embedded struct {
+		Updated string `db:"updated"`
+	}
+
+	type Person struct {
+		Id   string `db:"id,readonly"`
+		Name string `db:"name"`
+		*Embedded
+		Ignored string
+	}
+
+	eq(t, `"name" = $1, "updated" = $2`, ColsAssign(Person{}, 0))
+	eq(t, `"name" = $3, "updated" = $4`, ColsAssign(Person{}, 2))
+
+	eq(t, []interface{}{"one", nil}, StructArgs(Person{Id: "id", Name: "one"}))
+	eq(t, []interface{}{"one", "two"}, StructArgs(&Person{Name: "one", Embedded: &Embedded{"two"}}))
+	eq(t, []interface{}(nil), StructArgs((*Person)(nil)))
+}
+
+func TestStructArgs_update(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Person struct {
+		Id   int64  `db:"id,readonly"`
+		Name string `db:"name"`
+		Age  int64  `db:"age"`
+	}
+
+	_, err := conn.ExecContext(ctx, `create temporary table persons (id int8, name text, age int8)`)
+	try(t, err)
+	_, err = conn.ExecContext(ctx, `insert into persons (id, name, age) values (10, 'one', 20)`)
+	try(t, err)
+
+	person := Person{Id: 10, Name: "two", Age: 30}
+	query := fmt.Sprintf(`update persons set %v where id = $1`, ColsAssign(person, 1))
+	args := append([]interface{}{person.Id}, StructArgs(person)...)
+	try(t, Query(ctx, conn, nil, query, args))
+
+	var result Person
+	try(t, Query(ctx, conn, &result, fmt.Sprintf(`select %v from persons`, Cols(result)), nil))
+	eq(t, person, result)
+}
+
+func TestClearCaches(t *testing.T) {
+	type Nested struct {
+		Val string `db:"val"`
+	}
+
+	type Nesting struct {
+		Val    string  `db:"val"`
+		Nested *Nested `db:"nested"`
+	}
+
+	ClearCaches()
+	eq(t, CacheStats{}, GetCacheStats())
+
+	Cols(Nesting{})
+	ColsJson(Nesting{})
+	Cols(Nested{})
+	eq(t, CacheStats{Types: 2, Entries: 5}, GetCacheStats())
+
+	ClearCachesFor([]*Nesting(nil))
+	eq(t, CacheStats{Types: 1, Entries: 2}, GetCacheStats())
+
+	ClearCaches()
+	eq(t, CacheStats{}, GetCacheStats())
+}
+
+func TestQuery_cached_spec(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		One string `db:"one"`
+		Two string `db:"two"`
+	}
+
+	ClearCaches()
+
+	var result Result
+	try(t, Query(ctx, conn, &result, `select 'one' as one`, nil))
+	eq(t, Result{One: "one"}, result)
+	eq(t, CacheStats{Types: 1, Entries: 1}, GetCacheStats())
+
+	result = Result{}
+	try(t, Query(ctx, conn, &result, `select 'one' as one`, nil))
+	eq(t, Result{One: "one"}, result)
+	eq(t, CacheStats{Types: 1, Entries: 1}, GetCacheStats())
+
+	result = Result{}
+	try(t, Query(ctx, conn, &result, `select 'two' as two`, nil))
+	eq(t, Result{Two: "two"}, result)
+	eq(t, CacheStats{Types: 1, Entries: 2}, GetCacheStats())
+}
+
+func TestRegister(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		One string `db:"one"`
+		Two string `db:"two"`
+	}
+
+	ClearCaches()
+	Register(Result{})
+	stats := GetCacheStats()
+	if stats.Entries == 0 {
+		t.Fatalf(`expected Register to populate caches, got %+v`, stats)
+	}
+
+	var result []Result
+	try(t, Query(ctx, conn, &result, `select `+Cols(Result{})+` from (select 'one' as one, 'two' as two) as _`, nil))
+	eq(t, []Result{{One: `one`, Two: `two`}}, result)
+	eq(t, stats, GetCacheStats())
+
+	type Invalid struct {
+		Tags []string `db:"tags"`
+	}
+
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrInvalidDest) {
+			t.Fatalf(`expected Register to panic with ErrInvalidDest, got %+v`, err)
+		}
+	}()
+	Register(Invalid{})
+}
+
+func TestConf_NoCache(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		One string `db:"one"`
+	}
+
+	ClearCaches()
+
+	var result Result
+	try(t, Conf{NoCache: true}.Query(ctx, conn, &result, `select 'one' as one`, nil))
+	eq(t, Result{One: "one"}, result)
+	eq(t, CacheStats{}, GetCacheStats())
+
+	try(t, Conf{}.Query(ctx, conn, &result, `select 'one' as one`, nil))
+	eq(t, CacheStats{Types: 1, Entries: 1}, GetCacheStats())
+}
+
+type MappedPerson struct {
+	Id   int64
+	Name string
+}
+
+func TestRegisterMapper(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	RegisterMapper([]string{`id`, `name`}, func(src []interface{}, dest *MappedPerson) error {
+		dest.Id, _ = src[0].(int64)
+		dest.Name, _ = src[1].(string)
+		return nil
+	})
+
+	var results []MappedPerson
+	query := `select * from (values ('one', 10), ('two', 20)) as vals (name, id)`
+	try(t, Query(ctx, conn, &results, query, nil))
+	eq(t, []MappedPerson{{10, "one"}, {20, "two"}}, results)
+
+	var result MappedPerson
+	try(t, Query(ctx, conn, &result, `select 'three' as name`, nil))
+	eq(t, MappedPerson{Name: "three"}, result)
+
+	// Buffers are reused between rows; missing columns stay nil.
+	query = `select * from (values ('one'), ('two'), (null)) as vals (name)`
+	try(t, Query(ctx, conn, &results, query, nil))
+	eq(t, []MappedPerson{{0, "one"}, {0, "two"}, {0, ""}}, results)
+
+	err := Query(ctx, conn, &result, `select 'three' as missing`, nil)
+	if !errors.Is(err, ErrNoColDest) {
+		t.Fatalf(`expected error ErrNoColDest, got %+v`, err)
+	}
+}
+
+type ScannedPair struct {
+	Cols []string
+	Vals []interface{}
+}
+
+func (self *ScannedPair) ScanRow(cols []string, vals []interface{}) error {
+	if len(cols) != 2 {
+		return fmt.Errorf(`expected 2 columns, got %v`, cols)
+	}
+	self.Cols = cols
+	self.Vals = vals
+	return nil
+}
+
+func TestQuery_RowScanner(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	var results []ScannedPair
+	try(t, Query(ctx, conn, &results, `select * from (values ('one', 10), ('two', null)) as vals (key, val)`, nil))
+	eq(t, []ScannedPair{
+		{[]string{"key", "val"}, []interface{}{"one", int64(10)}},
+		{[]string{"key", "val"}, []interface{}{"two", nil}},
+	}, results)
+
+	var result *ScannedPair
+	try(t, Query(ctx, conn, &result, `select 'one' as key, 10 as val`, nil))
+	eq(t, &ScannedPair{[]string{"key", "val"}, []interface{}{"one", int64(10)}}, result)
+
+	err := Query(ctx, conn, &result, `select 'one' as key`, nil)
+	if !errors.Is(err, ErrScan) {
+		t.Fatalf(`expected error ErrScan, got %+v`, err)
+	}
+}
+
+type DefaultedPerson struct {
+	Id     int64  `db:"id"`
+	Name   string `db:"name"`
+	Source string `db:"-"`
+}
+
+func (self *DefaultedPerson) BeforeScan() error {
+	self.Source = `db`
+	self.Name = `unnamed`
+	return nil
+}
+
+func TestQuery_BeforeScan(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	var results []*DefaultedPerson
+	try(t, Query(ctx, conn, &results, `select * from (values (10, 'one'), (20, 'two')) as vals (id, name)`, nil))
+	eq(t, []*DefaultedPerson{{10, "one", "db"}, {20, "two", "db"}}, results)
+
+	var result DefaultedPerson
+	try(t, Query(ctx, conn, &result, `select 10 as id`, nil))
+	eq(t, DefaultedPerson{10, "unnamed", "db"}, result)
+}
+
+type VariantEvent interface{ EventKind() string }
+
+type VariantCreated struct {
+	Id   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func (VariantCreated) EventKind() string { return `created` }
+
+type VariantDeleted struct {
+	Id     int64   `db:"id"`
+	Reason *string `db:"reason"`
+}
+
+func (*VariantDeleted) EventKind() string { return `deleted` }
+
+func TestRegisterVariants(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	RegisterVariants[VariantEvent](`kind`, map[string]interface{}{
+		`created`: VariantCreated{},
+		`deleted`: &VariantDeleted{},
+	})
+
+	reason := "expired"
+	query := `
+		select * from (values
+			(10, 'created', 'one', null),
+			(20, 'deleted', null, 'expired')
+		) as vals (id, kind, name, reason)
+	`
+
+	var results []VariantEvent
+	try(t, Query(ctx, conn, &results, query, nil))
+	eq(t, []VariantEvent{VariantCreated{10, "one"}, &VariantDeleted{20, &reason}}, results)
+	try(t, ValidateDest(&results))
+
+	var result VariantEvent
+	err := Query(ctx, conn, &result, `select 10 as id, 'unknown' as kind`, nil)
+	if !errors.Is(err, ErrScan) {
+		t.Fatalf(`expected error ErrScan, got %+v`, err)
+	}
+
+	err = Query(ctx, conn, &result, `select 10 as id`, nil)
+	if !errors.Is(err, ErrMissingCol) {
+		t.Fatalf(`expected error ErrMissingCol, got %+v`, err)
+	}
+}
+
+func TestSetColumnNamer(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		One   string
+		Two   string `db:"two_"`
+		Three string `db:"-"`
+	}
+
+	SetColumnNamer(strings.ToLower)
+	defer SetColumnNamer(nil)
+
+	eq(t, `"one", "two_"`, Cols(Result{}))
+	eq(t, []interface{}{"one", "two"}, StructArgs(Result{"one", "two", "three"}))
+
+	var result Result
+	try(t, Query(ctx, conn, &result, `select 'one' as one, 'two' as two_`, nil))
+	eq(t, Result{One: "one", Two: "two"}, result)
+
+	SetColumnNamer(nil)
+	eq(t, `"two_"`, Cols(Result{}))
+}
+
+func TestSnakeCase(t *testing.T) {
+	for _, pair := range [][2]string{
+		{`Id`, `id`},
+		{`ID`, `id`},
+		{`UserID`, `user_id`},
+		{`UserIDs`, `user_ids`},
+		{`HTTPServer`, `http_server`},
+		{`CreatedAt`, `created_at`},
+		{`Field2Name`, `field2_name`},
+	} {
+		eq(t, pair[1], SnakeCase(pair[0]))
+	}
+
+	type Result struct {
+		UserID    int64
+		CreatedAt string
+		Skipped   string `db:"-"`
+		Explicit  string `db:"other"`
+	}
+
+	SetColumnNamer(SnakeCase)
+	defer SetColumnNamer(nil)
+
+	eq(t, `"user_id", "created_at", "other"`, Cols(Result{}))
+}
+
+func TestSetJsonTagFallback(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		One   string `json:"one,omitempty"`
+		Two   string `json:"two" db:"two_"`
+		Three string `json:"-"`
+		Four  string `json:"four" db:"-"`
+	}
+
+	SetJsonTagFallback(true)
+	defer SetJsonTagFallback(false)
+
+	eq(t, `"one", "two_"`, Cols(Result{}))
+
+	var result Result
+	try(t, Query(ctx, conn, &result, `select 'one' as one, 'two' as two_`, nil))
+	eq(t, Result{One: "one", Two: "two"}, result)
+
+	SetJsonTagFallback(false)
+	eq(t, `"two_"`, Cols(Result{}))
+}
+
+func TestSetAliasSeparator(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Inner struct {
+		Two string `db:"two"`
+	}
+
+	type Result struct {
+		One   string `db:"one"`
+		Inner Inner  `db:"inner"`
+	}
+
+	SetAliasSeparator(`__`)
+	defer SetAliasSeparator(``)
+
+	eq(t, `"one", ("inner")."two" as "inner__two"`, Cols(Result{}))
+
+	var result Result
+	try(t, Query(ctx, conn, &result, `select 'one' as one, 'two' as inner__two`, nil))
+	eq(t, Result{`one`, Inner{`two`}}, result)
+
+	SetAliasSeparator(``)
+	eq(t, `"one", ("inner")."two" as "inner.two"`, Cols(Result{}))
+}
+
+func TestParseColumnTag(t *testing.T) {
+	eq(t, ColumnTag{}, ParseColumnTag(``))
+	eq(t, ColumnTag{}, ParseColumnTag(`-`))
+	eq(t, ColumnTag{Name: `id`}, ParseColumnTag(`id`))
+	eq(t, ColumnTag{Name: `id`, Opts: []string{`key`, `readonly`}}, ParseColumnTag(`id, key,,readonly`))
+	eq(t, ColumnTag{Opts: []string{`readonly`}}, ParseColumnTag(`,readonly`))
+	eq(t, true, ParseColumnTag(`id,key`).Has(`key`))
+	eq(t, false, ParseColumnTag(`key`).Has(`key`))
+
+	type Result struct {
+		Id   string `db:"id,key,pk"`
+		Name string `db:"name, readonly"`
+	}
+
+	testValidateDestErr(t, Result{}, ErrInvalidDest)
+
+	RegisterColumnOpt(`pk`)
+	try(t, ValidateDest(Result{}))
+	eq(t, `"id"`, ColsInsert(Result{}))
+}
+
+func TestRegisterFieldDecoder(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Event struct {
+		Time  time.Time `db:"time"`
+		Other string    `db:"other"`
+	}
+
+	RegisterFieldDecoder(Event{}, `Time`, decodeEpochString)
+
+	var results []Event
+	query := `select * from (values ('10', 'one'), (null, 'two')) as vals (time, other)`
+	try(t, Query(ctx, conn, &results, query, nil))
+	eq(t, []Event{{time.Unix(10, 0).UTC(), "one"}, {time.Time{}, "two"}}, results)
+}
+
+func TestRegisterColumnDecoder(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type EpochTime struct{ time.Time }
+
+	type Event struct {
+		Time EpochTime `db:"time"`
+	}
+
+	RegisterColumnDecoder(`text`, EpochTime{}, func(src interface{}, dest reflect.Value) error {
+		return decodeEpochString(src, dest.Field(0))
+	})
+
+	var result Event
+	try(t, Query(ctx, conn, &result, `select '10'::text as time`, nil))
+	eq(t, Event{EpochTime{time.Unix(10, 0).UTC()}}, result)
+
+	err := Query(ctx, conn, &result, `select 'blah'::text as time`, nil)
+	if !errors.Is(err, ErrScan) {
+		t.Fatalf(`expected error ErrScan, got %+v`, err)
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Point struct{ X, Y float64 }
+
+	type Result struct {
+		Id  string `db:"id"`
+		Loc Point  `db:"loc"`
+	}
+
+	RegisterDecoder(Point{}, func(src interface{}, dest reflect.Value) error {
+		str, _ := src.([]byte)
+		var point Point
+		_, err := fmt.Sscanf(string(str), `(%f,%f)`, &point.X, &point.Y)
+		dest.Set(reflect.ValueOf(point))
+		return err
+	})
+
+	eq(t, `"id", "loc"`, Cols(Result{}))
+	try(t, ValidateDest(Result{}))
+
+	var result Result
+	try(t, Query(ctx, conn, &result, `select 'one' as id, point(1.5, 2) as loc`, nil))
+	eq(t, Result{`one`, Point{1.5, 2}}, result)
+
+	var points []Point
+	try(t, Query(ctx, conn, &points, `select point(3, 4) union all select point(5, 6)`, nil))
+	eq(t, []Point{{3, 4}, {5, 6}}, points)
+}
+
+func TestRegisterArgConverter(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Tag struct{ Name string }
+
+	RegisterArgConverter(Tag{}, func(src interface{}) (interface{}, error) {
+		name := src.(Tag).Name
+		if name == "" {
+			return nil, errors.New(`empty tag`)
+		}
+		return name, nil
+	})
+
+	var result string
+	args := []interface{}{Tag{"one"}}
+	try(t, Query(ctx, conn, &result, `select $1::text`, args))
+	eq(t, "one", result)
+	eq(t, []interface{}{Tag{"one"}}, args)
+
+	err := Query(ctx, conn, &result, `select $1::text`, []interface{}{Tag{}})
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected error ErrInvalidInput, got %+v`, err)
+	}
+}
+
+func TestConvertArgs(t *testing.T) {
+	type Cents int64
+
+	RegisterArgConverter(Cents(0), func(src interface{}) (interface{}, error) {
+		if src.(Cents) < 0 {
+			return nil, fmt.Errorf(`negative amount`)
+		}
+		return fmt.Sprintf(`%d.%02d`, src.(Cents)/100, src.(Cents)%100), nil
+	})
+
+	args := []interface{}{`one`, int64(2)}
+	out, err := ConvertArgs(args)
+	try(t, err)
+	eq(t, args, out)
+
+	args = []interface{}{`one`, Cents(1234), RedactedArg{Cents(5)}, [2]byte{1, 2}}
+	out, err = ConvertArgs(args)
+	try(t, err)
+	eq(t, []interface{}{`one`, `12.34`, `0.05`, []byte{1, 2}}, out)
+	eq(t, Cents(1234), args[1])
+
+	_, err = ConvertArgs([]interface{}{Cents(-1)})
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected ErrInvalidInput, got %+v`, err)
+	}
+}
+
+func TestConvertArgs_reentrant(t *testing.T) {
+	type Lazy string
+	type Registered string
+
+	// A converter may register other converters without deadlocking.
+	RegisterArgConverter(Lazy(``), func(src interface{}) (interface{}, error) {
+		RegisterArgConverter(Registered(``), func(src interface{}) (interface{}, error) {
+			return string(src.(Registered)), nil
+		})
+		return string(src.(Lazy)), nil
+	})
+
+	out, err := ConvertArgs([]interface{}{Lazy(`one`), Registered(`two`)})
+	try(t, err)
+	eq(t, []interface{}{`one`, `two`}, out)
+}
+
+func TestCollect(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Group string `db:"group"`
+		Name  string `db:"name"`
+	}
+
+	query := `select * from (values ('a', 'one'), ('b', 'two'), ('a', 'three')) as vals ("group", name)`
+
+	scan := func() Scanner {
+		scan, err := QueryScanner(ctx, conn, query, nil)
+		try(t, err)
+		return scan
+	}
+
+	slice, err := CollectSlice[Result](scan())
+	try(t, err)
+	eq(t, []Result{{"a", "one"}, {"b", "two"}, {"a", "three"}}, slice)
+
+	nameScan, err := QueryScanner(ctx, conn, `select name from (`+query+`) as _`, nil)
+	try(t, err)
+	names, err := CollectSlice[string](nameScan)
+	try(t, err)
+	eq(t, []string{"one", "two", "three"}, names)
+
+	byName, err := CollectMap(scan(), func(val Result) string { return val.Name })
+	try(t, err)
+	eq(t, map[string]Result{"one": {"a", "one"}, "two": {"b", "two"}, "three": {"a", "three"}}, byName)
+
+	grouped, err := CollectGrouped(scan(), func(val Result) string { return val.Group })
+	try(t, err)
+	eq(t, map[string][]Result{"a": {{"a", "one"}, {"a", "three"}}, "b": {{"b", "two"}}}, grouped)
+}
+
+func TestScanChunk(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	scan, err := QueryScanner(ctx, conn, `select * from generate_series(1, 5)`, nil)
+	try(t, err)
+	defer scan.Close()
+
+	buf := make([]int, 2)
+
+	count, err := ScanChunk(scan, buf, 2)
+	try(t, err)
+	eq(t, 2, count)
+	eq(t, []int{1, 2}, buf)
+
+	count, err = ScanChunk(scan, buf, 10)
+	try(t, err)
+	eq(t, 2, count)
+	eq(t, []int{3, 4}, buf)
+
+	count, err = ScanChunk(scan, buf, 2)
+	try(t, err)
+	eq(t, 1, count)
+	eq(t, []int{5}, buf[:count])
+
+	count, err = ScanChunk(scan, buf, 2)
+	try(t, err)
+	eq(t, 0, count)
+}
+
+func TestQueryCursor(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	test := func(conn QueryExecer) {
+		t.Helper()
+
+		scan, err := Conf{FetchSize: 2}.QueryCursor(ctx, conn, `select * from generate_series(1, $1::int)`, []interface{}{5})
+		try(t, err)
+		defer scan.Close()
+
+		var results []int64
+		for scan.Next() {
+			var result int64
+			try(t, scan.Scan(&result))
+			results = append(results, result)
+		}
+		try(t, scan.Err())
+		try(t, scan.Close())
+
+		eq(t, []int64{1, 2, 3, 4, 5}, results)
+	}
+
+	test(conn)
+	test(testDb)
+}
+
+func TestCopyFrom(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Person struct {
+		Id   int64   `db:"id,readonly"`
+		Name string  `db:"name"`
+		Note *string `db:"note"`
+	}
+
+	try(t, Query(ctx, conn, nil, `create temp table copy_test (id serial, name text, note text)`, nil))
+
+	note := "two"
+	count, err := CopyFrom(ctx, conn, `copy_test`, []Person{{Name: "one"}, {Name: "two", Note: &note}})
+	try(t, err)
+	eq(t, int64(2), count)
+
+	src := make(chan Person, 1)
+	src <- Person{Name: "three"}
+	close(src)
+
+	count, err = CopyFromChan(ctx, conn, `copy_test`, src)
+	try(t, err)
+	eq(t, int64(1), count)
+
+	var results []Person
+	try(t, Query(ctx, conn, &results, `select * from copy_test order by id`, nil))
+	eq(t, []Person{{1, "one", nil}, {2, "two", &note}, {3, "three", nil}}, results)
+}
+
+func TestRetryTx(t *testing.T) {
+	ctx := context.Background()
+	conf := Conf{RetryDelay: time.Millisecond}
+
+	t.Run(`retry_serialization_failures`, func(t *testing.T) {
+		var attempts int
+		err := conf.RetryTx(ctx, testDb, nil, func(tx *sql.Tx) error {
+			attempts++
+			if attempts < 3 {
+				return Query(ctx, tx, nil, `do $$ begin raise exception 'conflict' using errcode = '40001'; end $$`, nil)
+			}
+			return nil
+		})
+		try(t, err)
+		eq(t, 3, attempts)
+	})
+
+	t.Run(`give_up_after_max_attempts`, func(t *testing.T) {
+		var attempts int
+		err := conf.RetryTx(ctx, testDb, nil, func(tx *sql.Tx) error {
+			attempts++
+			return Query(ctx, tx, nil, `do $$ begin raise exception 'deadlock' using errcode = '40P01'; end $$`, nil)
+		})
+		if !IsRetryable(err) {
+			t.Fatalf(`expected a retryable error, got %+v`, err)
+		}
+		eq(t, defaultRetryAttempts, attempts)
+	})
+
+	t.Run(`no_retry_on_other_errors`, func(t *testing.T) {
+		var attempts int
+		err := conf.RetryTx(ctx, testDb, nil, func(tx *sql.Tx) error {
+			attempts++
+			var val int64
+			return Query(ctx, tx, &val, `select 1 where false`, nil)
+		})
+		if !errors.Is(err, ErrNoRows) {
+			t.Fatalf(`expected ErrNoRows, got %+v`, err)
+		}
+		eq(t, 1, attempts)
+	})
+}
+
+// Error with a Postgres SQLSTATE code, see `IsRetryable`.
+type sqlStateErr string
+
+func (self sqlStateErr) Error() string    { return `SQLSTATE ` + string(self) }
+func (self sqlStateErr) SQLState() string { return string(self) }
+
+func TestRetry_maxDelay(t *testing.T) {
+	conf := Conf{RetryAttempts: 100, RetryDelay: time.Nanosecond, RetryMaxDelay: time.Microsecond}
+
+	var attempts int
+	start := time.Now()
+	err := conf.Retry(context.Background(), func() error {
+		attempts++
+		return sqlStateErr(`40001`)
+	})
+
+	eq(t, sqlStateErr(`40001`), err)
+	eq(t, 100, attempts)
+	if time.Since(start) > time.Second {
+		t.Fatalf(`expected delays to be limited by RetryMaxDelay, took %v`, time.Since(start))
+	}
+}
+
+func TestScanner_Scan_different_types(t *testing.T) {
+
+	ctx, conn := testInit(t)
+
+	type Summary struct {
+		Id int64 `db:"id"`
+	}
+
+	type Detail struct {
+		Id   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+
+	scan, err := Conf{IgnoreUnknownCols: true}.QueryScanner(ctx, conn, `select * from (values (1, 'one'), (2, 'two')) as vals (id, name)`, nil)
+	try(t, err)
+	defer scan.Close()
+
+	var summaries []Summary
+	var details []Detail
+
+	for scan.Next() {
+		var summary Summary
+		try(t, scan.Scan(&summary))
+		summaries = append(summaries, summary)
+
+		var detail Detail
+		try(t, scan.Scan(&detail))
+		details = append(details, detail)
+	}
+	try(t, scan.Err())
+
+	eq(t, []Summary{{1}, {2}}, summaries)
+	eq(t, []Detail{{1, "one"}, {2, "two"}}, details)
+}
+
+func TestPeekRow(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Group string `db:"grp"`
+		Val   int64  `db:"val"`
+	}
+
+	query := `select * from (values ('one', 10), ('one', 20), ('two', 30)) as vals (grp, val)`
+	scan, err := QueryScanner(ctx, conn, query, nil)
+	try(t, err)
+	defer scan.Close()
+
+	var first Result
+	try(t, PeekRow(scan, &first))
+	eq(t, Result{"one", 10}, first)
+
+	var groups [][]int64
+	var group []int64
+
+	for scan.Next() {
+		var result Result
+		try(t, scan.Scan(&result))
+		group = append(group, result.Val)
+
+		var next Result
+		err := PeekRow(scan, &next)
+		if err != nil && !errors.Is(err, ErrNoRows) {
+			t.Fatal(err)
+		}
+		if err != nil || next.Group != result.Group {
+			groups = append(groups, group)
+			group = nil
+		}
+	}
+	try(t, scan.Err())
+
+	eq(t, [][]int64{{10, 20}, {30}}, groups)
+}
+
+func TestScanSlice(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	scan, err := QueryScanner(ctx, conn, `select * from generate_series(1, 5)`, nil)
+	try(t, err)
+	defer scan.Close()
+
+	var buf []int
+
+	count, err := ScanSlice(scan, &buf, 3)
+	try(t, err)
+	eq(t, 3, count)
+	eq(t, []int{1, 2, 3}, buf)
+
+	count, err = ScanSlice(scan, &buf, 3)
+	try(t, err)
+	eq(t, 2, count)
+	eq(t, []int{4, 5}, buf)
+	eq(t, 3, cap(buf))
+
+	count, err = ScanSlice(scan, &buf, 3)
+	try(t, err)
+	eq(t, 0, count)
+	eq(t, []int{}, buf)
+
+	_, err = ScanSlice(scan, buf, 3)
+	if !errors.Is(err, ErrInvalidDest) {
+		t.Fatalf(`expected error ErrInvalidDest, got %+v`, err)
+	}
+}
+
+func TestRow(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	var row Row
+	try(t, Query(ctx, conn, &row, `select 'one' as two, 10 as one, null as three`, nil))
+
+	eq(t, 3, row.Len())
+	eq(t, []string{"two", "one", "three"}, row.Keys())
+	eq(t, []interface{}{"one", int64(10), nil}, row.Values())
+	eq(t, "one", row.Get("two"))
+	eq(t, int64(10), row.Get("one"))
+	eq(t, nil, row.Get("three"))
+
+	_, ok := row.Lookup("three")
+	eq(t, true, ok)
+	_, ok = row.Lookup("four")
+	eq(t, false, ok)
+
+	var rows []Row
+	try(t, Query(ctx, conn, &rows, `select * from (values (1, 'one'), (2, 'two')) as vals (id, name)`, nil))
+	eq(t, 2, len(rows))
+	eq(t, []string{"id", "name"}, rows[1].Keys())
+	eq(t, "two", rows[1].Get("name"))
+}
+
+func TestQuery_raw_rows(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	var row []interface{}
+	try(t, Query(ctx, conn, &row, `select 'one' as two, 10 as one, null as three`, nil))
+	eq(t, []interface{}{"one", int64(10), nil}, row)
+
+	var rows [][]interface{}
+	try(t, Query(ctx, conn, &rows, `select * from (values (1, 'one'), (2, 'two')) as vals (id, name)`, nil))
+	eq(t, [][]interface{}{{int64(1), "one"}, {int64(2), "two"}}, rows)
+
+	err := Query(ctx, conn, &row, `select * from (values (1), (2)) as vals (id)`, nil)
+	if !errors.Is(err, ErrMultipleRows) {
+		t.Fatalf(`expected error ErrMultipleRows, got %+v`, err)
+	}
+
+	try(t, ValidateDest(row))
+	try(t, ValidateDest(rows))
+}
+
+func TestQueryMap(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	query := `select * from (values (1, 'one'), (2, 'two')) as vals (id, name)`
+
+	names, err := QueryMap[int64, string](ctx, conn, query, nil)
+	try(t, err)
+	eq(t, map[int64]string{1: "one", 2: "two"}, names)
+
+	_, err = QueryMap[int64, string](ctx, conn, `select 1, 'one', 'two'`, nil)
+	if !errors.Is(err, ErrInvalidDest) {
+		t.Fatalf(`expected error ErrInvalidDest, got %+v`, err)
+	}
+
+	query = `select * from (values (1, 'one'), (1, 'two')) as vals (id, name)`
+
+	_, err = QueryMap[int64, string](ctx, conn, query, nil)
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf(`expected error ErrDuplicateKey, got %+v`, err)
+	}
+
+	names, err = QueryMapConf[int64, string](ctx, conn, Conf{AllowDuplicateKeys: true}, query, nil)
+	try(t, err)
+	eq(t, map[int64]string{1: "two"}, names)
+}
+
+func TestQueryScalarSet(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	set, err := QueryScalarSet[int64](ctx, conn, `select * from unnest(array[1, 2, 1, 3])`, nil)
+	try(t, err)
+	eq(t, map[int64]struct{}{1: {}, 2: {}, 3: {}}, set)
+
+	set, err = QueryScalarSet[int64](ctx, conn, `select 1 where false`, nil)
+	try(t, err)
+	eq(t, map[int64]struct{}{}, set)
+
+	_, err = QueryScalarSet[int64](ctx, conn, `select 1, 2`, nil)
+	if !errors.Is(err, ErrInvalidDest) {
+		t.Fatalf(`expected error ErrInvalidDest, got %+v`, err)
+	}
+}
+
+func TestQueryColumnar(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Ids    []int64   `db:"id"`
+		Names  []*string `db:"name"`
+		Unused []string  `db:"unused"`
+		Other  string
+	}
+
+	one := "one"
+	result := Result{Unused: []string{"unused"}}
+	query := `select * from (values (1, 'one'), (2, null)) as vals (id, name)`
+	try(t, QueryColumnar(ctx, conn, &result, query, nil))
+	eq(t, Result{Ids: []int64{1, 2}, Names: []*string{&one, nil}, Unused: []string{}}, result)
+
+	err := QueryColumnar(ctx, conn, &result, `select 1 as missing`, nil)
+	if !errors.Is(err, ErrNoColDest) {
+		t.Fatalf(`expected error ErrNoColDest, got %+v`, err)
+	}
+
+	var invalid struct {
+		Id int64 `db:"id"`
+	}
+	err = QueryColumnar(ctx, conn, &invalid, `select 1 as id`, nil)
+	if !errors.Is(err, ErrInvalidDest) {
+		t.Fatalf(`expected error ErrInvalidDest, got %+v`, err)
+	}
+
+	err = QueryColumnar(ctx, conn, &result, `select 1 as id, 2 as id`, nil)
+	if !errors.Is(err, ErrRedundantCol) {
+		t.Fatalf(`expected error ErrRedundantCol, got %+v`, err)
+	}
+}
+
+func TestConf_QueryColumnar(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Ids   []int64         `db:"id"`
+		Waits []time.Duration `db:"wait"`
+	}
+
+	var result Result
+	query := `select * from (values (' 1 ', interval '1 second'), (' 2 ', interval '1 minute')) as vals (id, wait)`
+
+	err := QueryColumnar(ctx, conn, &result, query, nil)
+	if !errors.Is(err, ErrScan) {
+		t.Fatalf(`expected error ErrScan, got %+v`, err)
+	}
+
+	try(t, Conf{Coerce: true}.QueryColumnar(ctx, conn, &result, query, nil))
+	eq(t, Result{Ids: []int64{1, 2}, Waits: []time.Duration{time.Second, time.Minute}}, result)
+
+	err = Conf{Coerce: true, MaxRows: 1}.QueryColumnar(ctx, conn, &result, query, nil)
+	if !errors.Is(err, ErrTooManyRows) {
+		t.Fatalf(`expected error ErrTooManyRows, got %+v`, err)
+	}
+}
+
+func TestQuery_tagged_embedded_struct(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Address struct {
+		City string `db:"city"`
+	}
+
+	type Result struct {
+		Address `db:"home"`
+		Work    Address `db:"work"`
+	}
+
+	eq(t, `("home")."city" as "home.city", ("work")."city" as "work.city"`, Cols(Result{}))
+
+	var result Result
+	try(t, Query(ctx, conn, &result, `select 'one' as "home.city", 'two' as "work.city"`, nil))
+	eq(t, Result{Address{"one"}, Address{"two"}}, result)
+
+	err := Query(ctx, conn, &result, `select 'one' as city`, nil)
+	if !errors.Is(err, ErrNoColDest) {
+		t.Fatalf(`expected error ErrNoColDest, got %+v`, err)
+	}
+}
+
+func TestQuery_interface_fields(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Text  string      `db:"text"`
+		Int   interface{} `db:"int"`
+		Bytes interface{} `db:"bytes"`
+		Null  interface{} `db:"null"`
+	}
+
+	result := Result{Null: "non-null"}
+	query := `select 'one' as text, 10 as int, '\x0102'::bytea as bytes, null as null`
+	try(t, Query(ctx, conn, &result, query, nil))
+	eq(t, Result{"one", int64(10), []byte{1, 2}, nil}, result)
+
+	var results []Result
+	query = `select * from (values (1, '\x01'::bytea), (2, '\x02'::bytea)) as vals (int, bytes)`
+	try(t, Query(ctx, conn, &results, query, nil))
+	eq(t, []Result{{Int: int64(1), Bytes: []byte{1}}, {Int: int64(2), Bytes: []byte{2}}}, results)
+}
+
+func TestConf_Coerce(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Small int8    `db:"small"`
+		Num   int64   `db:"num"`
+		Bool  bool    `db:"bool"`
+		Flag  bool    `db:"flag"`
+		Float float64 `db:"float"`
+		Text  string  `db:"text"`
+		Ptr   *int    `db:"ptr"`
+	}
+
+	conf := Conf{Coerce: true}
+	query := `select 10::int8 as small, ' 20 ' as num, 't' as bool, 1 as flag, '1.5' as float, 30 as text, null::int as ptr`
+
+	var result Result
+	try(t, conf.Query(ctx, conn, &result, query, nil))
+	eq(t, Result{10, 20, true, true, 1.5, "30", nil}, result)
+
+	err := Query(ctx, conn, &result, query, nil)
+	if !errors.Is(err, ErrScan) {
+		t.Fatalf(`expected error ErrScan, got %+v`, err)
+	}
+
+	err = conf.Query(ctx, conn, &result, `select 1000 as small`, nil)
+	if !errors.Is(err, ErrScan) {
+		t.Fatalf(`expected error ErrScan, got %+v`, err)
+	}
+
+	err = conf.Query(ctx, conn, &result, `select null::int as small`, nil)
+	if !errors.Is(err, ErrNull) {
+		t.Fatalf(`expected error ErrNull, got %+v`, err)
+	}
+
+	var num int
+	try(t, conf.Query(ctx, conn, &num, `select '40'`, nil))
+	eq(t, 40, num)
+}
+
+func TestQuery_nested_null_scanner_fields(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Inner struct {
+		Str  sql.NullString  `db:"str"`
+		Scan ScannableString `db:"scan"`
+	}
+
+	type Outer struct {
+		Id    string `db:"id"`
+		Inner *Inner `db:"inner"`
+	}
+
+	var result Outer
+	try(t, Query(ctx, conn, &result, `select 'one' as id, null::text as "inner.str", null::text as "inner.scan"`, nil))
+	eq(t, Outer{Id: "one"}, result)
+
+	try(t, Query(ctx, conn, &result, `select 'one' as id, null::text as "inner.str", 'two' as "inner.scan"`, nil))
+	eq(t, Outer{Id: "one", Inner: &Inner{Scan: "two_scanned"}}, result)
+}
+
+func TestStructArgs_zeronull(t *testing.T) {
+	type Src struct {
+		Name      string     `db:"name,zeronull"`
+		CreatedAt time.Time  `db:"created_at"`
+		DeletedAt time.Time  `db:"deleted_at,zeronull"`
+		UpdatedAt *time.Time `db:"updated_at,zeronull"`
+	}
+
+	zero := time.Time{}
+	eq(t, []interface{}{nil, zero, nil, nil}, StructArgs(Src{UpdatedAt: &zero}))
+
+	now := time.Now()
+	eq(t, []interface{}{"one", zero, now, &now}, StructArgs(Src{"one", zero, now, &now}))
+}
+
+func TestStructArgs_emptynull(t *testing.T) {
+	type Src struct {
+		Name     string  `db:"name"`
+		Nickname string  `db:"nickname,emptynull"`
+		Comment  *string `db:"comment,emptynull"`
+		Count    int     `db:"count,emptynull"`
+	}
+
+	empty := ""
+	eq(t, []interface{}{"", nil, nil, 0}, StructArgs(Src{Comment: &empty}))
+
+	one := "one"
+	eq(t, []interface{}{"one", "two", &one, 3}, StructArgs(Src{"one", "two", &one, 3}))
+}
+
+func TestConf_ZeroNullStructs(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Inner struct {
+		Val string `db:"val"`
+	}
+
+	type Outer struct {
+		Id    string `db:"id"`
+		Inner Inner  `db:"inner"`
+	}
+
+	query := `select 'one' as id, null::text as "inner.val"`
+
+	var result Outer
+	err := Query(ctx, conn, &result, query, nil)
+	if !errors.Is(err, ErrNull) {
+		t.Fatalf(`expected error ErrNull, got %+v`, err)
+	}
+
+	result = Outer{Inner: Inner{"stale"}}
+	try(t, Conf{ZeroNullStructs: true}.Query(ctx, conn, &result, query, nil))
+	eq(t, Outer{Id: "one"}, result)
+}
+
+func TestConf_ZeroNullStructs_deep(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Deep struct {
+		X string `db:"x"`
+	}
+
+	type Inner struct {
+		Deep Deep `db:"deep"`
+	}
+
+	type Outer struct {
+		Id    string `db:"id"`
+		Inner Inner  `db:"inner"`
+	}
+
+	conf := Conf{ZeroNullStructs: true}
+
+	var result Outer
+	try(t, conf.Query(ctx, conn, &result, `select 'one' as id, 'hello' as "inner.deep.x"`, nil))
+	eq(t, Outer{Id: "one", Inner: Inner{Deep{"hello"}}}, result)
+
+	result = Outer{Inner: Inner{Deep{"stale"}}}
+	try(t, conf.Query(ctx, conn, &result, `select 'one' as id, null::text as "inner.deep.x"`, nil))
+	eq(t, Outer{Id: "one"}, result)
+}
+
+func TestScanScalars(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	scan, err := QueryScanner(ctx, conn, `select count(*), max(val) from unnest(array['one', 'two']) as val`, nil)
+	try(t, err)
+	defer scan.Close()
+
+	if !scan.Next() {
+		t.Fatalf(`expected a row`)
+	}
+
+	var count int64
+	var max string
+	try(t, ScanScalars(scan, &count, &max))
+	eq(t, int64(2), count)
+	eq(t, "two", max)
+
+	err = ScanScalars(scan, &count)
+	if !errors.Is(err, ErrScan) {
+		t.Fatalf(`expected error ErrScan, got %+v`, err)
+	}
+
+	err = ScanScalars(scan, count, &max)
+	if !errors.Is(err, ErrInvalidDest) {
+		t.Fatalf(`expected error ErrInvalidDest, got %+v`, err)
+	}
+}
+
+func TestQuery_tuple(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	var id int64
+	var name string
+	var count *int64
+	try(t, Query(ctx, conn, []interface{}{&id, &name, &count}, `select 10, 'one', null::int8`, nil))
+	eq(t, int64(10), id)
+	eq(t, "one", name)
+	eq(t, (*int64)(nil), count)
+
+	err := Query(ctx, conn, []interface{}{&id}, `select 10 where false`, nil)
+	if !errors.Is(err, ErrNoRows) {
+		t.Fatalf(`expected error ErrNoRows, got %+v`, err)
+	}
+
+	err = Query(ctx, conn, []interface{}{&id}, `select * from generate_series(1, 2)`, nil)
+	if !errors.Is(err, ErrMultipleRows) {
+		t.Fatalf(`expected error ErrMultipleRows, got %+v`, err)
+	}
+
+	scan, err := QueryScanner(ctx, conn, `select val, val::text from generate_series(1, 2) as val`, nil)
+	try(t, err)
+	defer scan.Close()
+
+	var out []string
+	for scan.Next() {
+		try(t, scan.Scan([]interface{}{&id, &name}))
+		out = append(out, name)
+	}
+	try(t, scan.Err())
+	eq(t, []string{"1", "2"}, out)
+}
+
+func TestQueryN(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	var results []string
+	count, err := QueryN(ctx, conn, &results, `select * from unnest(array['one', 'two', 'three'])`, nil)
+	try(t, err)
+	eq(t, int64(3), count)
+	eq(t, []string{"one", "two", "three"}, results)
+
+	var result string
+	count, err = QueryN(ctx, conn, &result, `select 'one'`, nil)
+	try(t, err)
+	eq(t, int64(1), count)
+
+	var optional *string
+	count, err = QueryN(ctx, conn, &optional, `select 'one' where false`, nil)
+	try(t, err)
+	eq(t, int64(0), count)
+
+	count, err = QueryN(ctx, conn, &optional, `select 'one'`, nil)
+	try(t, err)
+	eq(t, int64(1), count)
+
+	type Keyed struct {
+		Id int64 `db:"id,key"`
+	}
+	var keyed map[int64]Keyed
+	count, err = QueryN(ctx, conn, &keyed, `select * from unnest(array[1, 2]) as id`, nil)
+	try(t, err)
+	eq(t, int64(2), count)
+
+	out := make(chan string, 3)
+	count, err = QueryN(ctx, conn, out, `select * from unnest(array['one', 'two', 'three'])`, nil)
+	try(t, err)
+	eq(t, int64(3), count)
+
+	try(t, Query(ctx, conn, nil, `create temp table query_n_test (val text)`, nil))
+	count, err = QueryN(ctx, conn, nil, `insert into query_n_test values ('one'), ('two')`, nil)
+	try(t, err)
+	eq(t, int64(2), count)
+}
+
+func TestQueryFirst(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	var result string
+	try(t, QueryFirst(ctx, conn, &result, `select * from unnest(array['one', 'two'])`, nil))
+	eq(t, "one", result)
+
+	err := QueryFirst(ctx, conn, &result, `select 'one' where false`, nil)
+	if !errors.Is(err, ErrNoRows) {
+		t.Fatalf(`expected error ErrNoRows, got %+v`, err)
+	}
+
+	var results []string
+	err = QueryFirst(ctx, conn, &results, `select 'one'`, nil)
+	if !errors.Is(err, ErrInvalidDest) {
+		t.Fatalf(`expected error ErrInvalidDest, got %+v`, err)
+	}
+}
+
+func TestQuery_optional_row(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Val string `db:"val"`
+	}
+
+	result := &Result{"stale"}
+	try(t, Query(ctx, conn, &result, `select 'one' as val where false`, nil))
+	eq(t, (*Result)(nil), result)
+
+	try(t, Query(ctx, conn, &result, `select 'one' as val`, nil))
+	eq(t, &Result{"one"}, result)
+
+	err := Query(ctx, conn, &result, `select * from unnest(array['one', 'two']) as val`, nil)
+	if !errors.Is(err, ErrMultipleRows) {
+		t.Fatalf(`expected error ErrMultipleRows, got %+v`, err)
+	}
+
+	var str *string
+	try(t, Query(ctx, conn, &str, `select 'one' where false`, nil))
+	eq(t, (*string)(nil), str)
+}
+
+func TestQuery_byte_arrays(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Hash [4]byte  `db:"hash"`
+		Key  *[2]byte `db:"key"`
+	}
+
+	query := `select $1::bytea as hash, $2::bytea as key`
+
+	var result Result
+	try(t, Query(ctx, conn, &result, query, []interface{}{[4]byte{1, 2, 3, 4}, &[2]byte{5, 6}}))
+	eq(t, Result{[4]byte{1, 2, 3, 4}, &[2]byte{5, 6}}, result)
+
+	try(t, Query(ctx, conn, &result, query, []interface{}{[4]byte{1, 2, 3, 4}, nil}))
+	eq(t, Result{Hash: [4]byte{1, 2, 3, 4}}, result)
+
+	err := Query(ctx, conn, &result, query, []interface{}{[3]byte{1, 2, 3}, nil})
+	if !errors.Is(err, ErrScan) {
+		t.Fatalf(`expected error ErrScan, got %+v`, err)
+	}
+
+	var hash [2]byte
+	try(t, Query(ctx, conn, &hash, `select '\x0102'::bytea`, nil))
+	eq(t, [2]byte{1, 2}, hash)
+
+	var hex string
+	try(t, Query(ctx, conn, &hex, `select $1::text`, []interface{}{HexHash{0xab, 0xcd}}))
+	eq(t, `abcd`, hex)
+}
+
+// Byte array with its own `driver.Valuer`, which takes priority over the
+// built-in conversion of byte arrays.
+type HexHash [2]byte
+
+func (self HexHash) Value() (driver.Value, error) { return fmt.Sprintf(`%x`, self[:]), nil }
+
+func TestMoney(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Total Money  `db:"total"`
+		Tip   *Money `db:"tip"`
+	}
+
+	var result Result
+	try(t, Query(ctx, conn, &result, `select '1234.56'::money as total, null::money as tip`, nil))
+	eq(t, Result{Total: 123456}, result)
+
+	var money Money
+	try(t, Query(ctx, conn, &money, `select $1::money`, []interface{}{Money(-50)}))
+	eq(t, Money(-50), money)
+	eq(t, "-0.50", money.String())
+}
+
+func TestParseMoney(t *testing.T) {
+	test := func(exp Money, str string) {
+		t.Helper()
+		val, err := ParseMoney(str)
+		try(t, err)
+		eq(t, exp, val)
+	}
+
+	test(123456, `$1,234.56`)
+	test(-50, `-$0.50`)
+	test(-300, `($3.00)`)
+	test(500, `$5`)
+
+	test(150, `+1.5`)
+	test(-100, `$-1.00`)
+	test(1234, ` 12.34 USD `)
+
+	_, err := ParseMoney(`$1.234`)
+	if err == nil {
+		t.Fatalf(`expected error for too many fractional digits`)
+	}
+
+	for _, str := range []string{
+		``, `$`, `abc`, `1e5`, `1O0`, `12.3.4`, `1..2`, `1 2`, `1,`, `--1`, `-(1)`, `(1`, `1)`, `$1$`, `12abc3`,
+	} {
+		val, err := ParseMoney(str)
+		if err == nil {
+			t.Fatalf(`expected error for %q, got %v`, str, val)
+		}
+	}
+
+	SetMoneyFormat(MoneyFormat{Decimal: ',', Thousands: '.', Digits: 2})
+	defer SetMoneyFormat(DefaultMoneyFormat)
+
+	test(123456, `1.234,56 €`)
+	eq(t, "1234,56", Money(123456).String())
+}
+
+func TestQuery_xml(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Doc struct {
+		Title string `xml:"title"`
+	}
+
+	type Result struct {
+		Doc Doc  `db:"doc,xml"`
+		Opt *Doc `db:"opt,xml"`
+	}
+
+	eq(t, `"doc", "opt"`, Cols(Result{}))
+
+	var result Result
+	query := `select '<doc><title>one</title></doc>'::xml as doc, null::xml as opt`
+	try(t, Query(ctx, conn, &result, query, nil))
+	eq(t, Result{Doc: Doc{"one"}}, result)
+
+	var text struct {
+		Text XmlText `db:"text"`
+	}
+	try(t, Query(ctx, conn, &text, `select '<text>two</text>'::xml as text`, nil))
+	eq(t, XmlText("two"), text.Text)
+}
+
+func TestBlob(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Name string `db:"name"`
+		Body Blob   `db:"body"`
+	}
+
+	eq(t, `"name", "body"`, Cols(Result{}))
+
+	var buf strings.Builder
+	var result Result
+	result.Body.Writer = &buf
+
+	try(t, Query(ctx, conn, &result, `select 'one' as name, 'contents'::bytea as body`, nil))
+	eq(t, "one", result.Name)
+	eq(t, "contents", buf.String())
+	eq(t, int64(len("contents")), result.Body.Len)
+	eq(t, false, result.Body.Null)
+
+	try(t, Query(ctx, conn, &result, `select 'two' as name, null::bytea as body`, nil))
+	eq(t, true, result.Body.Null)
+	eq(t, int64(0), result.Body.Len)
+
+	var results []Result
+	err := Query(ctx, conn, &results, `select 'one' as name, 'contents'::bytea as body`, nil)
+	if !errors.Is(err, ErrScan) {
+		t.Fatalf(`expected error ErrScan, got %+v`, err)
+	}
+}
+
+func TestConf_Positional(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Inner struct {
+		Val string `db:"val"`
+	}
+
+	type Outer struct {
+		Id    int64  `db:"id"`
+		Inner *Inner `db:"inner"`
+		Name  string `db:"name"`
+	}
+
+	conf := Conf{Positional: true}
+
+	err := Query(ctx, conn, &Outer{}, `select 10, 'one', 'two'`, nil)
+	if !errors.Is(err, ErrNoColDest) {
+		t.Fatalf(`expected error ErrNoColDest, got %+v`, err)
+	}
+
+	var result Outer
+	try(t, conf.Query(ctx, conn, &result, `select 10, 'one', 'two'`, nil))
+	eq(t, Outer{10, &Inner{"one"}, "two"}, result)
+
+	var results []Outer
+	try(t, conf.Query(ctx, conn, &results, `select * from (values (10, 'one')) as _`, nil))
+	eq(t, []Outer{{10, &Inner{"one"}, ""}}, results)
+
+	err = conf.Query(ctx, conn, &result, `select 10, 'one', 'two', 'three'`, nil)
+	if !errors.Is(err, ErrNoColDest) {
+		t.Fatalf(`expected error ErrNoColDest, got %+v`, err)
+	}
+}
+
+func TestConf_Positional_untagged(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Inner struct {
+		Val string
+	}
+
+	type Outer struct {
+		Id    int64
+		Inner *Inner
+		Name  string
+		Skip  string `db:"-"`
+	}
+
+	conf := Conf{Positional: true}
+
+	var results []Outer
+	try(t, conf.Query(ctx, conn, &results, `select * from (values (10, 'one', 'two'), (20, null, 'three')) as _`, nil))
+	eq(t, []Outer{{10, &Inner{"one"}, "two", ""}, {20, nil, "three", ""}}, results)
+
+	type Partial struct {
+		Id   int64
+		Name string
+	}
+
+	var result Partial
+	try(t, conf.Query(ctx, conn, &result, `select 10`, nil))
+	eq(t, Partial{Id: 10}, result)
+}
+
+func TestConf_RowTimeout(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	conf := Conf{RowTimeout: time.Millisecond * 50}
+
+	var results []int64
+	try(t, conf.Query(ctx, conn, &results, `select * from generate_series(1, 3)`, nil))
+	eq(t, []int64{1, 2, 3}, results)
+
+	var result int64
+	err := conf.Query(ctx, conn, &result, `select 1 from pg_sleep(1)`, nil)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf(`expected error ErrTimeout, got %+v`, err)
+	}
+}
+
+func TestConf_MaxRows(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	conf := Conf{MaxRows: 3}
+
+	var results []int64
+	try(t, conf.Query(ctx, conn, &results, `select * from generate_series(1, 3)`, nil))
+	eq(t, []int64{1, 2, 3}, results)
+
+	err := conf.Query(ctx, conn, &results, `select * from generate_series(1, 4)`, nil)
+	if !errors.Is(err, ErrTooManyRows) {
+		t.Fatalf(`expected error ErrTooManyRows, got %+v`, err)
+	}
+
+	var result int64
+	try(t, Conf{MaxRows: 1}.Query(ctx, conn, &result, `select 1`, nil))
+	eq(t, int64(1), result)
+}
+
+func TestResultCache(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	cache := NewResultCache(time.Minute, 2)
+	query := `select random()::text`
+
+	var one, two string
+	try(t, cache.Query(ctx, conn, &one, query, nil))
+	try(t, cache.Query(ctx, conn, &two, query, nil))
+	eq(t, one, two)
+	eq(t, 1, cache.Len())
+
+	try(t, cache.Query(ctx, conn, &two, query, []interface{}{}))
+	try(t, cache.Query(ctx, conn, &[]string{}, query, nil))
+	eq(t, 2, cache.Len())
+
+	cache.Clear()
+	eq(t, 0, cache.Len())
+	try(t, cache.Query(ctx, conn, &two, query, nil))
+	if one == two {
+		t.Fatalf(`expected a fresh result after clearing the cache`)
+	}
+}
+
+func TestResultCache_copy(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	cache := NewResultCache(time.Minute, 0)
+	query := `select * from unnest(array['one', 'two'])`
+
+	var results []string
+	try(t, cache.Query(ctx, conn, &results, query, nil))
+	eq(t, []string{"one", "two"}, results)
+	results[0] = "mutated"
+
+	try(t, cache.Query(ctx, conn, &results, query, nil))
+	eq(t, []string{"one", "two"}, results)
+}
+
+func TestResultCache_args(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	cache := NewResultCache(time.Minute, 0)
+	query := `select $1::text`
+
+	var result string
+	val := "one"
+	try(t, cache.Query(ctx, conn, &result, query, []interface{}{&val}))
+	eq(t, "one", result)
+
+	// The same pointer with a different value must not reuse the entry.
+	val = "two"
+	try(t, cache.Query(ctx, conn, &result, query, []interface{}{&val}))
+	eq(t, "two", result)
+	eq(t, 2, cache.Len())
+
+	// An equal value behind a different pointer must reuse the entry.
+	other := "two"
+	try(t, cache.Query(ctx, conn, &result, query, []interface{}{&other}))
+	try(t, cache.Query(ctx, conn, &result, query, []interface{}{"two"}))
+	eq(t, "two", result)
+	eq(t, 2, cache.Len())
+}
+
+func TestShardRouter(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	router := ShardRouter{
+		Shards: []QueryExecer{nil, conn},
+		Route: func(key interface{}) (int, error) {
+			return key.(int), nil
+		},
+	}
+
+	var result string
+	err := Query(ctx, router, &result, `select 'one'`, nil)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected error ErrInvalidInput, got %+v`, err)
+	}
+
+	err = Query(ContextWithShardKey(ctx, 2), router, &result, `select 'one'`, nil)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected error ErrInvalidInput, got %+v`, err)
+	}
+
+	try(t, Query(ContextWithShardKey(ctx, 1), router, &result, `select 'one'`, nil))
+	eq(t, "one", result)
+
+	shard, err := router.Shard(1)
+	try(t, err)
+	try(t, Query(ctx, shard, &result, `select 'two'`, nil))
+	eq(t, "two", result)
+}
+
+func TestReplicaRouter(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	// Without a primary, only selects succeed.
+	router := &ReplicaRouter{Replicas: []QueryExecer{conn}}
+
+	var result string
+	try(t, Query(ctx, router, &result, `select 'one'`, nil))
+	eq(t, "one", result)
+
+	err := Query(ctx, router, nil, `select 'one'`, nil)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected error ErrInvalidInput, got %+v`, err)
+	}
+
+	err = Query(ctx, router, &result, `with val as (select 'one') select * from val`, nil)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected error ErrInvalidInput, got %+v`, err)
+	}
+
+	// With an invalid picker, only non-selects succeed.
+	router = &ReplicaRouter{
+		Primary:  conn,
+		Replicas: []QueryExecer{conn},
+		Pick:     func(uint64) int { return 1 },
+	}
+
+	err = Query(ctx, router, &result, `select 'one'`, nil)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected error ErrInvalidInput, got %+v`, err)
+	}
+
+	try(t, Query(ctx, router, &result, `with val as (select 'two') select * from val`, nil))
+	eq(t, "two", result)
+
+	try(t, Query(ContextWithPrimary(ctx), router, &result, `select 'three'`, nil))
+	eq(t, "three", result)
+}
+
+func TestSetAudit(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	var entries []AuditEntry
+	SetAudit(Audit{
+		Sink: func(_ context.Context, entry AuditEntry) {
+			entries = append(entries, entry)
+		},
+		Rules: []RedactRule{
+			RedactArgsAt(`select $1::text, $2::text`, 1),
+			RedactArgsWhere(func(arg interface{}) bool { return arg == "secret" }),
+		},
+	})
+	defer SetAudit(Audit{})
+
+	var result []string
+	args := []interface{}{"one", "two"}
+	err := Query(ctx, conn, &result, `select $1::text, $2::text`, args)
+	if err == nil {
+		t.Fatalf(`expected an error due to mismatching columns`)
+	}
+	try(t, Query(ctx, conn, nil, `select $1::text`, []interface{}{"secret"}))
+
+	eq(t, 2, len(entries))
+	eq(t, []interface{}{"one", Redacted}, entries[0].Args)
+	eq(t, []interface{}{"one", "two"}, args)
+	eq(t, `select $1::text`, entries[1].Query)
+	eq(t, []interface{}{Redacted}, entries[1].Args)
+	eq(t, nil, entries[1].Err)
+}
+
+func TestStructArgs_redact(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Src struct {
+		Name string  `db:"name"`
+		Ssn  string  `db:"ssn,redact"`
+		Pin  *string `db:"pin,redact"`
+	}
+
+	args := StructArgs(Src{Name: "one", Ssn: "secret"})
+	eq(t, []interface{}{"one", RedactedArg{"secret"}, (*string)(nil)}, args)
+	eq(t, `[one [REDACTED] <nil>]`, fmt.Sprint(args))
+
+	for _, verb := range []string{`%v`, `%+v`, `%#v`, `%s`, `%q`, `%x`, `%d`} {
+		out := fmt.Sprintf(verb, args)
+		if strings.Contains(out, `secret`) || strings.Contains(out, fmt.Sprintf(`%x`, `secret`)) {
+			t.Fatalf(`expected %q to mask the redacted value, got %q`, verb, out)
+		}
+	}
+	eq(t, `[REDACTED]`, fmt.Sprintf(`%#v`, args[1]))
+
+	var entries []AuditEntry
+	SetAudit(Audit{Sink: func(_ context.Context, entry AuditEntry) {
+		entries = append(entries, entry)
+	}})
+	defer SetAudit(Audit{})
+
+	var result []string
+	try(t, Query(ctx, conn, &result, `select unnest(array[$1::text, $2::text, $3::text])`, args))
+	eq(t, []string{"one", "secret", ""}, result)
+	eq(t, []interface{}{"one", Redacted, (*string)(nil)}, entries[0].Args)
+}
+
+func TestSetQueryGuard(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	eq(t, QueryFingerprint(`select 1`), QueryFingerprint("\n\tselect   1\n"))
+
+	query := RegisterNamedQuery(`guard_named`, `select 'named'`)
+	eq(t, `select 'named'`, query)
+	named, ok := NamedQuery(`guard_named`)
+	eq(t, true, ok)
+	eq(t, query, named)
+
+	AllowQueries(`select 'allowed'`)
+	AllowFingerprints(QueryFingerprint(`select 'fingerprint'`))
+
+	SetQueryGuard(true)
+	defer SetQueryGuard(false)
+
+	var result string
+	try(t, Query(ctx, conn, &result, query, nil))
+	eq(t, `named`, result)
+	try(t, Query(ctx, conn, &result, `select  'allowed'`, nil))
+	eq(t, `allowed`, result)
+	try(t, Query(ctx, conn, &result, `select 'fingerprint'`, nil))
+	eq(t, `fingerprint`, result)
+
+	err := Query(ctx, conn, &result, `select 'other'`, nil)
+	if !errors.Is(err, ErrQueryNotAllowed) {
+		t.Fatalf(`expected ErrQueryNotAllowed, got %+v`, err)
+	}
+
+	err = Query(ctx, conn, nil, `select 'other'`, nil)
+	if !errors.Is(err, ErrQueryNotAllowed) {
+		t.Fatalf(`expected ErrQueryNotAllowed, got %+v`, err)
+	}
+}
+
+func TestSetQueryGuard_wrapped(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Dest struct {
+		One string `db:"one"`
+		Two string `db:"two"`
+	}
+
+	const query = `select 'one' as one, 'two' as two`
+	const other = `select 'other' as one, 'two' as two`
+	AllowQueries(query)
+
+	SetQueryGuard(true)
+	defer SetQueryGuard(false)
+
+	var masked Dest
+	try(t, QueryMasked(ctx, conn, &masked, query, nil, []string{`one`}))
+	eq(t, Dest{One: `one`}, masked)
+
+	var json map[string]string
+	try(t, QueryJson(ctx, conn, &json, query, nil))
+	eq(t, map[string]string{`one`: `one`, `two`: `two`}, json)
+
+	err := QueryMasked(ctx, conn, &masked, other, nil, []string{`one`})
+	if !errors.Is(err, ErrQueryNotAllowed) {
+		t.Fatalf(`expected ErrQueryNotAllowed, got %+v`, err)
+	}
+
+	err = QueryJson(ctx, conn, &json, other, nil)
+	if !errors.Is(err, ErrQueryNotAllowed) {
+		t.Fatalf(`expected ErrQueryNotAllowed, got %+v`, err)
+	}
+}
+
+func TestValidateNamedQueries(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Dest struct {
+		One int    `db:"one"`
+		Two string `db:"two"`
+	}
+
+	defer unregisterNamedQueries(
+		`validate_many`, `validate_one`, `validate_scalar`, `validate_map`, `validate_chan`,
+		`validate_row_scanner`, `validate_variants`, `validate_invalid`,
+	)
+
+	type KeyedDest struct {
+		One int    `db:"one,key"`
+		Two string `db:"two"`
+	}
+
+	RegisterVariants[VariantEvent](`kind`, map[string]interface{}{
+		`created`: VariantCreated{},
+		`deleted`: &VariantDeleted{},
+	})
+
+	RegisterNamedQueryDest(`validate_many`, `select $1::int as one, $2::text as two`, []Dest(nil))
+	RegisterNamedQueryDest(`validate_one`, `select 1 as one`, (*Dest)(nil))
+	RegisterNamedQueryDest(`validate_scalar`, `select 'one'`, []string(nil))
+	RegisterNamedQueryDest(`validate_map`, `select 1 as one, 'two' as two`, map[int]KeyedDest(nil))
+	RegisterNamedQueryDest(`validate_chan`, `select 1 as one`, (chan Dest)(nil))
+	RegisterNamedQueryDest(`validate_row_scanner`, `select 1 as one, 2 as two, 3 as three`, []ScannedPair(nil))
+	RegisterNamedQueryDest(`validate_variants`, `select 10 as id, 'created' as kind, 'one' as name, null::text as reason`, []VariantEvent(nil))
+	try(t, ValidateNamedQueries(ctx, conn))
+
+	RegisterNamedQueryDest(`validate_map_key`, `select 1 as one`, map[int]Dest(nil))
+	err := ValidateNamedQueries(ctx, conn)
+	if !errors.Is(err, ErrInvalidDest) {
+		t.Fatalf(`expected ErrInvalidDest for a map without a key field, got %+v`, err)
+	}
+	unregisterNamedQueries(`validate_map_key`)
+
+	RegisterNamedQueryDest(`validate_variants_missing`, `select 10 as id`, []VariantEvent(nil))
+	err = ValidateNamedQueries(ctx, conn)
+	if !errors.Is(err, ErrMissingCol) {
+		t.Fatalf(`expected ErrMissingCol, got %+v`, err)
+	}
+	unregisterNamedQueries(`validate_variants_missing`)
+
+	RegisterNamedQueryDest(`validate_invalid`, `select 1 as one, 2 as three`, Dest{})
+	err = ValidateNamedQueries(ctx, conn)
+	if !errors.Is(err, ErrNoColDest) {
+		t.Fatalf(`expected ErrNoColDest, got %+v`, err)
+	}
+	if !strings.Contains(err.Error(), `validate_invalid`) {
+		t.Fatalf(`expected error to mention the query name, got %+v`, err)
+	}
+}
+
+func unregisterNamedQueries(names ...string) {
+	guard.Lock()
+	defer guard.Unlock()
+	for _, name := range names {
+		delete(guard.names, name)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	const query = `select * from generate_series(1, $1::int)`
+	args := []interface{}{10}
+
+	var lines []string
+	try(t, Explain(ctx, conn, &lines, query, args))
+	if len(lines) == 0 || !strings.Contains(lines[0], `Function Scan`) {
+		t.Fatalf(`unexpected plan: %q`, lines)
+	}
+
+	type PlanLine struct {
+		Line string `db:"QUERY PLAN"`
+	}
+	var planLines []PlanLine
+	try(t, Explain(ctx, conn, &planLines, query, args))
+	eq(t, lines[0], planLines[0].Line)
+
+	var raw json.RawMessage
+	try(t, ExplainOpts{Format: `json`}.Explain(ctx, conn, &raw, query, args))
+	if !json.Valid(raw) {
+		t.Fatalf(`invalid JSON plan: %q`, raw)
+	}
+
+	var plan []struct {
+		Plan struct {
+			NodeType   string `json:"Node Type"`
+			ActualRows int    `json:"Actual Rows"`
+		}
+	}
+	try(t, ExplainOpts{Analyze: true, Format: `JSON`}.Explain(ctx, conn, &plan, query, args))
+	eq(t, `Function Scan`, plan[0].Plan.NodeType)
+	eq(t, 10, plan[0].Plan.ActualRows)
+
+	err := ExplainOpts{Format: `html`}.Explain(ctx, conn, &raw, query, args)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected ErrInvalidInput, got %+v`, err)
+	}
+}
+
+func TestValidateDest(t *testing.T) {
+	type Embedded struct {
+		Id string `db:"id"`
+	}
+
+	type Nested struct {
+		Val  *string     `db:"val"`
+		Data [4]byte     `db:"data"`
+		Any  interface{} `db:"any"`
+	}
+
+	type Valid struct {
+		Embedded
+		Name      string    `db:"name"`
+		CreatedAt time.Time `db:"created_at"`
+		Nested    *Nested   `db:"nested"`
+		Other     Nested    `db:"other"`
+		Raw       []byte    `db:"raw"`
+		Ignored   chan int
+		hidden    string
+	}
+
+	try(t, ValidateDest(Valid{}))
+	try(t, ValidateDest(&Valid{}))
+	try(t, ValidateDest([]*Valid(nil)))
+	try(t, ValidateDest([]string(nil)))
+	try(t, ValidateDest(Row{}))
+
+	type Unexported struct {
+		Id   string `db:"id"`
+		name string `db:"name"`
+	}
+
+	type Redundant struct {
+		Embedded
+		Other string `db:"id"`
+	}
+
+	type Node struct {
+		Id     string `db:"id"`
+		Parent *Node  `db:"parent"`
+	}
+
+	type Unsupported struct {
+		Tags []string `db:"tags"`
+	}
+
+	testValidateDestErr(t, Unexported{}, ErrInvalidDest)
+	testValidateDestErr(t, Redundant{}, ErrRedundantCol)
+	testValidateDestErr(t, Node{}, ErrInvalidDest)
+	testValidateDestErr(t, []Unsupported(nil), ErrInvalidDest)
+	testValidateDestErr(t, map[string]int(nil), ErrInvalidDest)
+	testValidateDestErr(t, nil, ErrInvalidDest)
+
+	RegisterFieldDecoder(Unsupported{}, `Tags`, func(src interface{}, dest reflect.Value) error {
+		return nil
+	})
+	try(t, ValidateDest(Unsupported{}))
+}
+
+func testValidateDestErr(t *testing.T, dest interface{}, expected error) {
+	t.Helper()
+	err := ValidateDest(dest)
+	if !errors.Is(err, expected) {
+		t.Fatalf(`expected %+v for %T, got %+v`, expected, dest, err)
+	}
+}
+
+func TestQuerySqlb(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		One string `db:"one"`
+		Two string `db:"two"`
+	}
+
+	var result Result
+	query := sqlb.QueryOrd(`select $1::text as one, $2::text as two`, `one`, `two`)
+	try(t, QuerySqlb(ctx, conn, &result, query))
+	eq(t, Result{`one`, `two`}, result)
+
+	var results []Result
+	query = sqlb.QueryOrd(`select * from ($1) as _`, sqlb.QueryOrd(`select $1::text as one, $2::text as two`, `three`, `four`))
+	try(t, QuerySqlb(ctx, conn, &results, &query))
+	eq(t, []Result{{`three`, `four`}}, results)
+
+	scan, err := QueryScannerSqlb(ctx, conn, query)
+	try(t, err)
+	results, err = CollectSlice[Result](scan)
+	try(t, err)
+	eq(t, []Result{{`three`, `four`}}, results)
+}
+
+func TestQueryOf(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	queries := []Queryable{
+		RawQuery{`select $1::text`, []interface{}{`raw`}},
+		SqlbQuery{sqlb.QueryOrd(`select $1::text`, `sqlb`)},
+		CustomQuery(`custom`),
+	}
+
+	var results []string
+	for _, query := range queries {
+		var result string
+		try(t, QueryOf(ctx, conn, &result, query))
+		results = append(results, result)
+	}
+	eq(t, []string{`raw`, `sqlb`, `custom`}, results)
+
+	scan, err := QueryScannerOf(ctx, conn, CustomQuery(`scanned`))
+	try(t, err)
+	results, err = CollectSlice[string](scan)
+	try(t, err)
+	eq(t, []string{`scanned`}, results)
+}
+
+type CustomQuery string
+
+func (self CustomQuery) QueryArgs() (string, []interface{}) {
+	return `select $1::text`, []interface{}{string(self)}
+}
+
+func TestBufferScanner(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Val string `db:"val"`
+	}
+
+	scan, err := QueryScanner(ctx, conn, `select unnest(array['one', 'two', 'three']) as val`, nil)
+	try(t, err)
+
+	var buf Scanner = BufferScanner(scan, 0)
+	defer buf.Close()
+
+	var first []Result
+	for buf.Next() {
+		var val Result
+		try(t, buf.Scan(&val))
+		first = append(first, val)
+	}
+	try(t, buf.Err())
+	try(t, buf.Close())
+	eq(t, []Result{{Val: `one`}, {Val: `two`}, {Val: `three`}}, first)
+
+	buf.(*BufferedScanner).Rewind()
+
+	var second []Result
+	for buf.Next() {
+		var val Result
+		try(t, buf.Scan(&val))
+		second = append(second, val)
+	}
+	try(t, buf.Err())
+	eq(t, first, second)
+	eq(t, 3, buf.(*BufferedScanner).Len())
+}
+
+func TestBufferScanner_limit(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	scan, err := QueryScanner(ctx, conn, `select unnest(array['one', 'two', 'three'])`, nil)
+	try(t, err)
+
+	buf := BufferScanner(scan, 2)
+	defer buf.Close()
+
+	var vals []string
+	for buf.Next() {
+		var val string
+		try(t, buf.Scan(&val))
+		vals = append(vals, val)
+	}
+	eq(t, []string{`one`, `two`}, vals)
+
+	err = buf.Err()
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected ErrInvalidInput, got %+v`, err)
+	}
+}
+
+func TestGetScanStats(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Val  string `db:"val"`
+		Blob []byte `db:"blob"`
+		Num  int    `db:"num"`
+	}
+
+	scan, err := QueryScanner(ctx, conn, `
+		select val, convert_to(val, 'utf8') as blob, length(val) as num
+		from unnest(array['one', 'three']) as val
+	`, nil)
+	try(t, err)
+	eq(t, ScanStats{}, GetScanStats(scan))
+
+	results, err := CollectSlice[Result](scan)
+	try(t, err)
+	eq(t, 2, len(results))
+
+	stats := GetScanStats(scan)
+	eq(t, int64(2), stats.Rows)
+	eq(t, int64(16), stats.Bytes)
+	if !(stats.WaitTime > 0) || !(stats.DecodeTime > 0) {
+		t.Fatalf(`expected positive timings, got %+v`, stats)
+	}
+}
+
+func TestGetScanStats_rescan(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	scan, err := QueryScanner(ctx, conn, `select * from unnest(array['one', 'two']) as val`, nil)
+	try(t, err)
+	defer scan.Close()
+
+	var val string
+	var peeked string
+	for scan.Next() {
+		try(t, scan.Scan(&val))
+		try(t, scan.Scan([]interface{}{&val}))
+		_ = PeekRow(scan, &peeked)
+		try(t, scan.Scan(&val))
+	}
+	try(t, scan.Err())
+	eq(t, int64(2), GetScanStats(scan).Rows)
+}
+
+func TestSyncScanner(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	scan, err := QueryScanner(ctx, conn, `select generate_series(1, 100)`, nil)
+	try(t, err)
+
+	shared := NewSyncScanner(scan)
+	defer shared.Close()
+
+	var lock sync.Mutex
+	var sum int
+	var group sync.WaitGroup
+	errs := make(chan error, 4)
+
+	for i := 0; i < 4; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for {
+				var val int
+				ok, err := shared.Decode(&val)
+				if err != nil || !ok {
+					errs <- err
+					return
+				}
+
+				lock.Lock()
+				sum += val
+				lock.Unlock()
+			}
+		}()
+	}
+
+	group.Wait()
+	close(errs)
+	for err := range errs {
+		try(t, err)
+	}
+	try(t, shared.Err())
+	eq(t, 5050, sum)
+	eq(t, int64(100), shared.Stats().Rows)
+
+	ok, err := shared.Decode(new(int))
+	try(t, err)
+	eq(t, false, ok)
+}
+
+func TestContextConn(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	_, ok := ConnFromContext(ctx)
+	eq(t, false, ok)
+
+	var result string
+	err := Query(ctx, ContextConn{}, &result, `select 'one'`, nil)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected ErrInvalidInput, got %+v`, err)
+	}
+
+	try(t, Query(ctx, conn, nil, `create temporary table context_conn (val text)`, nil))
+
+	txCtx := ContextWithConn(ctx, conn)
+	found, ok := ConnFromContext(txCtx)
+	eq(t, true, ok)
+	eq(t, QueryExecer(conn), found)
+
+	shared := ContextConn{Default: testDb}
+	try(t, Query(txCtx, shared, nil, `insert into context_conn values ('one')`, nil))
+	try(t, Query(txCtx, shared, &result, `select val from context_conn`, nil))
+	eq(t, `one`, result)
+}
+
+func TestQueryVal(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		One string `db:"one"`
+	}
+
+	result, err := QueryVal[Result](ctx, conn, `select 'one' as one`, nil)
+	try(t, err)
+	eq(t, Result{`one`}, result)
+
+	num, err := QueryVal[int](ctx, conn, `select $1::int`, []interface{}{10})
+	try(t, err)
+	eq(t, 10, num)
+
+	optional, err := QueryVal[*Result](ctx, conn, `select 'one' as one where false`, nil)
+	try(t, err)
+	eq(t, (*Result)(nil), optional)
+
+	_, err = QueryVal[Result](ctx, conn, `select 'one' as one where false`, nil)
+	if !errors.Is(err, ErrNoRows) {
+		t.Fatalf(`expected ErrNoRows, got %+v`, err)
 	}
+}
 
-	actual := sqlb.Cols(Nesting{})
-	expected := `"val", ("nested")."val" as "nested.val"`
-	if expected != actual {
-		t.Fatalf(`expected Cols() to produce %q, got %q`, expected, actual)
+func TestQuerySlice(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	vals, err := QuerySlice[string](ctx, conn, `select unnest(array['one', 'two'])`, nil)
+	try(t, err)
+	eq(t, []string{`one`, `two`}, vals)
+
+	vals, err = QuerySlice[string](ctx, conn, `select 'one' where false`, nil)
+	try(t, err)
+	eq(t, []string(nil), vals)
+}
+
+func TestQueryTypedScanner(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	scan, err := QueryTypedScanner[int](ctx, conn, `select generate_series(1, 3)`, nil)
+	try(t, err)
+	defer scan.Close()
+
+	var vals []int
+	for scan.Next() {
+		val, err := scan.Scan()
+		try(t, err)
+		vals = append(vals, val)
+	}
+	try(t, scan.Err())
+	eq(t, []int{1, 2, 3}, vals)
+	eq(t, int64(3), scan.Stats().Rows)
+}
+
+func TestQuery_oneToMany(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Item struct {
+		Id   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+
+	type Order struct {
+		Id    int64  `db:"id,key"`
+		Items []Item `db:"items"`
+	}
+
+	type Person struct {
+		Id     int64   `db:"id,key"`
+		Name   string  `db:"name"`
+		Orders []Order `db:"orders"`
+	}
+
+	query := `
+		select * from (values
+			(1, 'one', 10, 100, 'x'),
+			(1, 'one', 10, 101, 'y'),
+			(2, 'two', null, null, null),
+			(1, 'one', 11, null, null)
+		) as _ (id, name, "orders.id", "orders.items.id", "orders.items.name")
+	`
+
+	var results []Person
+	err := Query(ctx, conn, &results, query, nil)
+	try(t, err)
+
+	eq(t, []Person{
+		{Id: 1, Name: `one`, Orders: []Order{
+			{Id: 10, Items: []Item{{100, `x`}, {101, `y`}}},
+			{Id: 11},
+		}},
+		{Id: 2, Name: `two`},
+	}, results)
+
+	var result Person
+	err = Query(ctx, conn, &result, query+` limit 2`, nil)
+	try(t, err)
+	eq(t, results[0].Orders[0], result.Orders[0])
+
+	err = Query(ctx, conn, &result, query, nil)
+	if !errors.Is(err, ErrMultipleRows) {
+		t.Fatalf(`expected ErrMultipleRows, got %+v`, err)
+	}
+
+	type NoKey struct {
+		Id     int64   `db:"id"`
+		Orders []Order `db:"orders"`
+	}
+
+	var noKeys []NoKey
+	err = Query(ctx, conn, &noKeys, `select 1 as id, 10 as "orders.id"`, nil)
+	if !errors.Is(err, ErrInvalidDest) {
+		t.Fatalf(`expected ErrInvalidDest, got %+v`, err)
+	}
+}
+
+func TestQuery_oneToMany_interleaved(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Item struct {
+		Id int64 `db:"id,key"`
+	}
+
+	type Order struct {
+		Id    int64  `db:"id,key"`
+		Items []Item `db:"items"`
+	}
+
+	type Person struct {
+		Id     int64   `db:"id,key"`
+		Orders []Order `db:"orders"`
+	}
+
+	query := `
+		select * from (values
+			(1, 10, 100),
+			(2, 20, 200),
+			(1, 11, 110),
+			(2, 20, 201),
+			(1, 10, 101),
+			(1, 10, 100)
+		) as _ (id, "orders.id", "orders.items.id")
+	`
+
+	var results []Person
+	try(t, Query(ctx, conn, &results, query, nil))
+	eq(t, []Person{
+		{Id: 1, Orders: []Order{
+			{Id: 10, Items: []Item{{100}, {101}}},
+			{Id: 11, Items: []Item{{110}}},
+		}},
+		{Id: 2, Orders: []Order{
+			{Id: 20, Items: []Item{{200}, {201}}},
+		}},
+	}, results)
+
+	var byId map[int64]Person
+	try(t, Query(ctx, conn, &byId, query, nil))
+	eq(t, map[int64]Person{1: results[0], 2: results[1]}, byId)
+}
+
+func TestQuery_map(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Person struct {
+		Id   int64  `db:"id,key"`
+		Name string `db:"name"`
+	}
+
+	query := `select * from (values (1, 'one'), (2, 'two')) as _ (id, name)`
+
+	var results map[int64]Person
+	err := Query(ctx, conn, &results, query, nil)
+	try(t, err)
+	eq(t, map[int64]Person{1: {1, `one`}, 2: {2, `two`}}, results)
+
+	var byName map[string]*Person
+	err = Conf{MapKey: `name`}.Query(ctx, conn, &byName, query, nil)
+	try(t, err)
+	eq(t, map[string]*Person{`one`: {1, `one`}, `two`: {2, `two`}}, byName)
+
+	query = `select * from (values (1, 'one'), (1, 'two')) as _ (id, name)`
+
+	err = Query(ctx, conn, &results, query, nil)
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf(`expected ErrDuplicateKey, got %+v`, err)
+	}
+
+	err = Conf{AllowDuplicateKeys: true}.Query(ctx, conn, &results, query, nil)
+	try(t, err)
+	eq(t, map[int64]Person{1: {1, `two`}}, results)
+}
+
+func TestScanRows(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		One int64  `db:"one"`
+		Two string `db:"two"`
+	}
+
+	rows, err := conn.QueryContext(ctx, `select 1 as one, 'two' as two union all select 2, 'three'`)
+	try(t, err)
+
+	var results []Result
+	err = ScanRows(&results, rows)
+	try(t, err)
+	eq(t, []Result{{1, `two`}, {2, `three`}}, results)
+
+	rows, err = conn.QueryContext(ctx, `select 1 as one, 'two' as two`)
+	try(t, err)
+
+	scan := NewScanner(rows)
+	defer scan.Close()
+
+	var result Result
+	if !scan.Next() {
+		t.Fatalf(`expected a row`)
+	}
+	try(t, scan.Scan(&result))
+	eq(t, Result{1, `two`}, result)
+}
+
+func TestNextResultSet(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	scan, err := QueryScanner(ctx, conn, `select 1 as one; select 'two' as two`, nil)
+	try(t, err)
+	defer scan.Close()
+
+	type One struct {
+		One int64 `db:"one"`
+	}
+	type Two struct {
+		Two string `db:"two"`
+	}
+
+	var one One
+	if !scan.Next() {
+		t.Fatalf(`expected a row in the first result set`)
+	}
+	try(t, scan.Scan(&one))
+	eq(t, One{1}, one)
+
+	if !NextResultSet(scan) {
+		t.Fatalf(`expected a second result set`)
+	}
+
+	var two Two
+	if !scan.Next() {
+		t.Fatalf(`expected a row in the second result set`)
+	}
+	try(t, scan.Scan(&two))
+	eq(t, Two{`two`}, two)
+
+	if NextResultSet(scan) {
+		t.Fatalf(`expected no more result sets`)
+	}
+	try(t, scan.Err())
+}
+
+// Scanner without the optional methods, see `Scanner`.
+type plainScanner struct{ vals []int }
+
+func (self *plainScanner) Close() error { return nil }
+func (self *plainScanner) Err() error   { return nil }
+
+func (self *plainScanner) Next() bool {
+	if len(self.vals) == 0 {
+		return false
+	}
+	self.vals = self.vals[1:]
+	return true
+}
+
+func (self *plainScanner) Scan(dest interface{}) error {
+	*dest.(*int) = self.vals[0] * 10
+	return nil
+}
+
+func TestScanner_plain(t *testing.T) {
+	scan := &plainScanner{vals: []int{0, 1, 2, 3}}
+
+	buf := make([]int, 2)
+	count, err := ScanChunk(scan, buf, 2)
+	try(t, err)
+	eq(t, 2, count)
+	eq(t, []int{10, 20}, buf)
+
+	var val int
+	err = PeekRow(scan, &val)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf(`expected ErrInvalidInput, got %+v`, err)
+	}
+
+	eq(t, ScanStats{}, GetScanStats(scan))
+	eq(t, false, NextResultSet(scan))
+}
+
+func TestQueryMulti(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	t.Run(`decode_each_result_set`, func(t *testing.T) {
+		var count int64
+		var names []string
+		var one struct {
+			One int64 `db:"one"`
+		}
+
+		err := QueryMulti(ctx, conn,
+			`select 2; select 'one' union all select 'two'; select 1 as one`, nil,
+			&count, &names, &one,
+		)
+		try(t, err)
+		eq(t, int64(2), count)
+		eq(t, []string{`one`, `two`}, names)
+		eq(t, int64(1), one.One)
+	})
+
+	t.Run(`skip_nil_dests`, func(t *testing.T) {
+		var val string
+		err := QueryMulti(ctx, conn, `select 1; select 'two'`, nil, nil, &val)
+		try(t, err)
+		eq(t, `two`, val)
+	})
+
+	t.Run(`too_few_result_sets`, func(t *testing.T) {
+		var one, two int64
+		err := QueryMulti(ctx, conn, `select 1`, nil, &one, &two)
+		if !errors.Is(err, ErrInvalidDest) {
+			t.Fatalf(`expected ErrInvalidDest, got %+v`, err)
+		}
+	})
+}
+
+func TestRunBatch(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	t.Run(`decode_each_item`, func(t *testing.T) {
+		var batch Batch
+		var one int64
+		var names []string
+		batch.Queue(`select $1::int8`, []interface{}{1}, &one)
+		batch.Queue(`select unnest(array['one', 'two'])`, nil, &names)
+		batch.Queue(`select 1`, nil, nil)
+		eq(t, 3, batch.Len())
+
+		try(t, RunBatch(ctx, conn, &batch))
+		eq(t, int64(1), one)
+		eq(t, []string{`one`, `two`}, names)
+	})
+
+	t.Run(`per_item_errors`, func(t *testing.T) {
+		var batch Batch
+		var one, two int64
+		batch.Queue(`select 1`, nil, &one)
+		batch.Queue(`select 2 where false`, nil, &two)
+
+		err := RunBatch(ctx, conn, &batch)
+		errs, ok := err.(BatchErr)
+		if !ok {
+			t.Fatalf(`expected BatchErr, got %+v`, err)
+		}
+		eq(t, 2, len(errs))
+		try(t, errs[0])
+		if !errors.Is(errs[1], ErrNoRows) || !errors.Is(err, ErrNoRows) {
+			t.Fatalf(`expected ErrNoRows, got %+v`, err)
+		}
+		eq(t, int64(1), one)
+	})
+}
+
+func TestQuery_chan(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	out := make(chan int64)
+	errs := make(chan error, 1)
+	go func() { errs <- Query(ctx, conn, out, `select generate_series(1, 3)`, nil) }()
+
+	var vals []int64
+	for val := range out {
+		vals = append(vals, val)
+	}
+	try(t, <-errs)
+	eq(t, []int64{1, 2, 3}, vals)
+
+	var recv <-chan int64 = make(chan int64)
+	err := Query(ctx, conn, recv, `select 1`, nil)
+	if !errors.Is(err, ErrInvalidDest) {
+		t.Fatalf(`expected ErrInvalidDest, got %+v`, err)
+	}
+}
+
+func TestConf_IgnoreUnknownCols(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		One string `db:"one"`
+	}
+
+	query := `select 'one' as one, 'two' as two`
+
+	var result Result
+	err := Query(ctx, conn, &result, query, nil)
+	if !errors.Is(err, ErrNoColDest) {
+		t.Fatalf(`expected error ErrNoColDest, got %+v`, err)
+	}
+
+	err = Conf{IgnoreUnknownCols: true}.Query(ctx, conn, &result, query, nil)
+	try(t, err)
+	eq(t, Result{`one`}, result)
+}
+
+func TestConf_StrictFields(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Inner struct {
+		One string `db:"one"`
+		Two string `db:"two"`
+	}
+
+	type Result struct {
+		One   string `db:"one"`
+		Inner *Inner `db:"inner"`
+	}
+
+	var result Result
+	err := Conf{StrictFields: true}.Query(ctx, conn, &result, `select 'one' as one, 'two' as "inner.two"`, nil)
+	if !errors.Is(err, ErrMissingCol) {
+		t.Fatalf(`expected error ErrMissingCol, got %+v`, err)
+	}
+	if !strings.Contains(err.Error(), `"inner.one"`) {
+		t.Fatalf(`expected the error to mention the missing column, got %v`, err)
+	}
+
+	err = Conf{StrictFields: true}.Query(ctx, conn, &result, `select 'one' as one, 'two' as "inner.one", 'three' as "inner.two"`, nil)
+	try(t, err)
+	eq(t, Result{`one`, &Inner{`two`, `three`}}, result)
+}
+
+func TestQuery_composite(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Inner struct {
+		Id   int64     `db:"id"`
+		Name string    `db:"name"`
+		Note *string   `db:"note"`
+		At   time.Time `db:"at"`
+	}
+
+	type Outer struct {
+		Val   string `db:"val"`
+		Inner Inner  `db:"inner"`
+		Opt   *Inner `db:"opt"`
+	}
+
+	var result Outer
+	try(t, Query(ctx, conn, &result, `
+		select
+			'one'                                                          as val,
+			(10, 'some, "text"', null, '2021-01-02 03:04:05+00'::timestamptz) as inner,
+			null::record                                                   as opt
+	`, nil))
+
+	eq(t, `one`, result.Val)
+	eq(t, int64(10), result.Inner.Id)
+	eq(t, `some, "text"`, result.Inner.Name)
+	eq(t, (*string)(nil), result.Inner.Note)
+	eq(t, true, result.Inner.At.Equal(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)))
+	eq(t, (*Inner)(nil), result.Opt)
+}
+
+func TestParseComposite(t *testing.T) {
+	str := func(val string) *string { return &val }
+
+	vals, err := parseComposite(`(10,"some, ""text""",,"",\\x)`)
+	try(t, err)
+	eq(t, []*string{str(`10`), str(`some, "text"`), nil, str(``), str(`\x`)}, vals)
+
+	_, err = parseComposite(`10,20`)
+	if err == nil {
+		t.Fatalf(`expected error for malformed composite`)
+	}
+}
+
+func TestQuery_hstore(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	_, err := conn.ExecContext(ctx, `create extension if not exists hstore`)
+	try(t, err)
+
+	type Result struct {
+		Attrs map[string]string  `db:"attrs"`
+		Opt   map[string]*string `db:"opt"`
+		Typed Hstore             `db:"typed"`
+		None  map[string]string  `db:"none"`
+	}
+
+	one, two, quoted := `1`, `two`, `\`
+	var result Result
+	try(t, Query(ctx, conn, &result, `
+		select
+			$1::hstore             as attrs,
+			$2::hstore             as opt,
+			$2::hstore             as typed,
+			null::hstore           as none
+	`, []interface{}{Hstore{`one`: &one, `"quoted"`: &quoted}, Hstore{`one`: nil, `two`: &two}}))
+
+	eq(t, map[string]string{`one`: `1`, `"quoted"`: `\`}, result.Attrs)
+	eq(t, map[string]*string{`one`: nil, `two`: &two}, result.Opt)
+	eq(t, Hstore{`one`: nil, `two`: &two}, result.Typed)
+	eq(t, map[string]string(nil), result.None)
+
+	var attrs map[string]string
+	try(t, Query(ctx, conn, &attrs, `select 'one=>1'::hstore`, nil))
+	eq(t, map[string]string{`one`: `1`}, attrs)
+
+	err = Query(ctx, conn, &attrs, `select 'one=>NULL'::hstore`, nil)
+	if !errors.Is(err, ErrNull) {
+		t.Fatalf(`expected ErrNull, got %+v`, err)
+	}
+}
+
+func TestConvertHstore(t *testing.T) {
+	val := `v`
+	out, err := convertHstore(map[string]*string{`b`: nil, `a "q"`: &val})
+	try(t, err)
+	eq(t, `"a \"q\""=>"v", "b"=>NULL`, out)
+
+	pairs, err := parseHstore(`"a \"q\""=>"v", b=>NULL`)
+	try(t, err)
+	eq(t, []tHstorePair{{key: `a "q"`, val: &val}, {key: `b`}}, pairs)
+
+	// Plain maps are left to the driver, which may encode them as JSON.
+	args := []interface{}{map[string]string{`one`: `1`}, Hstore(nil)}
+	converted, err := ConvertArgs(args)
+	try(t, err)
+	eq(t, args, converted)
+
+	hstoreVal, err := Hstore{`a`: &val}.Value()
+	try(t, err)
+	eq(t, `"a"=>"v"`, hstoreVal)
+
+	hstoreVal, err = Hstore(nil).Value()
+	try(t, err)
+	eq(t, nil, hstoreVal)
+}
+
+func TestQuery_interval(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		One   time.Duration  `db:"one"`
+		Two   *time.Duration `db:"two"`
+		Three Interval       `db:"three"`
+		Four  time.Duration  `db:"four"`
+	}
+
+	var result Result
+	try(t, Query(ctx, conn, &result, `
+		select
+			'1 day -01:30:00.25'::interval as one,
+			null::interval                 as two,
+			$1::interval                   as three,
+			42::int8                       as four
+	`, []interface{}{Interval{Months: 14, Days: -3, Microseconds: 1}}))
+
+	eq(t, Result{
+		One:   23*time.Hour - 30*time.Minute - 250*time.Millisecond,
+		Three: Interval{Months: 14, Days: -3, Microseconds: 1},
+		Four:  42,
+	}, result)
+
+	var dur time.Duration
+	err := Query(ctx, conn, &dur, `select '1 mon'::interval`, nil)
+	if err == nil {
+		t.Fatalf(`expected error when decoding months into time.Duration`)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	val, err := parseInterval(`1 year 2 mons -3 days +04:05:06.5`)
+	try(t, err)
+	eq(t, Interval{Months: 14, Days: -3, Microseconds: 14706500000}, val)
+
+	val, err = parseInterval(`-00:00:01.000002`)
+	try(t, err)
+	eq(t, Interval{Microseconds: -1000002}, val)
+
+	_, err = parseInterval(`1 fortnight`)
+	if err == nil {
+		t.Fatalf(`expected error for unknown unit`)
+	}
+}
+
+func TestQuery_numeric(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Result struct {
+		Rat   big.Rat    `db:"rat"`
+		Float *big.Float `db:"float"`
+		Int   *big.Int   `db:"int"`
+		Null  *big.Rat   `db:"null"`
+	}
+
+	var result Result
+	try(t, Query(ctx, conn, &result, `
+		select
+			123.4500000000000000000001::numeric         as rat,
+			1.00000000000000000000000000000001::numeric as float,
+			12345678901234567890123::numeric            as int,
+			null::numeric                               as null
+	`, nil))
+
+	eq(t, `123.4500000000000000000001`, result.Rat.FloatString(22))
+	eq(t, `1.00000000000000000000000000000001`, result.Float.Text('f', -1))
+	eq(t, `12345678901234567890123`, result.Int.String())
+	eq(t, (*big.Rat)(nil), result.Null)
+
+	var rat *big.Rat
+	try(t, Query(ctx, conn, &rat, `select 1.5::numeric`, nil))
+	eq(t, big.NewRat(3, 2), rat)
+
+	var scaled big.Int
+	try(t, Query(ctx, conn, &scaled, `select 123::numeric(10, 2)`, nil))
+	eq(t, `123`, scaled.String())
+
+	err := Query(ctx, conn, &scaled, `select 123.01::numeric(10, 2)`, nil)
+	if err == nil {
+		t.Fatalf(`expected an error for a fractional value, got %v`, &scaled)
+	}
+}
+
+func TestQuery_rest(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Rest struct {
+		Extra map[string]interface{} `db:",rest"`
+	}
+
+	type Result struct {
+		Rest
+		Id string `db:"id"`
+	}
+
+	var results []Result
+	try(t, Query(ctx, conn, &results, `
+		select * from (values ('one', 1, null), ('two', 2, 'three')) as vals (id, num, str)
+	`, nil))
+	eq(t, []Result{
+		{Rest{map[string]interface{}{`num`: int64(1), `str`: nil}}, `one`},
+		{Rest{map[string]interface{}{`num`: int64(2), `str`: `three`}}, `two`},
+	}, results)
+
+	var result Result
+	try(t, Query(ctx, conn, &result, `select 'one' as id`, nil))
+	eq(t, Result{Id: `one`}, result)
+
+	type Invalid struct {
+		Extra map[string]string `db:",rest"`
 	}
+	testValidateDestErr(t, Invalid{}, ErrInvalidDest)
+	try(t, ValidateDest(Result{}))
 }
 
 func createDb(connParams []string, dbName string) error {
@@ -806,6 +4011,28 @@ func (self *ScannableString) Scan(input interface{}) error {
 	return nil
 }
 
+func decodeEpochString(src interface{}, dest reflect.Value) error {
+	if src == nil {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+
+	var str string
+	switch src := src.(type) {
+	case string:
+		str = src
+	case []byte:
+		str = string(src)
+	}
+
+	sec, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return err
+	}
+	dest.Set(reflect.ValueOf(time.Unix(sec, 0).UTC()))
+	return nil
+}
+
 func strPtr(str string) *string { return &str }
 
 func timeMustParse(str string) time.Time {
@@ -847,3 +4074,12 @@ func (self *ScannableStruct) Scan(input interface{}) error {
 		return fmt.Errorf("unrecognized input for type %T: type %T, value %v", self, input, input)
 	}
 }
+
+type XmlText string
+
+func (self *XmlText) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
+	var val string
+	err := dec.DecodeElement(&val, &start)
+	*self = XmlText(val)
+	return err
+}
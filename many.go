@@ -0,0 +1,394 @@
+package gos
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+True if the type is a slice of non-scannable structs, or pointers to them,
+which isn't scannable itself. Such fields, when they have a column name and
+no decoder, are decoded as one-to-many relations: each row contributes at most
+one element, decoded from the nested columns such as "orders.id", and rows of
+the same parent are merged by its key field, see `tManyMerge`.
+*/
+func isRtypeManyStruct(rtype reflect.Type) bool {
+	return rtype != nil &&
+		rtype.Kind() == reflect.Slice &&
+		!isRtypeScannable(rtype) &&
+		isRtypeStructNonScannable(rtype.Elem())
+}
+
+/*
+Compiles the decoding of a one-to-many field: the columns are decoded into a
+new element, which is appended to the slice. The element is skipped when all
+of its columns are null, which is the case for parents without children in a
+left join.
+*/
+func compileManyFieldSpec(spec *tDestSpec, fieldSpec *tFieldSpec) tDecodeStep {
+	decode := compileTypeSpec(spec, &fieldSpec.typeSpec, nil)
+	colIndexes := appendManyColIndexes(nil, &fieldSpec.typeSpec)
+	elemRtype := fieldSpec.sfield.Type.Elem()
+	isPtr := elemRtype.Kind() == reflect.Ptr
+	fieldPath := fieldSpec.fieldPath
+
+	return func(rootRval reflect.Value, state *tDecodeState) error {
+		if state.isEveryColNil(colIndexes) {
+			return nil
+		}
+
+		ptrRval := reflect.New(refut.RtypeDeref(elemRtype))
+		err := decode(ptrRval.Elem(), state)
+		if err != nil {
+			return err
+		}
+
+		elemRval := ptrRval
+		if !isPtr {
+			elemRval = ptrRval.Elem()
+		}
+
+		sliceRval := refut.RvalFieldByPathAlloc(rootRval, fieldPath)
+		sliceRval.Set(reflect.Append(sliceRval, elemRval))
+		return nil
+	}
+}
+
+// Ignores the columns of nested one-to-many fields.
+func appendManyColIndexes(out []int, typeSpec *tTypeSpec) []int {
+	for i := range typeSpec.fieldSpecs {
+		fieldSpec := &typeSpec.fieldSpecs[i]
+		if fieldSpec.many {
+			continue
+		}
+		if fieldSpec.colIndex >= 0 {
+			out = append(out, fieldSpec.colIndex)
+			continue
+		}
+		out = appendManyColIndexes(out, &fieldSpec.typeSpec)
+	}
+	return out
+}
+
+/*
+Merges rows of a one-to-many query. Each row is decoded into a separate parent
+with at most one element in each one-to-many field; parents with the same key
+are merged into the first one, appending the children. Children with a key of
+their own are merged in the same way, which supports multi-level joins.
+*/
+type tManyMerge struct {
+	level *tManyLevel
+	tManySlice
+}
+
+/*
+Merge state of a slice of structs with a key field: the index of each element
+by key, and the merge states of the one-to-many fields of each element, which
+allows to find the element to merge into without scanning the slice.
+*/
+type tManySlice struct {
+	indexes map[interface{}]int
+	fields  map[interface{}][]*tManySlice // One per field of `tManyLevel`.
+}
+
+// Describes how to merge values of one struct type.
+type tManyLevel struct {
+	keyPath []int // Nil if the type has no key field.
+	fields  []tManyField
+}
+
+type tManyField struct {
+	fieldPath []int
+	level     *tManyLevel
+}
+
+/*
+Returns nil if the scanner doesn't decode into a struct with one-to-many
+fields. Must be called after decoding the first row, which prepares the spec.
+*/
+func prepareManyMerge(scan Scanner, rtype reflect.Type) (*tManyMerge, error) {
+	level, err := prepareManyLevel(scan, rtype)
+	if err != nil || level == nil {
+		return nil, err
+	}
+
+	if level.keyPath == nil {
+		return nil, ErrInvalidDest.while(`preparing one-to-many decoding`).because(fmt.Errorf(
+			`type %q has one-to-many fields but no key field; tag the key with "key", for example: db:"id,key"`,
+			refut.RtypeDeref(rtype),
+		))
+	}
+
+	return &tManyMerge{level: level, tManySlice: tManySlice{indexes: map[interface{}]int{}}}, nil
+}
+
+/*
+Variant of `prepareManyMerge` that doesn't require a key field, for callers
+which find previously decoded parents by other means. Buffered scanners are
+unwrapped. Other scanners not created by Gos can't be inspected, and fail when
+the type has one-to-many fields, instead of leaving the rows unmerged.
+*/
+func prepareManyLevel(scan Scanner, rtype reflect.Type) (*tManyLevel, error) {
+	for {
+		buffered, ok := scan.(*BufferedScanner)
+		if !ok {
+			break
+		}
+		scan = buffered.scan
+	}
+
+	sc, ok := scan.(*scanner)
+	if !ok {
+		_, isJson := scan.(jsonScanner)
+		if isJson || !hasManyFields(rtype) {
+			return nil, nil
+		}
+		return nil, ErrInvalidDest.while(`preparing one-to-many decoding`).because(fmt.Errorf(
+			`type %q has one-to-many fields, which require a scanner created by Gos, got %T`,
+			refut.RtypeDeref(rtype), scan,
+		))
+	}
+
+	typ := sc.types[reflect.PtrTo(rtype)]
+	if typ == nil || typ.spec == nil {
+		return nil, nil
+	}
+
+	level, err := makeManyLevel(&typ.spec.typeSpec, rtype)
+	if err != nil || len(level.fields) == 0 {
+		return nil, err
+	}
+	return level, nil
+}
+
+func makeManyLevel(typeSpec *tTypeSpec, rtype reflect.Type) (*tManyLevel, error) {
+	keyPath, err := structKeyPath(rtype)
+	if err != nil {
+		return nil, err
+	}
+
+	level := &tManyLevel{keyPath: keyPath}
+
+	for _, fieldSpec := range appendManyFieldSpecs(nil, typeSpec) {
+		sub, err := makeManyLevel(&fieldSpec.typeSpec, fieldSpec.sfield.Type.Elem())
+		if err != nil {
+			return nil, err
+		}
+		level.fields = append(level.fields, tManyField{fieldPath: fieldSpec.fieldPath, level: sub})
+	}
+	return level, nil
+}
+
+/*
+True if the struct type has fields which are decoded as one-to-many relations,
+including fields of embedded and nested structs. Unlike the decoding spec,
+this doesn't depend on the result columns or registered decoders.
+*/
+func hasManyFields(rtype reflect.Type) bool {
+	rtype = refut.RtypeDeref(rtype)
+	if rtype.Kind() != reflect.Struct {
+		return false
+	}
+
+	var found bool
+	_ = traverseStructRtype(rtype, func(sfield reflect.StructField, _ []int) error {
+		if found || sfieldColumnName(sfield) == "" {
+			return nil
+		}
+		if isRtypeManyStruct(sfield.Type) {
+			found = true
+		} else if isRtypeStructNonScannable(sfield.Type) {
+			found = hasManyFields(sfield.Type)
+		}
+		return nil
+	})
+	return found
+}
+
+// Finds one-to-many fields, including those of embedded and nested structs.
+func appendManyFieldSpecs(out []*tFieldSpec, typeSpec *tTypeSpec) []*tFieldSpec {
+	for i := range typeSpec.fieldSpecs {
+		fieldSpec := &typeSpec.fieldSpecs[i]
+		if fieldSpec.many {
+			out = append(out, fieldSpec)
+			continue
+		}
+		out = appendManyFieldSpecs(out, &fieldSpec.typeSpec)
+	}
+	return out
+}
+
+/*
+Returns the path to the field tagged with the "key" option, if any. The key
+type must be comparable, since keys are used in maps.
+*/
+func structKeyPath(rtype reflect.Type) ([]int, error) {
+	var out []int
+
+	err := traverseStructRtype(rtype, func(sfield reflect.StructField, fieldPath []int) error {
+		if sfieldColumnName(sfield) == "" || !sfieldHasColumnOpt(sfield, `key`) {
+			return nil
+		}
+
+		if out != nil {
+			return ErrInvalidDest.while(`finding key field`).because(fmt.Errorf(
+				`type %q has multiple key fields`, refut.RtypeDeref(rtype),
+			))
+		}
+
+		if !refut.RtypeDeref(sfield.Type).Comparable() {
+			return ErrInvalidDest.while(`finding key field`).because(fmt.Errorf(
+				`key field %q of type %q is not comparable`, sfield.Name, refut.RtypeDeref(rtype),
+			))
+		}
+
+		out = copyIntSlice(fieldPath)
+		return nil
+	})
+	return out, err
+}
+
+/*
+Returns the key of the given struct, dereferencing pointers, so that keys
+compare by value. Null keys are nil, including invalid values of types such as
+`sql.NullInt64`, see `isRvalNullValuer`.
+*/
+func rvalKey(rval reflect.Value, keyPath []int) interface{} {
+	rval = reflect.ValueOf(rvalFieldByPathOrNil(rval, keyPath))
+	for rval.Kind() == reflect.Ptr {
+		if rval.IsNil() {
+			return nil
+		}
+		rval = rval.Elem()
+	}
+	if !rval.IsValid() || isRvalNullValuer(rval) {
+		return nil
+	}
+	return rval.Interface()
+}
+
+/*
+Merges the row into a previously decoded parent with the same key, returning
+true, or remembers its key, returning false, in which case the caller must
+append the row. Safe to call on nil.
+*/
+func (self *tManyMerge) add(sliceRval, rval reflect.Value) bool {
+	if self == nil {
+		return false
+	}
+
+	key := rvalKey(rval, self.level.keyPath)
+	index, ok := self.indexes[key]
+	if ok {
+		self.level.merge(sliceRval.Index(index), rval, self.fieldSlices(key, self.level))
+		return true
+	}
+
+	self.indexes[key] = sliceRval.Len()
+	return false
+}
+
+/*
+Used for a single destination: merges the remaining rows into the already
+decoded first row. Rows with a different key are unexpected.
+*/
+func (self *tManyMerge) addRest(rval reflect.Value, scan Scanner) error {
+	key := rvalKey(rval, self.level.keyPath)
+	fields := self.fieldSlices(key, self.level)
+
+	for scan.Next() {
+		ptrRval := reflect.New(rval.Type())
+
+		err := scan.Scan(ptrRval.Interface())
+		if err != nil {
+			return err
+		}
+
+		if rvalKey(ptrRval.Elem(), self.level.keyPath) != key {
+			return ErrMultipleRows.while(`verifying row count`)
+		}
+		self.level.merge(rval, ptrRval.Elem(), fields)
+	}
+
+	err := scan.Err()
+	if err != nil {
+		return Err{While: `iterating rows`, Cause: err}
+	}
+	return nil
+}
+
+/*
+Appends the children of `src` to the corresponding slices of `tar`, merging
+children with the same key. The given merge states correspond to the fields
+of the level, and belong to `tar`.
+*/
+func (self *tManyLevel) merge(tar, src reflect.Value, states []*tManySlice) {
+	for fieldIndex, field := range self.fields {
+		srcRval := reflect.ValueOf(rvalFieldByPathOrNil(src, field.fieldPath))
+		if !srcRval.IsValid() || srcRval.Len() == 0 {
+			continue
+		}
+
+		tarRval := refut.RvalFieldByPathAlloc(refut.RvalDerefAlloc(tar), field.fieldPath)
+
+		for i := 0; i < srcRval.Len(); i++ {
+			elemRval := srcRval.Index(i)
+
+			// Without a key, children are never merged.
+			if field.level.keyPath != nil {
+				state := states[fieldIndex]
+				key := rvalKey(elemRval, field.level.keyPath)
+
+				index, ok := state.index(tarRval, key, field.level.keyPath)
+				if ok {
+					field.level.merge(tarRval.Index(index), elemRval, state.fieldSlices(key, field.level))
+					continue
+				}
+				state.indexes[key] = tarRval.Len()
+			}
+			tarRval.Set(reflect.Append(tarRval, elemRval))
+		}
+	}
+}
+
+/*
+Index of the element with the given key. On first use, indexes the elements
+which were appended before merging, such as the children decoded from the
+first row of the parent. The first element with a given key wins.
+*/
+func (self *tManySlice) index(sliceRval reflect.Value, key interface{}, keyPath []int) (int, bool) {
+	if self.indexes == nil {
+		self.indexes = make(map[interface{}]int, sliceRval.Len())
+		for i := 0; i < sliceRval.Len(); i++ {
+			elemKey := rvalKey(sliceRval.Index(i), keyPath)
+			_, ok := self.indexes[elemKey]
+			if !ok {
+				self.indexes[elemKey] = i
+			}
+		}
+	}
+
+	index, ok := self.indexes[key]
+	return index, ok
+}
+
+// Merge states of the one-to-many fields of the element with the given key.
+func (self *tManySlice) fieldSlices(key interface{}, level *tManyLevel) []*tManySlice {
+	out := self.fields[key]
+	if out != nil {
+		return out
+	}
+
+	out = make([]*tManySlice, len(level.fields))
+	for i := range out {
+		out[i] = &tManySlice{}
+	}
+
+	if self.fields == nil {
+		self.fields = map[interface{}][]*tManySlice{}
+	}
+	self.fields[key] = out
+	return out
+}
@@ -0,0 +1,126 @@
+package gos
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+/*
+Registers a hand-written mapper for the type `T`, which is then used for
+decoding rows into `T` instead of reflection. This gives full control over
+decoding, and avoids the overhead of reflection, for the few hottest types
+where it matters.
+
+`cols` lists the columns supported by the mapper. Every column in the result
+set must be listed, otherwise decoding fails with `ErrNoColDest`. For each row,
+the mapper receives raw column values in the order of `cols`, as returned by
+the driver. Columns missing from the result set are represented as nil, just
+like nulls. The slice is reused between rows, and must not be modified or
+retained after the mapper returns; the values themselves may be retained.
+Example:
+
+	gos.RegisterMapper([]string{`id`, `name`}, func(src []interface{}, dest *Person) error {
+		dest.Id, _ = src[0].(int64)
+		dest.Name, _ = src[1].(string)
+		return nil
+	})
+
+Registering another mapper for the same type replaces the previous one. Should
+be called during initialization, before running queries.
+*/
+func RegisterMapper[T any](cols []string, fun func(src []interface{}, dest *T) error) {
+	rtype := reflect.TypeOf((*T)(nil)).Elem()
+
+	mappers.Lock()
+	defer mappers.Unlock()
+
+	mappers.types[rtype] = tMapper{
+		cols: copyStringSlice(cols),
+		fun: func(src []interface{}, dest interface{}) error {
+			return fun(src, dest.(*T))
+		},
+	}
+}
+
+/* Internal */
+
+var mappers = struct {
+	sync.RWMutex
+	types map[reflect.Type]tMapper
+}{types: map[reflect.Type]tMapper{}}
+
+type tMapper struct {
+	cols []string
+	fun  func([]interface{}, interface{}) error
+}
+
+func getMapper(rtype reflect.Type) (tMapper, bool) {
+	mappers.RLock()
+	defer mappers.RUnlock()
+	val, ok := mappers.types[rtype]
+	return val, ok
+}
+
+/*
+Describes how the columns of a specific result set correspond to the inputs of
+a mapper. Cached by the scanner for the lifetime of the result set, along with
+buffers reused for every row.
+*/
+type tMapping struct {
+	mapper  tMapper
+	indexes []int         // Index in `mapper.cols` for each result column, or -1 to skip.
+	vals    []interface{} // Raw values of the current row.
+	ptrs    []interface{} // Pointers to `vals`, for `Rows.Scan`.
+	src     []interface{} // Inputs of the mapper, in the order of `mapper.cols`.
+}
+
+func prepareMapping(colNames []string, rtype reflect.Type, mapper tMapper, ignoreUnknown bool) (*tMapping, error) {
+	indexes := make([]int, len(colNames))
+	for i, colName := range colNames {
+		index := stringIndex(mapper.cols, colName)
+		if index < 0 && !ignoreUnknown {
+			return nil, Err{
+				Code:  ErrCodeNoColDest,
+				While: `preparing mapping`,
+				Cause: fmt.Errorf(`column %q is not supported by the mapper registered for type %q`, colName, rtype),
+			}
+		}
+		indexes[i] = index
+	}
+
+	vals := make([]interface{}, len(indexes))
+	ptrs := make([]interface{}, len(vals))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+
+	return &tMapping{
+		mapper:  mapper,
+		indexes: indexes,
+		vals:    vals,
+		ptrs:    ptrs,
+		src:     make([]interface{}, len(mapper.cols)),
+	}, nil
+}
+
+func (self *tMapping) decode(rows Rows, dest interface{}) error {
+	err := rows.Scan(self.ptrs...)
+	if err != nil {
+		return ErrScan.because(err)
+	}
+
+	// Columns missing from the result set are never assigned, and remain nil.
+	src := self.src
+	for i, index := range self.indexes {
+		if index >= 0 {
+			src[index] = self.vals[i]
+		}
+	}
+
+	err = self.mapper.fun(src, dest)
+	if err != nil {
+		return Err{Code: ErrCodeScan, While: `decoding via mapper`, Cause: err}
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package gos
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/*
+Amount of money in minor units, such as cents, for use with the Postgres
+`money` type. Drivers return `money` values as locale-formatted strings such as
+"$1,234.56" or "-$0.50", which this parses according to the current
+`MoneyFormat`, ignoring currency symbols. Usable as a field, scalar
+destination, or query argument:
+
+	type Order struct {
+		Total gos.Money `db:"total"`
+	}
+
+For nullable columns, use `*Money`. As an argument, the amount is formatted as
+a plain decimal number, such as "1234.56", which Postgres accepts as `money`
+input. Use `String` for the same decimal representation.
+*/
+type Money int64
+
+// Implement `sql.Scanner`.
+func (self *Money) Scan(src interface{}) error {
+	var str string
+	switch src := src.(type) {
+	case string:
+		str = src
+	case []byte:
+		str = string(src)
+	case nil:
+		return fmt.Errorf(`can't scan null into non-nilable %T; use a pointer`, *self)
+	default:
+		return fmt.Errorf(`can't scan %T into %T`, src, *self)
+	}
+
+	val, err := ParseMoney(str)
+	if err != nil {
+		return err
+	}
+	*self = val
+	return nil
+}
+
+// Implement `driver.Valuer`.
+func (self Money) Value() (driver.Value, error) {
+	return self.String(), nil
+}
+
+/*
+Formats the amount as a plain decimal number, using the decimal separator and
+the amount of fractional digits from the current `MoneyFormat`.
+*/
+func (self Money) String() string {
+	format := getMoneyFormat()
+
+	val := int64(self)
+	neg := val < 0
+	str := strconv.FormatUint(absInt64(val), 10)
+
+	if format.Digits > 0 {
+		if len(str) <= format.Digits {
+			str = strings.Repeat(`0`, format.Digits-len(str)+1) + str
+		}
+		index := len(str) - format.Digits
+		str = str[:index] + string(format.Decimal) + str[index:]
+	}
+
+	if neg {
+		return `-` + str
+	}
+	return str
+}
+
+/*
+Parses a locale-formatted amount of money, as returned by drivers for the
+Postgres `money` type, into minor units, according to the current
+`MoneyFormat`. The amount consists of digits, optionally grouped by the
+thousands separator, and at most one decimal separator. It may be surrounded
+by a currency symbol, such as "$" or "EUR", and a sign; negative amounts may
+also be enclosed in parentheses. Spaces around these parts are ignored. Fails
+on any other text, if the amount has more fractional digits than the format
+allows, or doesn't fit into `int64`.
+*/
+func ParseMoney(str string) (Money, error) {
+	parser := tMoneyParser{format: getMoneyFormat(), chars: []rune(str)}
+	val, err := parser.parse()
+	if err != nil {
+		return 0, fmt.Errorf(`can't parse money %q: %w`, str, err)
+	}
+	return val, nil
+}
+
+/*
+Describes how amounts of the Postgres `money` type are formatted, which depends
+on the `lc_monetary` setting of the database. See `SetMoneyFormat`.
+*/
+type MoneyFormat struct {
+	// Decimal separator, such as '.' or ','. Required.
+	Decimal rune
+	// Thousands separator, such as ',' or '.'. Accepted between digits when
+	// parsing, and omitted when formatting.
+	Thousands rune
+	// Amount of fractional digits, such as 2 for cents or 0 for yen.
+	Digits int
+}
+
+// Default `MoneyFormat`, matching the "C" and "en_US" locales.
+var DefaultMoneyFormat = MoneyFormat{Decimal: '.', Thousands: ',', Digits: 2}
+
+/*
+Sets the format used by `Money` and `ParseMoney`, which must match the
+`lc_monetary` setting of the database. Example for a German locale:
+
+	gos.SetMoneyFormat(gos.MoneyFormat{Decimal: ',', Thousands: '.', Digits: 2})
+
+Should be called during initialization. Panics if the format is invalid.
+*/
+func SetMoneyFormat(format MoneyFormat) {
+	if format.Decimal == 0 || format.Decimal == format.Thousands || format.Digits < 0 {
+		panic(ErrInvalidInput.while(`setting money format`).because(
+			fmt.Errorf(`invalid format %+v`, format),
+		))
+	}
+
+	moneyFormat.Lock()
+	moneyFormat.val = format
+	moneyFormat.Unlock()
+}
+
+/* Internal */
+
+var moneyFormat = struct {
+	sync.RWMutex
+	val MoneyFormat
+}{val: DefaultMoneyFormat}
+
+func getMoneyFormat() MoneyFormat {
+	moneyFormat.RLock()
+	defer moneyFormat.RUnlock()
+	return moneyFormat.val
+}
+
+func absInt64(val int64) uint64 {
+	if val < 0 {
+		return uint64(-(val + 1)) + 1
+	}
+	return uint64(val)
+}
+
+// Implements `ParseMoney`.
+type tMoneyParser struct {
+	format   MoneyFormat
+	chars    []rune
+	pos      int
+	neg      bool
+	signed   bool
+	paren    bool
+	currency bool
+}
+
+func (self *tMoneyParser) parse() (Money, error) {
+	err := self.affixes(true)
+	if err != nil {
+		return 0, err
+	}
+
+	val, err := self.amount()
+	if err != nil {
+		return 0, err
+	}
+
+	err = self.affixes(false)
+	if err != nil {
+		return 0, err
+	}
+
+	if self.pos < len(self.chars) {
+		return 0, fmt.Errorf(`unexpected %q`, self.chars[self.pos])
+	}
+	if self.paren {
+		return 0, fmt.Errorf(`unclosed parenthesis`)
+	}
+
+	if self.neg {
+		val = -val
+	}
+	return Money(val), nil
+}
+
+/*
+Parses the sign, parentheses and currency symbol before or after the amount,
+each of which may occur at most once. Stops at the first unrelated character.
+*/
+func (self *tMoneyParser) affixes(prefix bool) error {
+	for {
+		self.skipSpace()
+		if self.pos >= len(self.chars) {
+			return nil
+		}
+
+		char := self.chars[self.pos]
+		switch {
+		case char == '-' || char == '+':
+			if self.signed {
+				return fmt.Errorf(`unexpected %q`, char)
+			}
+			self.signed = true
+			self.neg = char == '-'
+			self.pos++
+
+		case char == '(' && prefix:
+			if self.signed {
+				return fmt.Errorf(`unexpected %q`, char)
+			}
+			self.signed = true
+			self.paren = true
+			self.neg = true
+			self.pos++
+
+		case char == ')' && !prefix:
+			if !self.paren {
+				return fmt.Errorf(`unexpected %q`, char)
+			}
+			self.paren = false
+			self.pos++
+
+		case isCurrencyChar(char):
+			if self.currency {
+				return fmt.Errorf(`unexpected %q`, char)
+			}
+			self.currency = true
+			for self.pos < len(self.chars) && isCurrencyChar(self.chars[self.pos]) {
+				self.pos++
+			}
+
+		default:
+			return nil
+		}
+	}
+}
+
+// Parses the digits of the amount, returning minor units.
+func (self *tMoneyParser) amount() (int64, error) {
+	format := self.format
+
+	var val int64
+	var frac, hasDigits bool
+	var fracDigits int
+
+loop:
+	for self.pos < len(self.chars) {
+		char := self.chars[self.pos]
+
+		switch {
+		case isDigit(char):
+			if frac {
+				if fracDigits >= format.Digits {
+					return 0, fmt.Errorf(`too many fractional digits`)
+				}
+				fracDigits++
+			}
+
+			digit := int64(char - '0')
+			if val > (math.MaxInt64-digit)/10 {
+				return 0, fmt.Errorf(`out of range`)
+			}
+			val = val*10 + digit
+			hasDigits = true
+
+		case char == format.Decimal && format.Digits > 0 && !frac:
+			frac = true
+
+		// Only between digits, which distinguishes it from a space before a
+		// currency symbol when the separator is a space.
+		case char == format.Thousands && char != 0 && hasDigits && !frac &&
+			self.pos+1 < len(self.chars) && isDigit(self.chars[self.pos+1]):
+
+		default:
+			break loop
+		}
+		self.pos++
+	}
+
+	if !hasDigits {
+		if self.pos < len(self.chars) {
+			return 0, fmt.Errorf(`unexpected %q`, self.chars[self.pos])
+		}
+		return 0, fmt.Errorf(`no digits`)
+	}
+
+	for ; fracDigits < format.Digits; fracDigits++ {
+		if val > math.MaxInt64/10 {
+			return 0, fmt.Errorf(`out of range`)
+		}
+		val *= 10
+	}
+	return val, nil
+}
+
+func (self *tMoneyParser) skipSpace() {
+	for self.pos < len(self.chars) && unicode.IsSpace(self.chars[self.pos]) {
+		self.pos++
+	}
+}
+
+func isDigit(char rune) bool { return char >= '0' && char <= '9' }
+
+// Note that `unicode.IsSymbol` is true for '+'.
+func isCurrencyChar(char rune) bool {
+	return char != '+' && (unicode.IsLetter(char) || unicode.IsSymbol(char))
+}
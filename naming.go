@@ -0,0 +1,178 @@
+package gos
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Sets a function that determines column names for exported struct fields that
+don't have a `db` tag. By default, such fields are ignored. The function takes
+the Go field name and returns the column name; returning "" ignores the field.
+Explicit `db` tags always take priority, and `db:"-"` still excludes the field.
+Example:
+
+	gos.SetColumnNamer(strings.ToLower)
+
+Affects decoding, `Cols` and its variants, and `StructArgs`. Should be called
+during initialization, before running queries or generating columns. Clears
+cached data, see `ClearCaches`. A nil function restores the default.
+*/
+func SetColumnNamer(fun func(fieldName string) string) {
+	columnNamer.Lock()
+	columnNamer.fun = fun
+	columnNamer.Unlock()
+	ClearCaches()
+}
+
+/*
+Enables or disables the use of `json` tags as column names for exported struct
+fields that don't have a `db` tag. Disabled by default. Useful for API-layer
+structs whose `json` tags already match the column names:
+
+	gos.SetJsonTagFallback(true)
+
+	type Person struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+Explicit `db` tags always take priority, and `db:"-"` still excludes the field.
+Fields without a usable `json` tag, including `json:"-"`, fall back on the
+column namer, see `SetColumnNamer`. Has the same scope and caveats as
+`SetColumnNamer`.
+*/
+func SetJsonTagFallback(enable bool) {
+	columnNamer.Lock()
+	columnNamer.json = enable
+	columnNamer.Unlock()
+	ClearCaches()
+}
+
+/*
+Sets the separator of nested column aliases, which is "." by default, as in
+"outer_field.inner_field". Useful when dots in aliases conflict with drivers
+or tooling:
+
+	gos.SetAliasSeparator(`__`)
+
+Affects both decoding, which then expects aliases such as
+"outer_field__inner_field", and the aliases generated by `Cols` and its
+variants. Doesn't affect mask paths, see `Cols`, which always use ".". Has the
+same scope and caveats as `SetColumnNamer`. An empty string restores the
+default. Panics if the separator contains double quotes.
+*/
+func SetAliasSeparator(sep string) {
+	if strings.Contains(sep, `"`) {
+		panic(ErrInvalidInput.while(`setting alias separator`).because(
+			fmt.Errorf(`separator must not contain double quotes, got %q`, sep),
+		))
+	}
+
+	columnNamer.Lock()
+	columnNamer.sep = sep
+	columnNamer.Unlock()
+	ClearCaches()
+}
+
+/*
+Converts a Go field name to snake_case, treating runs of capitals as acronyms:
+"UserID" becomes "user_id", "HTTPServer" becomes "http_server", and "IDs"
+becomes "ids". Meant for
+`SetColumnNamer`, which enables automatic mapping of untagged fields:
+
+	gos.SetColumnNamer(gos.SnakeCase)
+*/
+func SnakeCase(fieldName string) string {
+	runes := []rune(fieldName)
+	var buf strings.Builder
+	buf.Grow(len(fieldName) + 4)
+
+	for i, char := range runes {
+		if unicode.IsUpper(char) {
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || isAcronymEnd(runes, i)) {
+				buf.WriteByte('_')
+			}
+			char = unicode.ToLower(char)
+		}
+		buf.WriteRune(char)
+	}
+	return buf.String()
+}
+
+/* Internal */
+
+var columnNamer struct {
+	sync.RWMutex
+	fun  func(string) string
+	json bool
+	sep  string
+}
+
+func getColumnNamer() (func(string) string, bool) {
+	columnNamer.RLock()
+	defer columnNamer.RUnlock()
+	return columnNamer.fun, columnNamer.json
+}
+
+// Separator of nested column aliases, see `SetAliasSeparator`.
+func aliasSeparator() string {
+	columnNamer.RLock()
+	defer columnNamer.RUnlock()
+	if columnNamer.sep == "" {
+		return "."
+	}
+	return columnNamer.sep
+}
+
+/*
+Returns the column name for the given field, or "" if the field should be
+ignored. Doesn't check if the field is exported.
+
+TODO: consider validating that the column name doesn't contain double quotes. We
+might return an error, or panic.
+*/
+func sfieldColumnName(sfield reflect.StructField) string {
+	tag := sfield.Tag.Get(`db`)
+
+	name := ParseColumnTag(tag).Name
+	if name != "" || isTagExcluded(tag) {
+		return name
+	}
+
+	namer, json := getColumnNamer()
+	if json {
+		name := refut.TagIdent(sfield.Tag.Get(`json`))
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+
+	if namer == nil {
+		return ""
+	}
+	return namer(sfield.Name)
+}
+
+// True for tags like `db:"-"` or `db:"-,<opts>"`.
+func isTagExcluded(tag string) bool {
+	return tag == `-` || strings.HasPrefix(tag, `-,`)
+}
+
+/*
+True if the capital at the given index, preceded by another capital, starts a
+new word, as "S" in "HTTPServer". A plural suffix, as in "IDs", doesn't count.
+*/
+func isAcronymEnd(runes []rune, index int) bool {
+	next := index + 1
+	if next >= len(runes) || !unicode.IsLower(runes[next]) {
+		return false
+	}
+	isPlural := runes[next] == 's' && (next+1 >= len(runes) || !unicode.IsLower(runes[next+1]))
+	return !isPlural
+}
@@ -0,0 +1,58 @@
+//go:build go1.22
+
+package gos
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestQuery_sql_null(t *testing.T) {
+	ctx, conn := testInit(t)
+
+	type Inner struct {
+		Str sql.NullString  `db:"str"`
+		Num sql.Null[int64] `db:"num"`
+	}
+
+	type Child struct {
+		Id sql.Null[int64] `db:"id,key"`
+	}
+
+	type Outer struct {
+		Id       sql.NullInt64 `db:"id,key"`
+		Inner    *Inner        `db:"inner"`
+		Children []Child       `db:"children"`
+	}
+
+	var results []Outer
+	try(t, Query(ctx, conn, &results, `
+		select * from (values
+			(1, null::text, null::int8, 10::int8),
+			(1, null::text, null::int8, 11::int8),
+			(2, 'two',      null::int8, null::int8)
+		) as _ (id, "inner.str", "inner.num", "children.id")
+	`, nil))
+
+	eq(t, []Outer{
+		{
+			Id:       sql.NullInt64{Int64: 1, Valid: true},
+			Children: []Child{{sql.Null[int64]{V: 10, Valid: true}}, {sql.Null[int64]{V: 11, Valid: true}}},
+		},
+		{
+			Id:    sql.NullInt64{Int64: 2, Valid: true},
+			Inner: &Inner{Str: sql.NullString{String: `two`, Valid: true}},
+		},
+	}, results)
+
+	var vals []sql.Null[int64]
+	try(t, Query(ctx, conn, &vals, `select * from (values (1::int8), (null)) as _`, nil))
+	eq(t, []sql.Null[int64]{{V: 1, Valid: true}, {}}, vals)
+
+	var byId map[sql.NullInt64]Outer
+	err := Query(ctx, conn, &byId, `select null::int8 as id`, nil)
+	if !errors.Is(err, ErrNull) {
+		t.Fatalf(`expected ErrNull, got %+v`, err)
+	}
+}
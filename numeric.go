@@ -0,0 +1,93 @@
+package gos
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Decodes a `numeric` column, or any other numeric column, into `big.Int`,
+`big.Rat` or `big.Float`, without losing precision. Drivers typically return
+`numeric` values as decimal strings, which are parsed exactly; integers and
+floats are also accepted. `big.Int` accepts fractional parts consisting of
+zeros, such as "123.00", which is how Postgres formats integral `numeric`
+values with a scale, and rejects other fractional values. `big.Float`
+uses enough precision for every digit of the input, and at least 64 bits.
+Used as a `DecodeFunc` for fields whose type satisfies `isRtypeBigNumber`, and
+for scalar destinations of such types, unless a decoder is registered for the
+field. Pointers are allocated as needed, and nil pointers accept nulls.
+*/
+func decodeBigNumber(src interface{}, dest reflect.Value) error {
+	if dest.Kind() == reflect.Ptr {
+		if src == nil {
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		return decodeBigNumber(src, dest.Elem())
+	}
+
+	if src == nil {
+		return ErrNull.because(fmt.Errorf(`can't decode null into non-nilable %q`, dest.Type()))
+	}
+
+	var str string
+	switch src := src.(type) {
+	case []byte:
+		str = string(src)
+	case string:
+		str = src
+	case int64:
+		str = fmt.Sprint(src)
+	case float64:
+		str = big.NewFloat(src).Text('g', -1)
+	default:
+		return fmt.Errorf(`can't decode %T into %q`, src, dest.Type())
+	}
+
+	var ok bool
+	switch tar := dest.Addr().Interface().(type) {
+	case *big.Int:
+		_, ok = tar.SetString(trimZeroFraction(str), 10)
+	case *big.Rat:
+		_, ok = tar.SetString(str)
+	case *big.Float:
+		prec := uint(len(str) * 4)
+		if prec < 64 {
+			prec = 64
+		}
+		_, ok = tar.SetPrec(prec).SetString(str)
+	}
+
+	if !ok {
+		return fmt.Errorf(`can't decode %q into %q`, str, dest.Type())
+	}
+	return nil
+}
+
+// True for `big.Int`, `big.Rat`, `big.Float`, and pointers to them.
+func isRtypeBigNumber(rtype reflect.Type) bool {
+	rtype = refut.RtypeDeref(rtype)
+	return rtype == bigIntRtype || rtype == bigRatRtype || rtype == bigFloatRtype
+}
+
+/* Internal */
+
+// Removes a fractional part consisting of zeros, such as in "123.00".
+func trimZeroFraction(str string) string {
+	index := strings.IndexByte(str, '.')
+	if index < 0 || strings.Trim(str[index+1:], `0`) != `` {
+		return str
+	}
+	return str[:index]
+}
+
+var bigIntRtype = reflect.TypeOf(big.Int{})
+var bigRatRtype = reflect.TypeOf(big.Rat{})
+var bigFloatRtype = reflect.TypeOf(big.Float{})
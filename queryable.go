@@ -0,0 +1,60 @@
+package gos
+
+import (
+	"context"
+)
+
+/*
+Query text together with its arguments. Implemented by `RawQuery`, by
+`SqlbQuery` for queries built with "github.com/mitranim/sqlb", and may be
+implemented by user-defined query builders, which allows to execute any of them
+polymorphically via `QueryOf` and `QueryScannerOf`.
+*/
+type Queryable interface {
+	QueryArgs() (string, []interface{})
+}
+
+// Implementation of `Queryable` for query text and arguments known in advance.
+type RawQuery struct {
+	Text string
+	Args []interface{}
+}
+
+// Implement `Queryable`.
+func (self RawQuery) QueryArgs() (string, []interface{}) { return self.Text, self.Args }
+
+/*
+Variant of `Query` that takes a `Queryable` instead of separate text and
+arguments. A nil query is equivalent to an empty one. Example:
+
+	err := gos.QueryOf(ctx, conn, &dest, gos.RawQuery{`select * from persons`, nil})
+*/
+func QueryOf(ctx context.Context, conn QueryExecer, dest interface{}, query Queryable) error {
+	return Conf{}.QueryOf(ctx, conn, dest, query)
+}
+
+// Variant of `QueryOf` that uses the given configuration.
+func (self Conf) QueryOf(ctx context.Context, conn QueryExecer, dest interface{}, query Queryable) error {
+	text, args := queryArgs(query)
+	return self.Query(ctx, conn, dest, text, args)
+}
+
+// Variant of `QueryScanner` that takes a `Queryable`. See `QueryOf`.
+func QueryScannerOf(ctx context.Context, conn Queryer, query Queryable) (Scanner, error) {
+	return Conf{}.QueryScannerOf(ctx, conn, query)
+}
+
+// Variant of `QueryScannerOf` that uses the given configuration.
+func (self Conf) QueryScannerOf(ctx context.Context, conn Queryer, query Queryable) (Scanner, error) {
+	text, args := queryArgs(query)
+	return self.QueryScanner(ctx, conn, text, args)
+}
+
+/* Internal */
+
+func queryArgs(query Queryable) (string, []interface{}) {
+	if query == nil {
+		return ``, nil
+	}
+	return query.QueryArgs()
+}
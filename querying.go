@@ -3,9 +3,12 @@ package gos
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/mitranim/refut"
 )
@@ -31,11 +34,24 @@ Example:
 	}
 */
 func QueryScanner(ctx context.Context, conn Queryer, query string, args []interface{}) (Scanner, error) {
-	rows, err := conn.QueryContext(ctx, query, args...)
+	return Conf{}.QueryScanner(ctx, conn, query, args)
+}
+
+// Variant of `QueryScanner` that uses the given configuration.
+func (self Conf) QueryScanner(ctx context.Context, conn Queryer, query string, args []interface{}) (Scanner, error) {
+	var cancel context.CancelFunc
+	if self.RowTimeout > 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	rows, err := queryRows(ctx, conn, query, args)
 	if err != nil {
-		return nil, Err{While: `querying rows`, Cause: err}
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
 	}
-	return &scanner{Rows: rows}, nil
+	return &scanner{Rows: rows, conf: self, cancel: cancel}, nil
 }
 
 /*
@@ -47,19 +63,67 @@ Shortcut for scanning columns into the destination, which may be one of:
 	* Pointer to slice of scalars.
 	* Pointer to single struct.
 	* Pointer to slice of structs.
+	* Pointer to map of structs, keyed by a struct field.
+	* Pointer to `Row` or slice of `Row`.
+	* Pointer to `[]interface{}` or `[][]interface{}`, for raw rows.
+	* Non-pointer `[]interface{}` of scalar pointers, for a single-row tuple.
+	* Channel of any of the above element types, such as `chan T` or `chan *T`.
 
 When the output is nil interface{} or nil pointer, this calls
 `conn.ExecContext`, discarding the result.
 
+When the output is a channel, each row is decoded into a new value and sent on
+the channel, which allows to process rows in another goroutine while decoding
+continues. Sending blocks until the value is received, unless the channel is
+buffered. The channel is closed when this returns: after the last row, after
+an error, or when the context is canceled while sending. Rows are sent as-is,
+without merging one-to-many fields. Example:
+
+	out := make(chan Person, 16)
+	errs := make(chan error, 1)
+	go func() { errs <- gos.Query(ctx, conn, out, query, args) }()
+
+	for person := range out {
+		// Process `person`.
+	}
+	return <-errs
+
 When the output is a slice, the query should use a small `limit`. When
 processing a large data set, prefer `QueryScanner()` to scan rows one-by-one
 without buffering the result.
 
 If the destination is a non-slice, there must be exactly one row. Less or more
-will result in an error. If the destination is a struct, this will decode
+will result in an error. The exception is a pointer to a pointer, such as
+`**T`, which is used for optional rows: zero rows leave the inner pointer nil,
+while one row allocates and fills it. If the destination is a struct, this will decode
 columns into struct fields, following the rules outlined above in the package
 overview.
 
+If the destination is a map of structs, such as `map[int64]Person`, each row
+is stored under the value of the struct field tagged with the `key` option,
+such as `db:"id,key"`, or the field specified via `Conf.MapKey`. The field type
+must be assignable to the map key type, and null keys are rejected with
+`ErrNull`. Several rows with the same key fail with `ErrDuplicateKey`, unless
+`Conf.AllowDuplicateKeys` is set, which keeps the last row, or the struct has
+one-to-many fields, in which case the rows are merged. The map is cleared
+before decoding.
+
+If the destination is `[]interface{}`, it receives the raw values of a single
+row, one per column, as returned by the driver, with nulls represented as nil.
+Similarly, `[][]interface{}` receives one such slice per row. Unlike `Row`,
+this omits column names, which makes it more compact for large exports. Meant
+for generic tooling such as admin panels and data exporters.
+
+If the destination is a non-pointer `[]interface{}`, such as
+`[]interface{}{&id, &name, &count}`, it's a tuple: the columns of a single row
+are scanned into the given pointers by position, like `ScanScalars`, without a
+struct type. The number of pointers must match the number of columns. As usual,
+there must be exactly one row.
+
+If the destination type, or its element type, is an interface registered via
+`RegisterVariants`, each row is decoded into the concrete type selected by its
+discriminator column.
+
 The `select` part of the query should follow the common convention for selecting
 nested fields, see below.
 
@@ -81,39 +145,535 @@ The easiest way to generate the query correctly is by calling `sqlb.Cols(dest)`,
 using the sibling package "github.com/mitranim/sqlb".
 */
 func Query(ctx context.Context, conn QueryExecer, dest interface{}, query string, args []interface{}) error {
+	return Conf{}.Query(ctx, conn, dest, query, args)
+}
+
+// Variant of `Query` that uses the given configuration.
+func (self Conf) Query(ctx context.Context, conn QueryExecer, dest interface{}, query string, args []interface{}) error {
+	if isNilDest(dest) {
+		_, err := execQuery(ctx, conn, query, args)
+		return err
+	}
+	if isChanDest(dest) {
+		_, err := self.queryChan(ctx, conn, dest, query, args)
+		return err
+	}
+	return self.queryInto(ctx, conn, dest, query, args)
+}
+
+/*
+Variant of `Query` that also returns a row count, allowing to log or validate
+result sizes without measuring the destination or issuing a separate count
+query. For slice and map destinations, this is the length of the result, which
+may be smaller than the amount of rows when rows are merged into one-to-many
+fields. For channel destinations, this is the amount of sent rows. For optional
+rows, see `**T` in `Query`, this is 0 when there was no row. For other non-nil
+destinations, this is always 1 on success. For nil destinations, this is the
+amount of affected rows, as reported by `sql.Result.RowsAffected`.
+*/
+func QueryN(ctx context.Context, conn QueryExecer, dest interface{}, query string, args []interface{}) (int64, error) {
+	return Conf{}.QueryN(ctx, conn, dest, query, args)
+}
+
+// Variant of `QueryN` that uses the given configuration.
+func (self Conf) QueryN(ctx context.Context, conn QueryExecer, dest interface{}, query string, args []interface{}) (int64, error) {
 	if isNilDest(dest) {
-		_, err := conn.ExecContext(ctx, query, args...)
+		result, err := execQuery(ctx, conn, query, args)
 		if err != nil {
-			return Err{While: `executing query`, Cause: err}
+			return 0, err
+		}
+
+		count, err := result.RowsAffected()
+		if err != nil {
+			return 0, Err{While: `getting affected row count`, Cause: err}
+		}
+		return count, nil
+	}
+	if isChanDest(dest) {
+		return self.queryChan(ctx, conn, dest, query, args)
+	}
+
+	err := self.queryInto(ctx, conn, dest, query, args)
+	if err != nil {
+		return 0, err
+	}
+
+	if expectManyRows(dest) || expectMapRows(dest) {
+		return int64(refut.RvalDeref(reflect.ValueOf(dest)).Len()), nil
+	}
+	if isOptionalDest(dest) && reflect.ValueOf(dest).Elem().IsNil() {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+/*
+Executes a query that returns several result sets, such as several statements
+separated by semicolons, and decodes each result set into the corresponding
+destination, following the same rules as `Query`. Saves round trips for
+endpoints that need several independent results, such as dashboards:
+
+	var count int64
+	var persons []Person
+	err := gos.QueryMulti(ctx, conn,
+		`select count(*) from persons; select * from persons limit 10`, nil,
+		&count, &persons,
+	)
+
+Nil destinations skip their result sets, which is useful for statements that
+don't return rows. Result sets after the last destination are ignored. Fails
+with `ErrInvalidDest` when there are fewer result sets than destinations.
+Channel destinations aren't supported. Requires a driver that supports
+multiple result sets; with Postgres drivers, statements separated by
+semicolons usually can't have arguments.
+*/
+func QueryMulti(ctx context.Context, conn Queryer, query string, args []interface{}, dests ...interface{}) error {
+	return Conf{}.QueryMulti(ctx, conn, query, args, dests...)
+}
+
+// Variant of `QueryMulti` that uses the given configuration.
+func (self Conf) QueryMulti(ctx context.Context, conn Queryer, query string, args []interface{}, dests ...interface{}) error {
+	for _, dest := range dests {
+		if isNilDest(dest) {
+			continue
+		}
+		err := validateDestPtrOrTuple(dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	scan, err := self.QueryScanner(ctx, conn, query, args)
+	if err != nil {
+		return err
+	}
+	defer scan.Close()
+
+	for i, dest := range dests {
+		if i > 0 && !NextResultSet(scan) {
+			err := scan.Err()
+			if err != nil {
+				return Err{While: `advancing result set`, Cause: err}
+			}
+			return ErrInvalidDest.while(`decoding result sets`).because(fmt.Errorf(
+				`expected %v result sets, got %v`, len(dests), i,
+			))
+		}
+
+		if isNilDest(dest) {
+			continue
+		}
+
+		err := self.scanInto(dest, scan)
+		if err != nil {
+			return Err{While: fmt.Sprintf(`decoding result set %v`, i), Cause: err}
 		}
-		return nil
 	}
+	return nil
+}
+
+/*
+Variant of `Query` for a single non-slice destination, which decodes the first
+row and stops reading, instead of failing with `ErrMultipleRows` when there
+are more. Useful for "any one example row" queries, without an artificial
+`limit 1`. Still fails with `ErrNoRows` when there are no rows. For
+deterministic results, the query should use `order by`.
+*/
+func QueryFirst(ctx context.Context, conn Queryer, dest interface{}, query string, args []interface{}) error {
+	return Conf{}.QueryFirst(ctx, conn, dest, query, args)
+}
+
+// Variant of `QueryFirst` that uses the given configuration.
+func (self Conf) QueryFirst(ctx context.Context, conn Queryer, dest interface{}, query string, args []interface{}) error {
+	err := validateDestPtrOrTuple(dest)
+	if err != nil {
+		return err
+	}
+
+	if expectManyRows(dest) || expectMapRows(dest) {
+		return ErrInvalidDest.while(`querying first row`).because(fmt.Errorf(
+			`destination must not be a slice or map, received %#v`, dest,
+		))
+	}
+
+	scan, err := self.QueryScanner(ctx, conn, query, args)
+	if err != nil {
+		return err
+	}
+	defer scan.Close()
+
+	if !scan.Next() {
+		return scanNoRows(dest, scan)
+	}
+	return scan.Scan(dest)
+}
 
+/*
+Shortcut for partial selection: uses `Cols` with the given mask to select only
+the requested fields of the destination, wrapping the query as follows:
+
+	select <Cols(dest, mask...)> from (<query>) as _
+
+...and decodes the result via `Query`. The inner query must select the columns
+of the destination by their own names, with each nested struct selected as a
+single composite column, typically via `select *` from a table or via
+`ColsComposite(dest)`. The aliased columns generated by `Cols(dest)` don't
+work here, because the outer select refers to nested fields as attributes of
+composite columns, such as `("inner")."inner_val"`. Fields excluded by the mask
+have no matching columns and are left untouched, as usual. This allows
+GraphQL-style per-request field selection against a single canonical struct,
+without defining trimmed copies of the struct. The destination must be a struct
+or a slice of structs.
+
+Because masks are typically derived from request input, an invalid mask path
+produces `ErrInvalidInput` rather than a panic. For the same reason, neither
+the generated column list nor the decoding spec is cached, as if using
+`Conf.NoCache`, so distinct masks don't accumulate in memory.
+*/
+func QueryMasked(ctx context.Context, conn QueryExecer, dest interface{}, query string, args []interface{}, mask []string) error {
 	err := validateDestPtr(dest)
 	if err != nil {
 		return err
 	}
 
-	scan, err := QueryScanner(ctx, conn, query, args)
+	rtype := refut.RtypeDeref(reflect.TypeOf(dest))
+	if rtype.Kind() == reflect.Slice {
+		rtype = refut.RtypeDeref(rtype.Elem())
+	}
+	if rtype.Kind() != reflect.Struct {
+		return ErrInvalidDest.while(`querying masked columns`).because(fmt.Errorf(
+			`destination must be a struct or a slice of structs, received %#v`, dest,
+		))
+	}
+
+	cols, err := colsMasked(rtype, mask)
+	if err != nil {
+		return err
+	}
+
+	wrapped := wrapSelect(query, cols)
+	ctx, err = guardWrapped(ctx, query, wrapped)
+	if err != nil {
+		return err
+	}
+	return Conf{NoCache: true}.Query(ctx, conn, dest, wrapped, args)
+}
+
+/*
+Alternative to `Query` for deeply nested results, where the aliasing convention
+described in the package overview becomes unwieldy. Wraps the query as follows:
+
+	select to_jsonb(_) from (<query>) as _
+
+...and decodes each resulting JSON record into the destination via
+`encoding/json`. Row count follows the same rules as in `Query`: a single
+struct or map requires exactly one row, while a slice collects every row.
+Unlike `Query`, field mapping is determined by `json` tags rather than `db`
+tags, and nested records may be selected as-is, without aliasing.
+
+Requires Postgres or another database that supports `to_jsonb`.
+*/
+func QueryJson(ctx context.Context, conn Queryer, dest interface{}, query string, args []interface{}) error {
+	wrapped := jsonQuery(query)
+	ctx, err := guardWrapped(ctx, query, wrapped)
+	if err != nil {
+		return err
+	}
+	return QueryJsonCol(ctx, conn, dest, wrapped, args)
+}
+
+/*
+Variant of `QueryJson` that doesn't wrap the query. Instead, each row must
+consist of exactly one JSON column, which is decoded into the destination via
+`encoding/json`. Meant for queries using `ColsJson`:
+
+	query := fmt.Sprintf(`select %v from some_table`, ColsJson(result))
+	err := QueryJsonCol(ctx, conn, &result, query, args)
+*/
+func QueryJsonCol(ctx context.Context, conn Queryer, dest interface{}, query string, args []interface{}) error {
+	err := validateDestPtr(dest)
+	if err != nil {
+		return err
+	}
+
+	rows, err := queryRows(ctx, conn, query, args)
 	if err != nil {
 		return err
 	}
+
+	scan := jsonScanner{rows}
 	defer scan.Close()
 
-	if expectManyRows(dest) {
-		return scanMany(dest, scan)
+	if rtypeDerefKind(reflect.TypeOf(dest)) == reflect.Slice {
+		return scanMany(dest, scan, Conf{})
 	}
 	return scanOne(dest, scan)
 }
 
+/*
+Decodes a two-column result into a map, using the first column as the key and
+the second column as the value. Avoids defining a throwaway struct for the
+common lookup query:
+
+	names, err := gos.QueryMap[int64, string](ctx, conn, `select id, name from persons`, nil)
+
+Both types are decoded like scalars: they must be supported by the driver or
+implement `sql.Scanner`. Fails with `ErrInvalidDest` if the result doesn't
+have exactly two columns, and with `ErrDuplicateKey` if several rows have the
+same key. To keep the last value instead, use `QueryMapConf` with
+`Conf.AllowDuplicateKeys`. The result is non-nil even when there are no rows.
+*/
+func QueryMap[K comparable, V any](ctx context.Context, conn Queryer, query string, args []interface{}) (map[K]V, error) {
+	return QueryMapConf[K, V](ctx, conn, Conf{}, query, args)
+}
+
+// Variant of `QueryMap` that uses the given configuration.
+func QueryMapConf[K comparable, V any](ctx context.Context, conn Queryer, conf Conf, query string, args []interface{}) (map[K]V, error) {
+	rows, err := queryRows(ctx, conn, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	colNames, err := rows.Columns()
+	if err != nil {
+		return nil, Err{While: `getting columns`, Cause: err}
+	}
+	if len(colNames) != 2 {
+		return nil, ErrInvalidDest.while(`decoding map`).because(fmt.Errorf(
+			`expected 2 columns, got %v`, len(colNames),
+		))
+	}
+
+	out := map[K]V{}
+	for rows.Next() {
+		var key K
+		var val V
+		err := rows.Scan(&key, &val)
+		if err != nil {
+			return nil, ErrScan.because(err)
+		}
+
+		if !conf.AllowDuplicateKeys {
+			_, ok := out[key]
+			if ok {
+				return nil, ErrDuplicateKey.while(`decoding map`).because(fmt.Errorf(
+					`duplicate key %v`, key,
+				))
+			}
+		}
+		out[key] = val
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Err{While: `iterating rows`, Cause: err}
+	}
+	return out, nil
+}
+
+/*
+Decodes a single-column result into a set, for membership checks:
+
+	banned, err := gos.QueryScalarSet[int64](ctx, conn, `select id from banned_persons`, nil)
+	_, isBanned := banned[id]
+
+The type is decoded like a scalar: it must be supported by the driver or
+implement `sql.Scanner`. Fails with `ErrInvalidDest` if the result doesn't
+have exactly one column. Duplicate values are ignored. The result is non-nil
+even when there are no rows.
+*/
+func QueryScalarSet[T comparable](ctx context.Context, conn Queryer, query string, args []interface{}) (map[T]struct{}, error) {
+	rows, err := queryRows(ctx, conn, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	colNames, err := rows.Columns()
+	if err != nil {
+		return nil, Err{While: `getting columns`, Cause: err}
+	}
+	if len(colNames) != 1 {
+		return nil, ErrInvalidDest.while(`decoding set`).because(fmt.Errorf(
+			`expected 1 column, got %v`, len(colNames),
+		))
+	}
+
+	out := map[T]struct{}{}
+	for rows.Next() {
+		var val T
+		err := rows.Scan(&val)
+		if err != nil {
+			return nil, ErrScan.because(err)
+		}
+		out[val] = struct{}{}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Err{While: `iterating rows`, Cause: err}
+	}
+	return out, nil
+}
+
 /* Internal */
 
 const expectedStructDepth = 8
 
+/*
+Implements `Conf.Query` for non-nil destinations, which only requires
+`Queryer`.
+*/
+func (self Conf) queryInto(ctx context.Context, conn Queryer, dest interface{}, query string, args []interface{}) error {
+	err := validateDestPtrOrTuple(dest)
+	if err != nil {
+		return err
+	}
+
+	scan, err := self.QueryScanner(ctx, conn, query, args)
+	if err != nil {
+		return err
+	}
+	defer scan.Close()
+
+	return self.scanInto(dest, scan)
+}
+
+/*
+Implements channel destinations of `Query`. Closes the channel in all cases,
+except when it's nil or receive-only. Returns the amount of sent rows, which
+may be non-zero on error.
+*/
+func (self Conf) queryChan(ctx context.Context, conn Queryer, dest interface{}, query string, args []interface{}) (int64, error) {
+	chanRval := reflect.ValueOf(dest)
+	if chanRval.IsNil() || chanRval.Type().ChanDir()&reflect.SendDir == 0 {
+		return 0, ErrInvalidDest.because(fmt.Errorf(
+			`destination channel must be non-nil and support sending, received %#v`, dest,
+		))
+	}
+	defer chanRval.Close()
+
+	scan, err := self.QueryScanner(ctx, conn, query, args)
+	if err != nil {
+		return 0, err
+	}
+	defer scan.Close()
+
+	elemRtype := chanRval.Type().Elem()
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: chanRval},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+
+	var count int64
+	for scan.Next() {
+		ptrRval := reflect.New(elemRtype)
+
+		err := scan.Scan(ptrRval.Interface())
+		if err != nil {
+			return count, err
+		}
+
+		cases[0].Send = ptrRval.Elem()
+		chosen, _, _ := reflect.Select(cases)
+		if chosen != 0 {
+			return count, Err{While: `sending row`, Cause: ctx.Err()}
+		}
+		count++
+	}
+
+	err = scan.Err()
+	if err != nil {
+		return count, Err{While: `iterating rows`, Cause: err}
+	}
+	return count, nil
+}
+
+// Shared by `Conf.queryInto` and `Conf.ScanRows`.
+func (self Conf) scanInto(dest interface{}, scan Scanner) error {
+	if isTupleDest(dest) {
+		return scanTuple(dest, scan)
+	}
+	if expectManyRows(dest) {
+		return scanMany(dest, scan, self)
+	}
+	if expectMapRows(dest) {
+		return scanMap(dest, scan, self)
+	}
+	return scanOne(dest, scan)
+}
+
+/*
+Single entry point for queries, which checks the query guard, converts
+arguments, records audit entries, and wraps errors.
+*/
+func queryRows(ctx context.Context, conn Queryer, query string, args []interface{}) (*sql.Rows, error) {
+	err := guardQueryCtx(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := convertArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	done := auditStart(ctx, query, args)
+	rows, err := conn.QueryContext(ctx, query, converted...)
+	if done != nil {
+		done(err)
+	}
+
+	if err != nil {
+		return nil, Err{While: `querying rows`, Cause: err}
+	}
+	return rows, nil
+}
+
+/*
+Single entry point for execution, which checks the query guard, converts
+arguments, records audit entries, and wraps errors.
+*/
+func execQuery(ctx context.Context, conn Execer, query string, args []interface{}) (sql.Result, error) {
+	err := guardQueryCtx(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := convertArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	done := auditStart(ctx, query, args)
+	res, err := conn.ExecContext(ctx, query, converted...)
+	if done != nil {
+		done(err)
+	}
+
+	if err != nil {
+		return nil, Err{While: `executing query`, Cause: err}
+	}
+	return res, nil
+}
+
 type tDestSpec struct {
-	colNames  []string
-	colRtypes map[string]reflect.Type
-	typeSpec  tTypeSpec
+	colNames   []string
+	colDbTypes []string // Only when needed for decoders; may be nil.
+	colRtypes  map[string]reflect.Type
+	typeSpec   tTypeSpec
+	opts       tSpecOpts
+	decode     tDecodeStep // Compiled from `typeSpec`.
+}
+
+// Subset of `Conf` that affects decoding specs.
+type tSpecOpts struct {
+	coerce            bool
+	zeroNullStructs   bool
+	ignoreUnknownCols bool
+	strictFields      bool
+	positional        bool
 }
 
 type tTypeSpec struct {
@@ -129,143 +689,1010 @@ type tFieldSpec struct {
 	colAlias        string
 	colIndex        int // Must be initialized to -1.
 	sfield          reflect.StructField
+	decoder         DecodeFunc
+	many            bool // One-to-many field, see `isRtypeManyStruct`.
 }
 
-type tDecodeState struct {
-	colPtrs []interface{}
+/*
+Decodes the current row, whose columns have been scanned into the state, into
+the root struct. See `compileTypeSpec`.
+*/
+type tDecodeStep func(rootRval reflect.Value, state *tDecodeState) error
+
+/*
+Holds the scanned columns of the current row. Reused across rows, since
+scanning allocates new column values rather than overwriting the old ones.
+*/
+type tDecodeState struct {
+	colPtrs []interface{}
+}
+
+// Returns the scanned value of the column, which is a nilable pointer.
+func (self *tDecodeState) colRval(index int) reflect.Value {
+	return reflect.ValueOf(self.colPtrs[index]).Elem()
+}
+
+func (self *tDecodeState) isEveryColNil(indexes []int) bool {
+	for _, index := range indexes {
+		if !self.colRval(index).IsNil() {
+			return false
+		}
+	}
+	return true
 }
 
-func scanMany(dest interface{}, scan Scanner) error {
+func scanMany(dest interface{}, scan Scanner, conf Conf) error {
 	rval := reflect.ValueOf(dest)
 	sliceRval := refut.RvalDerefAlloc(rval)
 	truncateSliceRval(sliceRval)
 
 	elemRtype := rtypeDerefElem(rval.Type())
+	var merge *tManyMerge
+	var prepared bool
+	var count int
 
 	for scan.Next() {
+		err := conf.checkMaxRows(count)
+		if err != nil {
+			return err
+		}
+		count++
+
 		ptrRval := reflect.New(elemRtype)
 
-		err := scan.Scan(ptrRval.Interface())
+		err = scan.Scan(ptrRval.Interface())
+		if err != nil {
+			return err
+		}
+
+		if !prepared {
+			prepared = true
+			merge, err = prepareManyMerge(scan, elemRtype)
+			if err != nil {
+				return err
+			}
+		}
+		if merge.add(sliceRval, ptrRval.Elem()) {
+			continue
+		}
+
+		sliceRval.Set(reflect.Append(sliceRval, ptrRval.Elem()))
+	}
+
+	err := scan.Err()
+	if err != nil {
+		return Err{While: `iterating rows`, Cause: err}
+	}
+	return nil
+}
+
+func scanOne(dest interface{}, scan Scanner) error {
+	if !scan.Next() {
+		return scanNoRows(dest, scan)
+	}
+
+	err := scan.Scan(dest)
+	if err != nil {
+		return err
+	}
+
+	rval := reflect.ValueOf(dest).Elem()
+	merge, err := prepareManyMerge(scan, rval.Type())
+	if err != nil {
+		return err
+	}
+	if merge != nil {
+		return merge.addRest(rval, scan)
+	}
+
+	if scan.Next() {
+		return ErrMultipleRows.while(`verifying row count`)
+	}
+	return nil
+}
+
+/*
+Decodes rows into a map of structs, keyed by the key field, see
+`Conf.MapKey`. Rows with the same key are merged when the struct has
+one-to-many fields, and are otherwise duplicates.
+*/
+func scanMap(dest interface{}, scan Scanner, conf Conf) error {
+	mapRval := refut.RvalDerefAlloc(reflect.ValueOf(dest))
+	if mapRval.IsNil() {
+		mapRval.Set(reflect.MakeMap(mapRval.Type()))
+	} else {
+		clearMapRval(mapRval)
+	}
+
+	elemRtype := mapRval.Type().Elem()
+	keyPath, err := mapKeyPath(elemRtype, mapRval.Type().Key(), conf.MapKey)
+	if err != nil {
+		return err
+	}
+
+	var level *tManyLevel
+	var states tManySlice // Merge states by map key.
+	var prepared bool
+	var count int
+
+	for scan.Next() {
+		err := conf.checkMaxRows(count)
+		if err != nil {
+			return err
+		}
+		count++
+
+		ptrRval := reflect.New(elemRtype)
+
+		err = scan.Scan(ptrRval.Interface())
+		if err != nil {
+			return err
+		}
+
+		if !prepared {
+			prepared = true
+			level, err = prepareManyLevel(scan, elemRtype)
+			if err != nil {
+				return err
+			}
+		}
+
+		key := rvalKey(ptrRval.Elem(), keyPath)
+		if key == nil {
+			return ErrNull.while(`decoding map`).because(fmt.Errorf(`null key`))
+		}
+		keyRval := reflect.ValueOf(key)
+
+		prev := mapRval.MapIndex(keyRval)
+		if prev.IsValid() && level != nil {
+			// Map elements are not addressable.
+			tar := reflect.New(elemRtype).Elem()
+			tar.Set(prev)
+			level.merge(tar, ptrRval.Elem(), states.fieldSlices(key, level))
+			mapRval.SetMapIndex(keyRval, tar)
+			continue
+		}
+
+		if prev.IsValid() && !conf.AllowDuplicateKeys {
+			return ErrDuplicateKey.while(`decoding map`).because(fmt.Errorf(
+				`duplicate key %v`, key,
+			))
+		}
+		mapRval.SetMapIndex(keyRval, ptrRval.Elem())
+	}
+
+	err = scan.Err()
+	if err != nil {
+		return Err{While: `iterating rows`, Cause: err}
+	}
+	return nil
+}
+
+/*
+Returns the path to the field that provides map keys: the field with the given
+column name, or the field tagged with the "key" option.
+*/
+func mapKeyPath(rtype, keyRtype reflect.Type, colName string) ([]int, error) {
+	var path []int
+	var err error
+
+	if colName == `` {
+		path, err = structKeyPath(rtype)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err = traverseStructRtype(rtype, func(sfield reflect.StructField, fieldPath []int) error {
+			if path == nil && sfieldColumnName(sfield) == colName {
+				path = copyIntSlice(fieldPath)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if path == nil {
+		return nil, ErrInvalidDest.while(`decoding map`).because(fmt.Errorf(
+			`type %q has no key field; tag the key with "key", for example: db:"id,key", or use Conf.MapKey`,
+			refut.RtypeDeref(rtype),
+		))
+	}
+
+	fieldRtype := refut.RtypeDeref(refut.RtypeDeref(rtype).FieldByIndex(path).Type)
+	if !fieldRtype.AssignableTo(keyRtype) {
+		return nil, ErrInvalidDest.while(`decoding map`).because(fmt.Errorf(
+			`key field of type %q is not assignable to map key type %q`, fieldRtype, keyRtype,
+		))
+	}
+	return path, nil
+}
+
+/*
+Implements `ScanChunk` on top of `Scanner.Next` and `Scanner.Scan`. Each
+slice element is decoded via a pointer to it, which means the elements of a
+preallocated slice are reused between chunks.
+*/
+func scanChunk(scan Scanner, dest interface{}, n int) (int, error) {
+	rval := reflect.ValueOf(dest)
+	if rval.Kind() != reflect.Slice {
+		return 0, ErrInvalidDest.while(`scanning chunk`).because(fmt.Errorf(
+			`destination must be a slice, received %#v`, dest,
+		))
+	}
+
+	if n > rval.Len() {
+		n = rval.Len()
+	}
+
+	for count := 0; count < n; count++ {
+		if !scan.Next() {
+			err := scan.Err()
+			if err != nil {
+				return count, Err{While: `scanning chunk`, Cause: err}
+			}
+			return count, nil
+		}
+
+		err := scan.Scan(rval.Index(count).Addr().Interface())
+		if err != nil {
+			return count, err
+		}
+	}
+	return n, nil
+}
+
+/*
+Implements `ScanSlice` on top of `scanChunk`. The slice is grown to N
+elements when needed, preserving the existing ones, and then truncated to the
+amount of decoded rows.
+*/
+func scanSlice(scan Scanner, dest interface{}, n int) (int, error) {
+	rval := reflect.ValueOf(dest)
+	if rval.Kind() != reflect.Ptr || rval.IsNil() || rval.Elem().Kind() != reflect.Slice {
+		return 0, ErrInvalidDest.while(`scanning slice`).because(fmt.Errorf(
+			`destination must be a non-nil slice pointer, received %#v`, dest,
+		))
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	sliceRval := rval.Elem()
+	if sliceRval.Cap() < n {
+		grown := reflect.MakeSlice(sliceRval.Type(), n, n)
+		reflect.Copy(grown, sliceRval)
+		sliceRval.Set(grown)
+	} else {
+		sliceRval.SetLen(n)
+	}
+
+	count, err := scanChunk(scan, sliceRval.Interface(), n)
+	sliceRval.SetLen(count)
+	return count, err
+}
+
+// Implements tuple destinations of `Scanner.Scan`, see `ScanScalars`.
+func scanScalars(rows Rows, dests []interface{}) error {
+	for _, dest := range dests {
+		err := validateDestPtr(dest)
 		if err != nil {
 			return err
 		}
-
-		sliceRval.Set(reflect.Append(sliceRval, ptrRval.Elem()))
 	}
 
-	return nil
-}
+	err := rows.Scan(dests...)
+	if err != nil {
+		return ErrScan.because(err)
+	}
+	return nil
+}
+
+/*
+Implements tuple destinations of `Query`, which require exactly one row, see
+`isTupleDest`.
+*/
+func scanTuple(dest interface{}, scan Scanner) error {
+	if !scan.Next() {
+		return scanNoRows(dest, scan)
+	}
+
+	err := scan.Scan(dest)
+	if err != nil {
+		return err
+	}
+
+	if scan.Next() {
+		return ErrMultipleRows.while(`verifying row count`)
+	}
+	return nil
+}
+
+/*
+Handles the absence of rows for a single-row destination. For optional
+destinations, this is not an error, see `isOptionalDest`.
+*/
+func scanNoRows(dest interface{}, scan Scanner) error {
+	err := scan.Err()
+	if err != nil {
+		return Err{While: `preparing row`, Cause: err}
+	}
+
+	if isOptionalDest(dest) {
+		rvalZero(reflect.ValueOf(dest).Elem())
+		return nil
+	}
+	return ErrNoRows.while(`preparing row`)
+}
+
+/*
+True for pointers to pointers, such as `**T`. Zero rows leave the inner pointer
+nil, mirroring the convention for nilable nested structs.
+*/
+func isOptionalDest(dest interface{}) bool {
+	rtype := reflect.TypeOf(dest)
+	return rtype != nil && rtype.Kind() == reflect.Ptr && rtype.Elem().Kind() == reflect.Ptr
+}
+
+type scanner struct {
+	Rows
+	conf     Conf
+	rtype    reflect.Type // Destination type of the current `Scan` call.
+	typ      *tScanType   // State of `rtype`.
+	types    map[reflect.Type]*tScanType
+	hasRow   bool      // Rows are at a row which isn't captured in `replay`.
+	decoded  bool      // Current row was counted in `ScanStats.Rows`.
+	replay   *tRawRows // Current row, when fetched ahead by `Peek`.
+	peeked   *tRawRows // Next row, when fetched ahead by `Peek`.
+	cancel   context.CancelFunc // Only with `Conf.RowTimeout`.
+	timedOut int32              // Accessed atomically.
+	stats    ScanStats
+}
+
+/*
+Decoding state specific to a destination type and a result set. The scanner
+keeps one per destination type, which allows to decode the same rows into
+different types, such as a summary struct and a detail struct.
+*/
+type tScanType struct {
+	spec        *tDestSpec
+	state       *tDecodeState // Reused across rows, see `tDecodeState`.
+	mapping     *tMapping
+	variantScan *tVariantScan
+}
+
+// Sets the destination type of the current `Scan` call, see `tScanType`.
+func (self *scanner) setType(rtype reflect.Type) {
+	if rtype == self.rtype {
+		return
+	}
+
+	typ := self.types[rtype]
+	if typ == nil {
+		typ = &tScanType{}
+		if self.types == nil {
+			self.types = map[reflect.Type]*tScanType{}
+		}
+		self.types[rtype] = typ
+	}
+
+	self.rtype = rtype
+	self.typ = typ
+}
+
+func (self *scanner) Next() bool {
+	self.decoded = false
+	if self.peeked != nil {
+		self.replay, self.peeked = self.peeked, nil
+		return true
+	}
+	self.replay = nil
+
+	start := time.Now()
+	ok := self.next()
+	self.stats.WaitTime += time.Since(start)
+	self.hasRow = ok
+	return ok
+}
+
+func (self *scanner) next() bool {
+	if self.cancel == nil {
+		return self.Rows.Next()
+	}
+
+	timer := time.AfterFunc(self.conf.RowTimeout, self.timeout)
+	defer timer.Stop()
+	return self.Rows.Next()
+}
+
+func (self *scanner) Err() error {
+	if self.isTimedOut() {
+		return self.timeoutErr()
+	}
+	return self.Rows.Err()
+}
+
+func (self *scanner) Close() error {
+	err := self.Rows.Close()
+	if self.cancel != nil {
+		self.cancel()
+	}
+	return err
+}
+
+func (self *scanner) timeout() {
+	atomic.StoreInt32(&self.timedOut, 1)
+	self.cancel()
+}
+
+func (self *scanner) isTimedOut() bool {
+	return atomic.LoadInt32(&self.timedOut) != 0
+}
+
+func (self *scanner) timeoutErr() error {
+	return ErrTimeout.while(`fetching row`).because(fmt.Errorf(
+		`row fetch exceeded timeout %v`, self.conf.RowTimeout,
+	))
+}
+
+func (self *scanner) Scan(dest interface{}) error {
+	start := time.Now()
+	var err error
+	if self.replay != nil {
+		err = self.scanFrom(self.replay, dest)
+	} else {
+		err = self.scan(dest)
+	}
+	self.stats.DecodeTime += time.Since(start)
+
+	// The same row may be decoded several times, but is counted once.
+	if err == nil && !self.decoded {
+		self.decoded = true
+		self.stats.Rows++
+	}
+	return err
+}
+
+func (self *scanner) scan(dest interface{}) error {
+	if self.isTimedOut() {
+		return self.timeoutErr()
+	}
+
+	tuple, ok := dest.([]interface{})
+	if ok {
+		err := scanScalars(self.Rows, tuple)
+		if err == nil {
+			self.countBytes(tuple...)
+		}
+		return err
+	}
+
+	rval := reflect.ValueOf(dest)
+
+	err := validateDestPtr(dest)
+	if err != nil {
+		return err
+	}
+
+	rtype := rval.Type()
+	self.setType(rtype)
+
+	switch rowDestKind(rtype.Elem()) {
+	case rowDestRow:
+		row := dest.(*Row)
+		err := row.scan(self.Rows)
+		if err == nil {
+			self.countBytes(row.vals...)
+		}
+		return err
+
+	case rowDestRaw:
+		vals := dest.(*[]interface{})
+		err := scanRawRow(self.Rows, vals)
+		if err == nil {
+			self.countBytes(*vals...)
+		}
+		return err
+
+	case rowDestRowScanner:
+		return self.scanRowScanner(refut.RvalDerefAlloc(rval).Addr().Interface().(RowScanner))
+
+	case rowDestMapper:
+		mapper, _ := getMapper(rtype.Elem())
+		return self.scanMapped(dest, mapper)
+
+	case rowDestVariants:
+		variants, _ := getVariants(rtype.Elem())
+		return self.scanVariant(rval, variants)
+
+	case rowDestDecoder:
+		return self.scanScalarVia(dest, findTypeDecoder(rtype.Elem()))
+
+	case rowDestStruct:
+		return self.scanStruct(rval)
+
+	default:
+		return self.scanScalar(dest)
+	}
+}
+
+func (self *scanner) Peek(dest interface{}) error {
+	if self.isTimedOut() {
+		return self.timeoutErr()
+	}
+
+	if self.peeked == nil {
+		err := self.fetchAhead()
+		if err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	err := self.scanFrom(self.peeked, dest)
+	self.stats.DecodeTime += time.Since(start)
+	return err
+}
+
+/*
+Fetches the next row ahead of `Next`, for `PeekRow`. The current row is
+first captured as raw values, since the rows can't go back to it.
+*/
+func (self *scanner) fetchAhead() error {
+	if self.hasRow {
+		row, err := self.rawRow()
+		if err != nil {
+			return err
+		}
+		self.replay = row
+		self.hasRow = false
+	}
+
+	start := time.Now()
+	ok := self.next()
+	self.stats.WaitTime += time.Since(start)
+
+	if !ok {
+		err := self.Err()
+		if err != nil {
+			return Err{While: `peeking row`, Cause: err}
+		}
+		return ErrNoRows.while(`peeking row`)
+	}
+
+	row, err := self.rawRow()
+	if err != nil {
+		return err
+	}
+	self.peeked = row
+	return nil
+}
+
+// Captures the raw values of the current row, see `tRawRows`.
+func (self *scanner) rawRow() (*tRawRows, error) {
+	cols, err := self.Rows.Columns()
+	if err != nil {
+		return nil, Err{While: `getting columns`, Cause: err}
+	}
+
+	dbTypes, err := rowsColDbTypes(self.Rows)
+	if err != nil {
+		return nil, err
+	}
+
+	vals, err := scanRawVals(self.Rows, len(cols))
+	if err != nil {
+		return nil, err
+	}
+	return &tRawRows{cols: cols, dbTypes: dbTypes, vals: vals}, nil
+}
+
+/*
+Decodes a row fetched ahead by `Peek` by temporarily substituting the rows.
+Decoding state is shared with the actual rows, since the columns are the same.
+*/
+func (self *scanner) scanFrom(rows *tRawRows, dest interface{}) error {
+	prev := self.Rows
+	self.Rows = rows
+	defer func() { self.Rows = prev }()
+	return self.scan(dest)
+}
+
+func (self *scanner) Stats() ScanStats { return self.stats }
+
+/*
+Resets the decoding state of every destination type, which is specific to each
+result set. Rows other than `*sql.Rows` may support multiple result sets by
+implementing the same method, see `Rows`.
+*/
+func (self *scanner) NextResultSet() bool {
+	rows, ok := self.Rows.(tRowsNextResultSet)
+	if !ok || !rows.NextResultSet() {
+		return false
+	}
+
+	self.rtype = nil
+	self.typ = nil
+	self.types = nil
+	self.hasRow = false
+	self.decoded = false
+	self.replay = nil
+	self.peeked = nil
+	return true
+}
+
+/*
+Adds the sizes of text and binary values to the stats. Takes column values or
+pointers to them, as passed to `(*sql.Rows).Scan`.
+*/
+func (self *scanner) countBytes(vals ...interface{}) {
+	for _, val := range vals {
+		rval := reflect.ValueOf(val)
+		for (rval.Kind() == reflect.Ptr || rval.Kind() == reflect.Interface) && !rval.IsNil() {
+			rval = rval.Elem()
+		}
+
+		switch {
+		case rval.Kind() == reflect.String:
+			self.stats.Bytes += int64(rval.Len())
+		case rval.Kind() == reflect.Slice && rval.Type().Elem().Kind() == reflect.Uint8:
+			self.stats.Bytes += int64(rval.Len())
+		}
+	}
+}
+
+func (self *scanner) scanRowScanner(dest RowScanner) error {
+	cols, err := self.Rows.Columns()
+	if err != nil {
+		return Err{While: `getting columns`, Cause: err}
+	}
+
+	vals, err := scanRawVals(self.Rows, len(cols))
+	if err != nil {
+		return err
+	}
+	self.countBytes(vals...)
+
+	err = dest.ScanRow(cols, vals)
+	if err != nil {
+		return Err{Code: ErrCodeScan, While: `decoding via ScanRow`, Cause: err}
+	}
+	return nil
+}
+
+func (self *scanner) scanMapped(dest interface{}, mapper tMapper) error {
+	if self.typ.mapping == nil {
+		colNames, err := self.Rows.Columns()
+		if err != nil {
+			return Err{While: `getting columns`, Cause: err}
+		}
+
+		mapping, err := prepareMapping(colNames, self.rtype.Elem(), mapper, self.conf.IgnoreUnknownCols)
+		if err != nil {
+			return err
+		}
+		self.typ.mapping = mapping
+	}
+
+	return self.typ.mapping.decode(self.Rows, dest)
+}
+
+func (self *scanner) scanStruct(rval reflect.Value) error {
+	typ := self.typ
+
+	if typ.spec == nil {
+		spec, err := prepareDestSpec(self.Rows, self.rtype, self.conf)
+		if err != nil {
+			return err
+		}
+		typ.spec = spec
+	}
+
+	if typ.state == nil {
+		state, err := prepareDecodeState(self.Rows, typ.spec)
+		if err != nil {
+			return err
+		}
+		typ.state = state
+	}
+
+	err := self.Rows.Scan(typ.state.colPtrs...)
+	if err != nil {
+		return ErrScan.because(err)
+	}
+	self.countBytes(typ.state.colPtrs...)
+
+	if reflect.PtrTo(refut.RtypeDeref(self.rtype)).Implements(beforeScannerRtype) {
+		err := refut.RvalDerefAlloc(rval).Addr().Interface().(BeforeScanner).BeforeScan()
+		if err != nil {
+			return Err{Code: ErrCodeScan, While: `calling BeforeScan`, Cause: err}
+		}
+	}
+
+	return typ.spec.decode(rval, typ.state)
+}
+
+func (self *scanner) scanScalar(dest interface{}) error {
+	fun := builtinScalarDecoder(self.rtype.Elem(), self.conf)
+	if fun != nil {
+		return self.scanScalarVia(dest, fun)
+	}
+
+	err := self.Rows.Scan(dest)
+	if err != nil {
+		return ErrScan.because(err)
+	}
+	self.countBytes(dest)
+	return nil
+}
+
+// Scans the raw column value and decodes it via the given function.
+func (self *scanner) scanScalarVia(dest interface{}, fun DecodeFunc) error {
+	var src interface{}
+	err := self.Rows.Scan(&src)
+	if err != nil {
+		return ErrScan.because(err)
+	}
+	self.countBytes(src)
+
+	err = fun(src, reflect.ValueOf(dest).Elem())
+	if err != nil {
+		return Err{Code: ErrCodeScan, While: `decoding scalar`, Cause: err}
+	}
+	return nil
+}
+
+/*
+Decodes each row, which must consist of exactly one JSON column, into the
+output. Used by `QueryJson`.
+*/
+type jsonScanner struct{ *sql.Rows }
+
+func (self jsonScanner) Scan(dest interface{}) error {
+	err := validateDestPtr(dest)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	err = self.Rows.Scan(&buf)
+	if err != nil {
+		return ErrScan.because(err)
+	}
+
+	err = json.Unmarshal(buf, dest)
+	if err != nil {
+		return Err{Code: ErrCodeScan, While: `decoding JSON`, Cause: err}
+	}
+	return nil
+}
+
+func prepareDestSpec(rows Rows, rtype reflect.Type, conf Conf) (*tDestSpec, error) {
+	if rtype == nil || rtype.Kind() != reflect.Ptr || rtypeDerefKind(rtype) != reflect.Struct {
+		return nil, Err{
+			Code:  ErrCodeInvalidDest,
+			While: `preparing destination spec`,
+			Cause: fmt.Errorf(`expected destination type to be a struct pointer, got %q`, rtype),
+		}
+	}
+
+	colNames, err := rows.Columns()
+	if err != nil {
+		return nil, Err{While: `getting columns`, Cause: err}
+	}
 
-func scanOne(dest interface{}, scan Scanner) error {
-	if !scan.Next() {
-		err := scan.Err()
+	if conf.Positional {
+		colNames, err = positionalColNames(rtype, colNames)
 		if err != nil {
-			return Err{While: `preparing row`, Cause: err}
+			return nil, err
 		}
-		return ErrNoRows.while(`preparing row`)
 	}
 
-	err := scan.Scan(dest)
+	colDbTypes, err := rowsColDbTypes(rows)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if scan.Next() {
-		return ErrMultipleRows.while(`verifying row count`)
+	if conf.NoCache {
+		return makeDestSpec(rtype, colNames, colDbTypes, conf.specOpts())
 	}
-	return nil
+	return cachedDestSpec(rtype, colNames, colDbTypes, conf.specOpts())
 }
 
-type scanner struct {
-	*sql.Rows
-	rtype reflect.Type
-	spec  *tDestSpec
-}
-
-func (self *scanner) Scan(dest interface{}) error {
-	rval := reflect.ValueOf(dest)
+func cachedDestSpec(rtype reflect.Type, colNames []string, colDbTypes []string, opts tSpecOpts) (*tDestSpec, error) {
+	key := tDestSpecKey{
+		rtype:      rtype,
+		colNames:   strings.Join(colNames, "\x00"),
+		colDbTypes: strings.Join(colDbTypes, "\x00"),
+		opts:       opts,
+	}
+	val, ok := cache.get(rtype, key)
+	if ok {
+		return val.(*tDestSpec), nil
+	}
 
-	err := validateDestPtr(dest)
+	spec, err := makeDestSpec(rtype, colNames, colDbTypes, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rtype := rval.Type()
+	cache.set(rtype, key, spec)
+	return spec, nil
+}
 
-	if self.rtype == nil {
-		self.rtype = rtype
-	} else {
-		err := validateMatchingDestType(self.rtype, rtype)
-		if err != nil {
-			return err
-		}
-	}
+/*
+Cache key for `*tDestSpec`, which depends on the type, the columns, and the
+configuration options that affect decoding.
+*/
+type tDestSpecKey struct {
+	rtype      reflect.Type
+	colNames   string
+	colDbTypes string
+	opts       tSpecOpts
+}
 
-	if isRtypeStructNonScannable(rtype) {
-		return self.scanStruct(rval)
+/*
+Implements `Conf.Positional` by replacing the column names with the aliases of
+the struct's columns, in the order of `Cols`, see `appendPositionalAliases`.
+*/
+func positionalColNames(rtype reflect.Type, colNames []string) ([]string, error) {
+	aliases := appendPositionalAliases(nil, rtype, ``)
+
+	if len(colNames) > len(aliases) {
+		return nil, Err{
+			Code:  ErrCodeNoColDest,
+			While: `preparing positional mapping`,
+			Cause: fmt.Errorf(
+				`got %v columns, but type %q has only %v`,
+				len(colNames), rtype, len(aliases),
+			),
+		}
 	}
-	return self.scanScalar(dest)
+	return aliases[:len(colNames)], nil
 }
 
-func (self *scanner) scanStruct(rval reflect.Value) error {
-	if self.spec == nil {
-		spec, err := prepareDestSpec(self.Rows, self.rtype)
-		if err != nil {
-			return err
+/*
+Same as the aliases of `Cols`, except that structs without column names
+contribute every exported field, named after the Go field, see
+`isRtypeUntagged`. Must match `traverseMakeSpec` in positional mode.
+*/
+func appendPositionalAliases(out []string, rtype reflect.Type, prefix string) []string {
+	rtype = refut.RtypeDeref(rtype)
+	untagged := isRtypeUntagged(rtype)
+
+	for i := 0; i < rtype.NumField(); i++ {
+		sfield := rtype.Field(i)
+		if !refut.IsSfieldExported(sfield) {
+			continue
 		}
-		self.spec = spec
-	}
 
-	state, err := prepareDecodeState(self.Rows, self.spec)
-	if err != nil {
-		return err
+		if isSfieldFlattened(sfield) {
+			out = appendPositionalAliases(out, sfield.Type, prefix)
+			continue
+		}
+
+		name := specColumnName(sfield, untagged)
+		if name == "" {
+			continue
+		}
+		alias := prefix + name
+
+		if isSfieldSingleCol(sfield) {
+			out = append(out, alias)
+		} else if isRtypeStructNonScannable(sfield.Type) {
+			out = appendPositionalAliases(out, sfield.Type, alias+aliasSeparator())
+		} else if isRtypeManyStruct(sfield.Type) {
+			out = appendPositionalAliases(out, sfield.Type.Elem(), alias+aliasSeparator())
+		} else {
+			out = append(out, alias)
+		}
 	}
+	return out
+}
 
-	err = self.Rows.Scan(state.colPtrs...)
-	if err != nil {
-		return ErrScan.because(err)
+/*
+Column name of the field for decoding. In positional mode, fields of structs
+without column names are named after the Go field, see `Conf.Positional`,
+unless excluded via `db:"-"`.
+*/
+func specColumnName(sfield reflect.StructField, untagged bool) string {
+	name := sfieldColumnName(sfield)
+	if name == "" && untagged && !isTagExcluded(sfield.Tag.Get(`db`)) {
+		return sfield.Name
 	}
+	return name
+}
 
-	return traverseDecode(rval, self.spec, state, &self.spec.typeSpec, nil)
+/*
+True if no exported field of the struct, including fields of flattened
+embedded structs, has a column name, either from a `db` tag or from the
+column namer.
+*/
+func isRtypeUntagged(rtype reflect.Type) bool {
+	untagged := true
+	_ = traverseStructRtype(rtype, func(sfield reflect.StructField, _ []int) error {
+		if sfieldColumnName(sfield) != "" {
+			untagged = false
+		}
+		return nil
+	})
+	return untagged
 }
 
-func (self *scanner) scanScalar(dest interface{}) error {
-	err := self.Rows.Scan(dest)
-	if err != nil {
-		return ErrScan.because(err)
+/*
+Database types of columns are needed only for decoders registered via
+`RegisterColumnDecoder`. Otherwise, we avoid the overhead of getting them.
+Rows other than `*sql.Rows` may provide them via `ColumnDbTypes`, see `Rows`.
+*/
+func rowsColDbTypes(rows Rows) ([]string, error) {
+	if !hasColumnDecoders() {
+		return nil, nil
 	}
-	return nil
-}
 
-func prepareDestSpec(rows *sql.Rows, rtype reflect.Type) (*tDestSpec, error) {
-	if rtype == nil || rtype.Kind() != reflect.Ptr || rtypeDerefKind(rtype) != reflect.Struct {
-		return nil, Err{
-			Code:  ErrCodeInvalidDest,
-			While: `preparing destination spec`,
-			Cause: fmt.Errorf(`expected destination type to be a struct pointer, got %q`, rtype),
+	typed, ok := rows.(tRowsColDbTypes)
+	if ok {
+		out, err := typed.ColumnDbTypes()
+		if err != nil {
+			return nil, Err{While: `getting column types`, Cause: err}
 		}
+		return out, nil
 	}
 
-	colNames, err := rows.Columns()
+	sqlRows, ok := rows.(*sql.Rows)
+	if !ok {
+		return nil, nil
+	}
+
+	colTypes, err := sqlRows.ColumnTypes()
 	if err != nil {
-		return nil, Err{While: `getting columns`, Cause: err}
+		return nil, Err{While: `getting column types`, Cause: err}
+	}
+
+	out := make([]string, len(colTypes))
+	for i, colType := range colTypes {
+		out[i] = colType.DatabaseTypeName()
 	}
+	return out, nil
+}
 
+func makeDestSpec(rtype reflect.Type, colNames []string, colDbTypes []string, opts tSpecOpts) (*tDestSpec, error) {
 	spec := &tDestSpec{
-		typeSpec:  tTypeSpec{rtype: rtype},
-		colNames:  colNames,
-		colRtypes: map[string]reflect.Type{},
+		typeSpec:   tTypeSpec{rtype: rtype},
+		colNames:   colNames,
+		colDbTypes: colDbTypes,
+		colRtypes:  map[string]reflect.Type{},
+		opts:       opts,
 	}
 
 	colPath := make([]string, 0, expectedStructDepth)
 	fieldPath := make([]int, 0, expectedStructDepth)
-	err = traverseMakeSpec(rtype, spec, &spec.typeSpec, nil, colPath, fieldPath)
+	err := traverseMakeSpec(rtype, spec, &spec.typeSpec, nil, colPath, fieldPath)
+	if err != nil {
+		return nil, err
+	}
+
+	restPath, err := structRestPath(rtype)
 	if err != nil {
 		return nil, err
 	}
+	var restCols []int
 
-	for _, colName := range colNames {
+	for i, colName := range colNames {
 		if spec.colRtypes[colName] == nil {
+			if restPath != nil {
+				// Scanned as a raw value into the rest field.
+				spec.colRtypes[colName] = interfaceRtype
+				restCols = append(restCols, i)
+				continue
+			}
+
+			if opts.ignoreUnknownCols {
+				// Scanned as a raw value and discarded.
+				spec.colRtypes[colName] = interfaceRtype
+				continue
+			}
+
 			return nil, Err{
 				Code:  ErrCodeNoColDest,
 				While: `preparing destination spec`,
@@ -274,10 +1701,56 @@ func prepareDestSpec(rows *sql.Rows, rtype reflect.Type) (*tDestSpec, error) {
 		}
 	}
 
+	if opts.strictFields {
+		missing := appendMissingColAliases(nil, &spec.typeSpec)
+		if len(missing) > 0 {
+			return nil, ErrMissingCol.while(`preparing destination spec`).because(fmt.Errorf(
+				`type %q has fields without matching columns: %q`, rtype, missing,
+			))
+		}
+	}
+
+	spec.decode = compileTypeSpec(spec, &spec.typeSpec, nil)
+	if restPath != nil {
+		spec.decode = compileRestStep(spec.decode, restPath, colNames, restCols)
+	}
 	return spec, nil
 }
 
-func prepareDecodeState(rows *sql.Rows, spec *tDestSpec) (*tDecodeState, error) {
+/*
+Used by `Conf.StrictFields`. Finds fields which would be decoded from columns
+missing from the result set. Nested structs are represented by their fields,
+unless decoded from a single column.
+*/
+func appendMissingColAliases(out []string, typeSpec *tTypeSpec) []string {
+	for i := range typeSpec.fieldSpecs {
+		fieldSpec := &typeSpec.fieldSpecs[i]
+		sfield := fieldSpec.sfield
+
+		if !refut.IsSfieldExported(sfield) {
+			continue
+		}
+
+		if isSfieldFlattened(sfield) {
+			out = appendMissingColAliases(out, &fieldSpec.typeSpec)
+			continue
+		}
+
+		if fieldSpec.colName == "" || fieldSpec.colIndex >= 0 {
+			continue
+		}
+
+		if fieldSpec.many || (fieldSpec.decoder == nil && isRtypeStructNonScannable(sfield.Type)) {
+			out = appendMissingColAliases(out, &fieldSpec.typeSpec)
+			continue
+		}
+
+		out = append(out, fieldSpec.colAlias)
+	}
+	return out
+}
+
+func prepareDecodeState(rows Rows, spec *tDestSpec) (*tDecodeState, error) {
 	colPtrs := make([]interface{}, 0, len(spec.colNames))
 	for _, colName := range spec.colNames {
 		if spec.colRtypes[colName] == nil {
@@ -302,6 +1775,7 @@ func traverseMakeSpec(
 ) error {
 	typ = refut.RtypeDeref(typ)
 	typeSpec.fieldSpecs = make([]tFieldSpec, typ.NumField())
+	untagged := spec.opts.positional && isRtypeUntagged(typ)
 
 	for i := 0; i < typ.NumField(); i++ {
 		sfield := typ.Field(i)
@@ -321,7 +1795,7 @@ func traverseMakeSpec(
 			continue
 		}
 
-		if sfield.Anonymous && fieldTypeInner.Kind() == reflect.Struct {
+		if isSfieldFlattened(sfield) {
 			err := traverseMakeSpec(fieldTypeInner, spec, &fieldSpec.typeSpec, fieldSpec, colPath, fieldPath)
 			if err != nil {
 				return err
@@ -329,7 +1803,7 @@ func traverseMakeSpec(
 			continue
 		}
 
-		fieldSpec.colName = sfieldColumnName(sfield)
+		fieldSpec.colName = specColumnName(sfield, untagged)
 		if fieldSpec.colName == "" {
 			continue
 		}
@@ -348,7 +1822,7 @@ func traverseMakeSpec(
 		}
 
 		colPath := append(colPath, fieldSpec.colName)
-		fieldSpec.colAlias = strings.Join(colPath, ".")
+		fieldSpec.colAlias = strings.Join(colPath, aliasSeparator())
 		fieldSpec.colIndex = stringIndex(spec.colNames, fieldSpec.colAlias)
 
 		if spec.colRtypes[fieldSpec.colAlias] != nil {
@@ -358,8 +1832,32 @@ func traverseMakeSpec(
 				Cause: fmt.Errorf(`redundant occurrence of column %q`, fieldSpec.colAlias),
 			}
 		}
+
+		fieldSpec.decoder = findDecoder(typ, sfield, spec.colDbType(fieldSpec.colIndex))
+		if fieldSpec.decoder == nil {
+			fieldSpec.decoder = builtinDecoder(sfield, spec.opts)
+		}
+		if fieldSpec.decoder == nil && fieldSpec.colIndex >= 0 && isRtypeStructNonScannable(sfield.Type) {
+			// A single column for a nested struct is a composite value.
+			fieldSpec.decoder = decodeComposite
+		}
+		if fieldSpec.decoder != nil {
+			// The decoder takes the raw column value.
+			spec.colRtypes[fieldSpec.colAlias] = interfaceRtype
+			continue
+		}
 		spec.colRtypes[fieldSpec.colAlias] = sfield.Type
 
+		if isRtypeManyStruct(sfield.Type) {
+			// Field paths of the children are relative to the slice element.
+			fieldSpec.many = true
+			err := traverseMakeSpec(sfield.Type.Elem(), spec, &fieldSpec.typeSpec, fieldSpec, colPath, nil)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		if isRtypeStructNonScannable(fieldTypeInner) {
 			err := traverseMakeSpec(fieldTypeInner, spec, &fieldSpec.typeSpec, fieldSpec, colPath, fieldPath)
 			if err != nil {
@@ -371,25 +1869,83 @@ func traverseMakeSpec(
 	return nil
 }
 
-func traverseDecode(
-	rootRval reflect.Value, spec *tDestSpec, state *tDecodeState, typeSpec *tTypeSpec, fieldSpec *tFieldSpec,
-) error {
-	everyColValueIsNil := true
+/*
+Finds the built-in decoder for the given field, if any. Used for fields
+without registered decoders.
+*/
+func builtinDecoder(sfield reflect.StructField, opts tSpecOpts) DecodeFunc {
+	if sfield.Type == blobRtype {
+		return decodeBlob
+	}
+	if isSfieldXml(sfield) {
+		return decodeXml
+	}
+	if isRtypeByteArray(sfield.Type) {
+		return decodeByteArray
+	}
+	if isRtypeHstore(sfield.Type) {
+		return decodeHstore
+	}
+	if isRtypeDuration(sfield.Type) {
+		return decodeDuration
+	}
+	if isRtypeBigNumber(sfield.Type) {
+		return decodeBigNumber
+	}
+	if opts.coerce && isRtypeCoercible(sfield.Type) {
+		return coerce
+	}
+	return nil
+}
+
+/*
+Finds the built-in decoder for a scalar destination of the given type, if any.
+Used for destinations other than struct fields, see `builtinDecoder`.
+*/
+func builtinScalarDecoder(rtype reflect.Type, conf Conf) DecodeFunc {
+	if isRtypeByteArray(rtype) {
+		return decodeByteArray
+	}
+	if isRtypeHstore(rtype) {
+		return decodeHstore
+	}
+	if isRtypeDuration(rtype) {
+		return decodeDuration
+	}
+	if isRtypeBigNumber(rtype) {
+		return decodeBigNumber
+	}
+	if conf.Coerce && isRtypeCoercible(rtype) {
+		return coerce
+	}
+	return nil
+}
+
+/*
+Compiles the decoding of the given struct, which may be the root struct or a
+nested one, into a single step. Decisions that depend only on types, such as
+which fields are nested and how to handle nulls, are made once here rather
+than for every row. Each struct is decoded by running the steps of its nested
+structs, then checking its own columns for nulls, then running the assignment
+steps of its own columns, which are flat lists. With `Conf.ZeroNullStructs`, a
+nested struct whose columns are all null, including those of deeper nested
+structs, is zeroed before running any of its steps.
+*/
+func compileTypeSpec(spec *tDestSpec, typeSpec *tTypeSpec, fieldSpec *tFieldSpec) tDecodeStep {
+	var nestedSteps []tDecodeStep
+	var colIndexes []int
+	var assignSteps []tDecodeStep
 
 	for i := range typeSpec.fieldSpecs {
 		fieldSpec := &typeSpec.fieldSpecs[i]
 		sfield := fieldSpec.sfield
-		fieldTypeInner := refut.RtypeDeref(sfield.Type)
 
 		if !refut.IsSfieldExported(sfield) {
 			continue
 		}
 
-		if sfield.Anonymous && fieldTypeInner.Kind() == reflect.Struct {
-			err := traverseDecode(rootRval, spec, state, &fieldSpec.typeSpec, fieldSpec)
-			if err != nil {
-				return err
-			}
+		if isSfieldFlattened(sfield) {
+			nestedSteps = append(nestedSteps, compileTypeSpec(spec, &fieldSpec.typeSpec, fieldSpec))
 			continue
 		}
 
@@ -397,67 +1953,138 @@ func traverseDecode(
 			continue
 		}
 
-		if isRtypeStructNonScannable(fieldTypeInner) {
-			err := traverseDecode(rootRval, spec, state, &fieldSpec.typeSpec, fieldSpec)
-			if err != nil {
-				return err
-			}
+		if fieldSpec.colIndex >= 0 {
+			assignSteps = append(assignSteps, compileFieldSpec(typeSpec, fieldSpec))
+		}
+
+		if fieldSpec.many {
+			nestedSteps = append(nestedSteps, compileManyFieldSpec(spec, fieldSpec))
 			continue
 		}
 
-		if !(fieldSpec.colIndex >= 0) {
+		if fieldSpec.decoder == nil && isRtypeStructNonScannable(sfield.Type) {
+			nestedSteps = append(nestedSteps, compileTypeSpec(spec, &fieldSpec.typeSpec, fieldSpec))
 			continue
 		}
 
-		colRval := reflect.ValueOf(state.colPtrs[fieldSpec.colIndex]).Elem()
-		if !colRval.IsNil() {
-			everyColValueIsNil = false
+		if fieldSpec.colIndex >= 0 {
+			colIndexes = append(colIndexes, fieldSpec.colIndex)
 		}
 	}
 
 	isNested := fieldSpec != nil
-	if everyColValueIsNil && isNested && isNilableOrHasNilableNonRootAncestor(fieldSpec) {
-		return nil
+	skipNull := isNested && isNilableOrHasNilableNonRootAncestor(fieldSpec)
+	zeroNull := isNested && spec.opts.zeroNullStructs && !isSfieldFlattened(fieldSpec.sfield)
+
+	var fieldPath []int
+	var allColIndexes []int
+	if isNested {
+		fieldPath = fieldSpec.fieldPath
+	}
+	if zeroNull && !skipNull {
+		allColIndexes = appendManyColIndexes(nil, typeSpec)
 	}
 
-	for _, fieldSpec := range typeSpec.fieldSpecs {
-		if !(fieldSpec.colIndex >= 0) {
-			continue
+	return func(rootRval reflect.Value, state *tDecodeState) error {
+		if zeroNull && !skipNull && state.isEveryColNil(allColIndexes) {
+			rvalZeroAtPath(rootRval, fieldPath)
+			return nil
 		}
 
-		sfield := fieldSpec.sfield
-		colRval := reflect.ValueOf(state.colPtrs[fieldSpec.colIndex]).Elem()
+		for _, step := range nestedSteps {
+			err := step(rootRval, state)
+			if err != nil {
+				return err
+			}
+		}
 
-		if colRval.IsNil() {
-			if isRtypeNilable(sfield.Type) {
-				rvalZeroAtPath(rootRval, fieldSpec.fieldPath)
-				continue
+		if skipNull && state.isEveryColNil(colIndexes) {
+			return nil
+		}
+
+		for _, step := range assignSteps {
+			err := step(rootRval, state)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Compiles the assignment of a column to the field.
+func compileFieldSpec(typeSpec *tTypeSpec, fieldSpec *tFieldSpec) tDecodeStep {
+	sfield := fieldSpec.sfield
+	colIndex := fieldSpec.colIndex
+	fieldPath := fieldSpec.fieldPath
+
+	if fieldSpec.decoder != nil {
+		decoder := fieldSpec.decoder
+
+		return func(rootRval reflect.Value, state *tDecodeState) error {
+			var src interface{}
+			colRval := state.colRval(colIndex)
+			if !colRval.IsNil() {
+				src = colRval.Elem().Interface()
 			}
 
-			fieldRval := refut.RvalFieldByPathAlloc(rootRval, fieldSpec.fieldPath)
-			scanner, ok := fieldRval.Addr().Interface().(sql.Scanner)
-			if ok {
-				err := scanner.Scan(nil)
-				if err != nil {
-					return Err{Code: ErrCodeScan, While: `scanning into field`, Cause: err}
+			err := decoder(src, refut.RvalFieldByPathAlloc(rootRval, fieldPath))
+			if err != nil {
+				return Err{
+					Code:  ErrCodeScan,
+					While: fmt.Sprintf(`decoding column %q into field %q`, fieldSpec.colAlias, sfield.Name),
+					Cause: err,
 				}
-				continue
 			}
+			return nil
+		}
+	}
 
-			return Err{
-				Code:  ErrCodeNull,
-				While: `decoding into struct`,
-				Cause: fmt.Errorf(
-					`type %q at field %q of struct %q is not nilable, but corresponding column %q was null`,
-					sfield.Type, sfield.Name, typeSpec.rtype, fieldSpec.colAlias,
-				),
+	isNilable := isRtypeNilable(sfield.Type)
+	isScanner := reflect.PtrTo(sfield.Type).Implements(sqlScannerRtype)
+
+	return func(rootRval reflect.Value, state *tDecodeState) error {
+		colRval := state.colRval(colIndex)
+		if !colRval.IsNil() {
+			set(refut.RvalFieldByPathAlloc(rootRval, fieldPath), colRval.Elem())
+			return nil
+		}
+
+		if isNilable {
+			rvalZeroAtPath(rootRval, fieldPath)
+			return nil
+		}
+
+		if isScanner {
+			fieldRval := refut.RvalFieldByPathAlloc(rootRval, fieldPath)
+			err := fieldRval.Addr().Interface().(sql.Scanner).Scan(nil)
+			if err != nil {
+				return Err{Code: ErrCodeScan, While: `scanning into field`, Cause: err}
 			}
+			return nil
 		}
 
-		set(refut.RvalFieldByPathAlloc(rootRval, fieldSpec.fieldPath), colRval.Elem())
+		return Err{
+			Code:  ErrCodeNull,
+			While: `decoding into struct`,
+			Cause: fmt.Errorf(
+				`type %q at field %q of struct %q is not nilable, but corresponding column %q was null`,
+				sfield.Type, sfield.Name, typeSpec.rtype, fieldSpec.colAlias,
+			),
+		}
 	}
+}
 
-	return nil
+// Returns "" if database types are unavailable or the index is out of range.
+func (self *tDestSpec) colDbType(index int) string {
+	if index >= 0 && index < len(self.colDbTypes) {
+		return self.colDbTypes[index]
+	}
+	return ""
+}
+
+func isChanDest(val interface{}) bool {
+	return reflect.TypeOf(val).Kind() == reflect.Chan
 }
 
 func isNilDest(val interface{}) bool {
@@ -479,6 +2106,23 @@ func validateDestPtr(val interface{}) error {
 	return nil
 }
 
+// Allows tuple destinations in addition to pointers, see `isTupleDest`.
+func validateDestPtrOrTuple(val interface{}) error {
+	if isTupleDest(val) {
+		return nil
+	}
+	return validateDestPtr(val)
+}
+
+/*
+True for destinations such as `[]interface{}{&id, &name}`, which decode the
+columns of a single row positionally into the given pointers.
+*/
+func isTupleDest(val interface{}) bool {
+	_, ok := val.([]interface{})
+	return ok
+}
+
 func validateMatchingDestType(expected, found reflect.Type) error {
 	if expected != found {
 		return ErrInvalidDest.because(fmt.Errorf(`destination must be of type %v, received %v`, expected, found))
@@ -486,6 +2130,92 @@ func validateMatchingDestType(expected, found reflect.Type) error {
 	return nil
 }
 
+func jsonQuery(query string) string {
+	return wrapSelect(query, `to_jsonb(_)`)
+}
+
+func wrapSelect(query string, exprs string) string {
+	return "select " + exprs + " from (\n" + query + "\n) as _"
+}
+
+// A `[]interface{}` destination is a single raw row, see `Query`.
 func expectManyRows(val interface{}) bool {
-	return rtypeDerefKind(reflect.TypeOf(val)) == reflect.Slice
+	rtype := refut.RtypeDeref(reflect.TypeOf(val))
+	return rtype != nil && rtype.Kind() == reflect.Slice && rtype != interfacesRtype
+}
+
+// True for maps of structs, see `scanMap`.
+func expectMapRows(val interface{}) bool {
+	rtype := refut.RtypeDeref(reflect.TypeOf(val))
+	return rtype != nil && rtype.Kind() == reflect.Map && isRtypeStructNonScannable(rtype.Elem())
+}
+
+/*
+Returns the type decoded from each row for the given destination type, without
+the outer pointer, following the same rules as `Conf.Query`: the element type
+of slices, maps of structs and channels, and otherwise the type itself.
+*/
+func rowDestRtype(rtype reflect.Type) reflect.Type {
+	deref := refut.RtypeDeref(rtype)
+	switch {
+	case deref == nil:
+		return nil
+	case rtype.Kind() == reflect.Chan:
+		return rtype.Elem()
+	case deref.Kind() == reflect.Slice && deref != interfacesRtype:
+		return deref.Elem()
+	case deref.Kind() == reflect.Map && isRtypeStructNonScannable(deref.Elem()):
+		return deref.Elem()
+	default:
+		return rtype
+	}
+}
+
+// Describes how a row is decoded into a given type, see `rowDestKind`.
+type tRowDestKind byte
+
+const (
+	rowDestScalar tRowDestKind = iota
+	rowDestRow
+	rowDestRaw
+	rowDestRowScanner
+	rowDestMapper
+	rowDestVariants
+	rowDestDecoder
+	rowDestStruct
+)
+
+/*
+Determines how a row is decoded into the given type, in the order of priority
+used by `Scanner.Scan`. Shared by decoding and validation, which keeps them in
+sync, see `ValidateDest` and `ValidateNamedQueries`.
+*/
+func rowDestKind(rtype reflect.Type) tRowDestKind {
+	if rtype == rowRtype {
+		return rowDestRow
+	}
+	if rtype == interfacesRtype {
+		return rowDestRaw
+	}
+	if reflect.PtrTo(refut.RtypeDeref(rtype)).Implements(rowScannerRtype) {
+		return rowDestRowScanner
+	}
+
+	_, ok := getMapper(rtype)
+	if ok {
+		return rowDestMapper
+	}
+
+	_, ok = getVariants(rtype)
+	if ok {
+		return rowDestVariants
+	}
+
+	if findTypeDecoder(rtype) != nil {
+		return rowDestDecoder
+	}
+	if isRtypeStructNonScannable(rtype) {
+		return rowDestStruct
+	}
+	return rowDestScalar
 }
@@ -0,0 +1,135 @@
+package gos
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+/*
+Routes reads to replicas and everything else to the primary. Implements
+`QueryExecer`, which allows code written against a single connection to scale
+reads without changing call sites:
+
+	router := &gos.ReplicaRouter{
+		Primary:  primary,
+		Replicas: []gos.QueryExecer{replica0, replica1},
+	}
+
+	err := gos.Query(ctx, router, &dest, `select * from persons`, nil)
+
+Queries whose first keyword is `select`, which is what `Query` uses for
+non-nil destinations, go to a replica picked by `Pick`, or round-robin by
+default. Other queries, including `Query` with nil destinations, go to the
+primary. This includes `insert ... returning` and CTEs, which may write.
+Without replicas, every query goes to the primary.
+
+Replicas may lag behind the primary. For reads that must see preceding writes,
+or that lock rows via `select ... for update`, use `ContextWithPrimary`.
+Transactions should be begun on the primary directly. Must be used by pointer,
+since round-robin picking is stateful.
+*/
+type ReplicaRouter struct {
+	// Connection for writes and non-select queries. Required.
+	Primary QueryExecer
+	// Connections for reads. Optional.
+	Replicas []QueryExecer
+	// Maps a monotonically increasing counter to an index in `Replicas`.
+	// Optional; the default is round-robin.
+	Pick func(count uint64) int
+
+	count uint64
+}
+
+// Implement `Queryer`.
+func (self *ReplicaRouter) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	conn, err := self.conn(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return conn.QueryContext(ctx, query, args...)
+}
+
+// Implement `Execer`.
+func (self *ReplicaRouter) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if self.Primary == nil {
+		return nil, errMissingPrimary
+	}
+	return self.Primary.ExecContext(ctx, query, args...)
+}
+
+/*
+Returns the next replica, as picked by `Pick` or round-robin, or the primary
+when there are no replicas.
+*/
+func (self *ReplicaRouter) Replica() (QueryExecer, error) {
+	if len(self.Replicas) == 0 {
+		if self.Primary == nil {
+			return nil, errMissingPrimary
+		}
+		return self.Primary, nil
+	}
+
+	count := atomic.AddUint64(&self.count, 1) - 1
+	if self.Pick == nil {
+		return self.Replicas[count%uint64(len(self.Replicas))], nil
+	}
+
+	index := self.Pick(count)
+	if index < 0 || index >= len(self.Replicas) {
+		return nil, ErrInvalidInput.while(`picking replica`).because(fmt.Errorf(
+			`picked replica %v, expected index in range [0, %v)`, index, len(self.Replicas),
+		))
+	}
+	return self.Replicas[index], nil
+}
+
+/*
+Returns a context that makes `ReplicaRouter` send every query to the primary,
+for reads that must see preceding writes, or that lock rows.
+*/
+func ContextWithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+// True if the context was returned by `ContextWithPrimary`.
+func IsContextPrimary(ctx context.Context) bool {
+	val, _ := ctx.Value(primaryCtxKey{}).(bool)
+	return val
+}
+
+/* Internal */
+
+type primaryCtxKey struct{}
+
+var errMissingPrimary = ErrInvalidInput.while(`routing query`).because(
+	fmt.Errorf(`missing primary connection`),
+)
+
+func (self *ReplicaRouter) conn(ctx context.Context, query string) (QueryExecer, error) {
+	if IsContextPrimary(ctx) || !isSelectQuery(query) {
+		if self.Primary == nil {
+			return nil, errMissingPrimary
+		}
+		return self.Primary, nil
+	}
+	return self.Replica()
+}
+
+// True if the first keyword of the query is `select`, ignoring parentheses.
+func isSelectQuery(query string) bool {
+	query = strings.TrimLeftFunc(query, func(char rune) bool {
+		return unicode.IsSpace(char) || char == '('
+	})
+	const keyword = `select`
+	return len(query) >= len(keyword) &&
+		strings.EqualFold(query[:len(keyword)], keyword) &&
+		(len(query) == len(keyword) || !isIdentChar(rune(query[len(keyword)])))
+}
+
+func isIdentChar(char rune) bool {
+	return char == '_' || unicode.IsLetter(char) || unicode.IsDigit(char)
+}
@@ -0,0 +1,80 @@
+package gos
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Returns the path to the field tagged with the "rest" option, such as
+`db:",rest"`, if any. Such a field must have a type like
+`map[string]interface{}`, and receives the raw values of every column without
+another destination, keyed by column names. Only top-level and embedded fields
+are considered.
+*/
+func structRestPath(rtype reflect.Type) ([]int, error) {
+	var out []int
+
+	err := traverseStructRtype(rtype, func(sfield reflect.StructField, fieldPath []int) error {
+		if !sfieldHasColumnOpt(sfield, `rest`) {
+			return nil
+		}
+
+		if out != nil {
+			return ErrInvalidDest.while(`finding rest field`).because(fmt.Errorf(
+				`type %q has multiple rest fields`, refut.RtypeDeref(rtype),
+			))
+		}
+
+		if !isRtypeRestMap(sfield.Type) {
+			return ErrInvalidDest.while(`finding rest field`).because(fmt.Errorf(
+				`rest field %q of type %q must be map[string]interface{}, got %q`,
+				sfield.Name, refut.RtypeDeref(rtype), sfield.Type,
+			))
+		}
+
+		out = copyIntSlice(fieldPath)
+		return nil
+	})
+	return out, err
+}
+
+func isRtypeRestMap(rtype reflect.Type) bool {
+	return rtype.Kind() == reflect.Map &&
+		rtype.Key().Kind() == reflect.String &&
+		rtype.Elem() == interfaceRtype
+}
+
+/*
+Wraps the decoding of the root struct, collecting the columns at the given
+indexes into the rest field. The map is replaced for every row, and is nil
+when there are no such columns.
+*/
+func compileRestStep(decode tDecodeStep, restPath []int, colNames []string, colIndexes []int) tDecodeStep {
+	return func(rootRval reflect.Value, state *tDecodeState) error {
+		err := decode(rootRval, state)
+		if err != nil {
+			return err
+		}
+
+		fieldRval := refut.RvalFieldByPathAlloc(rootRval, restPath)
+		if len(colIndexes) == 0 {
+			rvalZero(fieldRval)
+			return nil
+		}
+
+		mapRval := reflect.MakeMapWithSize(fieldRval.Type(), len(colIndexes))
+		for _, index := range colIndexes {
+			val := reflect.Zero(interfaceRtype)
+			colRval := state.colRval(index)
+			if !colRval.IsNil() {
+				val = colRval.Elem()
+			}
+			mapRval.SetMapIndex(reflect.ValueOf(colNames[index]).Convert(fieldRval.Type().Key()), val)
+		}
+		fieldRval.Set(mapRval)
+		return nil
+	}
+}
@@ -0,0 +1,220 @@
+package gos
+
+import (
+	"container/list"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/*
+Memoizes decoded results of read queries, keyed by the query, the arguments
+and the destination type, for a limited time and up to a limited amount of
+entries. Fills the gap between querying the database every time and wiring up
+a full cache layer, for example for small reference tables. Only queries
+executed via `ResultCache.Query` are cached, which allows to designate them
+explicitly:
+
+	var countries = gos.NewResultCache(time.Minute, 64)
+
+	func loadCountries(ctx context.Context, conn gos.QueryExecer) (out []Country, err error) {
+		err = countries.Query(ctx, conn, &out, `select * from countries`, nil)
+		return
+	}
+
+Cached results are deep-copied into each destination, so callers may freely
+modify them. Arguments are compared by value, after conversion via
+`RegisterArgConverter` and normalization into driver values, the same way
+"database/sql" normalizes them: pointers are dereferenced, `driver.Valuer` is
+called, and numbers are widened. Queries with arguments that can't be
+normalized, such as slices, are executed without caching. Safe for concurrent
+use.
+*/
+type ResultCache struct {
+	conf       Conf
+	ttl        time.Duration
+	maxEntries int
+
+	lock    sync.Mutex
+	entries map[tResultCacheKey]*list.Element
+	order   list.List // Front is most recently used.
+}
+
+/*
+Creates a result cache. Entries expire after the given TTL, which must be
+positive. When the amount of entries exceeds the given limit, the least
+recently used entries are evicted. A non-positive limit means no limit.
+*/
+func NewResultCache(ttl time.Duration, maxEntries int) *ResultCache {
+	if !(ttl > 0) {
+		panic(ErrInvalidInput.while(`creating result cache`).because(
+			fmt.Errorf(`expected positive TTL, got %v`, ttl),
+		))
+	}
+
+	return &ResultCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[tResultCacheKey]*list.Element{},
+	}
+}
+
+/*
+Returns a copy of the cache that uses the given configuration for queries, see
+`Conf`. The copy is empty and doesn't share entries with the original.
+*/
+func (self *ResultCache) WithConf(conf Conf) *ResultCache {
+	out := NewResultCache(self.ttl, self.maxEntries)
+	out.conf = conf
+	return out
+}
+
+/*
+Similar to `Query`, but returns a cached result if available, and caches the
+result on a miss. Errors are not cached. A nil destination executes the query
+without caching.
+*/
+func (self *ResultCache) Query(ctx context.Context, conn QueryExecer, dest interface{}, query string, args []interface{}) error {
+	if isNilDest(dest) {
+		return self.conf.Query(ctx, conn, dest, query, args)
+	}
+
+	err := validateDestPtr(dest)
+	if err != nil {
+		return err
+	}
+
+	argsKey, ok, err := resultCacheArgsKey(args)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return self.conf.Query(ctx, conn, dest, query, args)
+	}
+
+	rval := reflect.ValueOf(dest).Elem()
+	key := tResultCacheKey{
+		rtype: rval.Type(),
+		query: query,
+		args:  argsKey,
+	}
+
+	val, ok := self.get(key)
+	if ok {
+		rval.Set(rvalDeepCopy(val))
+		return nil
+	}
+
+	ptr := reflect.New(rval.Type())
+	err = self.conf.Query(ctx, conn, ptr.Interface(), query, args)
+	if err != nil {
+		return err
+	}
+
+	self.set(key, ptr.Elem())
+	rval.Set(rvalDeepCopy(ptr.Elem()))
+	return nil
+}
+
+// Removes all entries.
+func (self *ResultCache) Clear() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.entries = map[tResultCacheKey]*list.Element{}
+	self.order.Init()
+}
+
+/*
+Returns the current amount of entries, including expired ones which haven't
+been evicted yet.
+*/
+func (self *ResultCache) Len() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return len(self.entries)
+}
+
+/* Internal */
+
+type tResultCacheKey struct {
+	rtype reflect.Type
+	query string
+	args  string
+}
+
+/*
+Builds the part of the cache key that represents the arguments, from the
+normalized driver values, which never contain pointers. False if some
+arguments can't be normalized.
+*/
+func resultCacheArgsKey(args []interface{}) (string, bool, error) {
+	converted, err := convertArgs(args)
+	if err != nil {
+		return ``, false, err
+	}
+
+	vals := make([]driver.Value, len(converted))
+	for i, arg := range converted {
+		val, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return ``, false, nil
+		}
+		vals[i] = val
+	}
+	return fmt.Sprintf(`%#v`, vals), true, nil
+}
+
+type tResultCacheEntry struct {
+	key     tResultCacheKey
+	val     reflect.Value // Never mutated or exposed.
+	expires time.Time
+}
+
+func (self *ResultCache) get(key tResultCacheKey) (reflect.Value, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	elem := self.entries[key]
+	if elem == nil {
+		return reflect.Value{}, false
+	}
+
+	entry := elem.Value.(tResultCacheEntry)
+	if time.Now().After(entry.expires) {
+		self.remove(elem)
+		return reflect.Value{}, false
+	}
+
+	self.order.MoveToFront(elem)
+	return entry.val, true
+}
+
+func (self *ResultCache) set(key tResultCacheKey, val reflect.Value) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.entries == nil {
+		self.entries = map[tResultCacheKey]*list.Element{}
+	}
+
+	elem := self.entries[key]
+	if elem != nil {
+		self.remove(elem)
+	}
+
+	entry := tResultCacheEntry{key: key, val: val, expires: time.Now().Add(self.ttl)}
+	self.entries[key] = self.order.PushFront(entry)
+
+	for self.maxEntries > 0 && len(self.entries) > self.maxEntries {
+		self.remove(self.order.Back())
+	}
+}
+
+// Assumes the lock is held by the caller.
+func (self *ResultCache) remove(elem *list.Element) {
+	self.order.Remove(elem)
+	delete(self.entries, elem.Value.(tResultCacheEntry).key)
+}
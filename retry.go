@@ -0,0 +1,161 @@
+package gos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+/*
+Runs the callback in a transaction, and commits it after success. When the
+callback or the commit fails with a Postgres serialization failure or
+deadlock, see `IsRetryable`, rolls back and runs the whole transaction again,
+with exponential backoff limited by `Conf.RetryMaxDelay`, up to
+`Conf.RetryAttempts` times. Other errors roll back the transaction and are
+returned immediately. Meant for workloads under the "serializable" and
+"repeatable read" isolation levels, where such failures are expected, and the
+client is responsible for retrying:
+
+	err := gos.RetryTx(ctx, db, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *sql.Tx) error {
+		var balance int64
+		err := gos.Query(ctx, tx, &balance, `select balance from accounts where id = $1`, []interface{}{id})
+		if err != nil {
+			return err
+		}
+		return gos.Query(ctx, tx, nil, `update accounts set balance = $1 where id = $2`, []interface{}{balance - amount, id})
+	})
+
+The callback may run several times, and must not have side effects outside the
+transaction, or must make them idempotent. When the context is canceled while
+waiting for a retry, returns the last error.
+*/
+func RetryTx(ctx context.Context, conn TxBeginner, opts *sql.TxOptions, fun func(*sql.Tx) error) error {
+	return Conf{}.RetryTx(ctx, conn, opts, fun)
+}
+
+// Variant of `RetryTx` that uses the given configuration.
+func (self Conf) RetryTx(ctx context.Context, conn TxBeginner, opts *sql.TxOptions, fun func(*sql.Tx) error) error {
+	return self.Retry(ctx, func() error { return runTx(ctx, conn, opts, fun) })
+}
+
+/*
+Lower-level variant of `RetryTx`, which retries an arbitrary callback, such as
+a single statement in autocommit mode, or a transaction managed by the
+callback. The callback is responsible for rolling back its own transaction
+before returning a retryable error.
+*/
+func Retry(ctx context.Context, fun func() error) error {
+	return Conf{}.Retry(ctx, fun)
+}
+
+// Variant of `Retry` that uses the given configuration.
+func (self Conf) Retry(ctx context.Context, fun func() error) error {
+	attempts := self.retryAttempts()
+	maxDelay := self.retryMaxDelay()
+	delay := minDuration(self.retryDelay(), maxDelay)
+
+	for attempt := 1; ; attempt++ {
+		err := fun()
+		if err == nil || attempt >= attempts || !IsRetryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		// Clamped before doubling, which would eventually overflow.
+		if delay > maxDelay/2 {
+			delay = maxDelay
+		} else {
+			delay *= 2
+		}
+	}
+}
+
+/*
+True if the error, or any error it wraps, is a Postgres serialization failure
+(SQLSTATE 40001) or a detected deadlock (SQLSTATE 40P01). Such errors indicate
+that the transaction has been rolled back due to a conflict with another one,
+and may succeed when retried. Works with errors of common Postgres drivers,
+such as "github.com/lib/pq" and "github.com/jackc/pgx/v5".
+*/
+func IsRetryable(err error) bool {
+	switch errSqlState(err) {
+	case `40001`, `40P01`:
+		return true
+	default:
+		return false
+	}
+}
+
+/* Internal */
+
+/*
+Implemented by errors of "github.com/jackc/pgx/v5" and newer versions of
+"github.com/lib/pq".
+*/
+type tSqlStater interface{ SQLState() string }
+
+// Returns the Postgres SQLSTATE code of the error, if any.
+func errSqlState(err error) string {
+	var stater tSqlStater
+	if errors.As(err, &stater) {
+		return stater.SQLState()
+	}
+
+	// Older versions of "github.com/lib/pq" only have the string field `Code`.
+	// SQLSTATE codes always have 5 characters, unlike the codes of `Err`.
+	for ; err != nil; err = errors.Unwrap(err) {
+		rval := reflect.ValueOf(err)
+		if rval.Kind() == reflect.Ptr && !rval.IsNil() {
+			rval = rval.Elem()
+		}
+		if rval.Kind() != reflect.Struct {
+			continue
+		}
+
+		field := rval.FieldByName(`Code`)
+		if field.IsValid() && field.Kind() == reflect.String && field.Len() == 5 {
+			return field.String()
+		}
+	}
+	return ``
+}
+
+func minDuration(one, two time.Duration) time.Duration {
+	if one < two {
+		return one
+	}
+	return two
+}
+
+/*
+Runs one attempt of `RetryTx`. The deferred rollback also handles panics, and
+is a no-op after a successful commit.
+*/
+func runTx(ctx context.Context, conn TxBeginner, opts *sql.TxOptions, fun func(*sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, opts)
+	if err != nil {
+		return Err{While: `beginning transaction`, Cause: err}
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	err = fun(tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Err{While: `committing transaction`, Cause: err}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package gos
+
+import (
+	"reflect"
+)
+
+/*
+Ordered map of column names to column values, usable as a destination for
+scanning any row without a predefined type. Unlike `map[string]interface{}`,
+this preserves the original order of columns, which makes it suitable for
+generic tooling such as admin panels, inspectors, or data exporters. Example:
+
+	var row gos.Row
+	err := gos.Query(ctx, conn, &row, `select * from some_table limit 1`, nil)
+
+	for _, key := range row.Keys() {
+		fmt.Println(key, row.Get(key))
+	}
+
+Values are stored as returned by the driver, with nulls represented as nil.
+A slice of rows, `[]Row`, is also a valid destination for `Query`.
+*/
+type Row struct {
+	keys []string
+	vals []interface{}
+}
+
+// Returns the column names in their original order.
+func (self Row) Keys() []string { return copyStringSlice(self.keys) }
+
+// Returns the column values in the order of `Row.Keys`.
+func (self Row) Values() []interface{} { return copyInterfaceSlice(self.vals) }
+
+// Returns the amount of columns.
+func (self Row) Len() int { return len(self.keys) }
+
+/*
+Returns the value of the given column, or nil if the column is missing. When
+several columns have the same name, returns the first one.
+*/
+func (self Row) Get(key string) interface{} {
+	val, _ := self.Lookup(key)
+	return val
+}
+
+/*
+Returns the value of the given column and true, or nil and false if the column
+is missing.
+*/
+func (self Row) Lookup(key string) (interface{}, bool) {
+	index := stringIndex(self.keys, key)
+	if index < 0 {
+		return nil, false
+	}
+	return self.vals[index], true
+}
+
+/* Internal */
+
+var rowRtype = reflect.TypeOf(Row{})
+
+var interfacesRtype = reflect.TypeOf([]interface{}(nil))
+
+func (self *Row) scan(rows Rows) error {
+	keys, err := rows.Columns()
+	if err != nil {
+		return Err{While: `getting columns`, Cause: err}
+	}
+
+	vals, err := scanRawVals(rows, len(keys))
+	if err != nil {
+		return err
+	}
+
+	self.keys = keys
+	self.vals = vals
+	return nil
+}
+
+/*
+Decodes the current row into raw column values, as returned by the driver, for
+`[]interface{}` destinations. Always allocates a new slice, since the previous
+one may be referenced by the output of previous rows.
+*/
+func scanRawRow(rows Rows, dest *[]interface{}) error {
+	keys, err := rows.Columns()
+	if err != nil {
+		return Err{While: `getting columns`, Cause: err}
+	}
+
+	vals, err := scanRawVals(rows, len(keys))
+	if err != nil {
+		return err
+	}
+
+	*dest = vals
+	return nil
+}
+
+func scanRawVals(rows Rows, count int) ([]interface{}, error) {
+	vals := make([]interface{}, count)
+	ptrs := make([]interface{}, len(vals))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+
+	err := rows.Scan(ptrs...)
+	if err != nil {
+		return nil, ErrScan.because(err)
+	}
+	return vals, nil
+}
@@ -0,0 +1,70 @@
+package gos
+
+/*
+Result set decoded by `Scanner`. Satisfied by `*sql.Rows`, and may be
+implemented by adapters for other drivers, such as the "gospgx" subpackage for
+pgx. Allows to decode results obtained without "database/sql" via `NewScanner`
+and `ScanRows`.
+
+Implementations may also provide the following optional methods:
+
+	ColumnDbTypes() ([]string, error)
+	NextResultSet() bool
+
+`ColumnDbTypes` is needed only for decoders registered via
+`RegisterColumnDecoder`, and should return database type names in the same
+format as `(*sql.ColumnType).DatabaseTypeName`, such as "INT4" or "TEXT".
+`NextResultSet` is the same as `(*sql.Rows).NextResultSet`, and is used by
+the package-level `NextResultSet`.
+*/
+type Rows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(...interface{}) error
+	Err() error
+	Close() error
+}
+
+/*
+Creates a `Scanner` over rows obtained by other means, such as a native
+driver interface. The scanner takes ownership of the rows: closing the scanner
+closes the rows. Unlike `QueryScanner`, this doesn't check the query guard or
+record audit entries, since the query has already been executed, and ignores
+`Conf.RowTimeout`, which requires control over the query context.
+*/
+func NewScanner(rows Rows) Scanner { return Conf{}.NewScanner(rows) }
+
+// Variant of `NewScanner` that uses the given configuration.
+func (self Conf) NewScanner(rows Rows) Scanner {
+	return &scanner{Rows: rows, conf: self}
+}
+
+/*
+Decodes rows obtained by other means into the destination, following the same
+rules as `Query`, and closes the rows. See `NewScanner` for limitations.
+*/
+func ScanRows(dest interface{}, rows Rows) error { return Conf{}.ScanRows(dest, rows) }
+
+// Variant of `ScanRows` that uses the given configuration.
+func (self Conf) ScanRows(dest interface{}, rows Rows) error {
+	scan := self.NewScanner(rows)
+	defer scan.Close()
+
+	err := validateDestPtrOrTuple(dest)
+	if err != nil {
+		return err
+	}
+	return self.scanInto(dest, scan)
+}
+
+/* Internal */
+
+// Optional interface of `Rows`, see `rowsColDbTypes`.
+type tRowsColDbTypes interface {
+	ColumnDbTypes() ([]string, error)
+}
+
+// Optional interface of `Rows`, see `NextResultSet`.
+type tRowsNextResultSet interface {
+	NextResultSet() bool
+}
@@ -0,0 +1,103 @@
+package gos
+
+import "fmt"
+
+/*
+Decodes up to N rows into the elements of the given slice, starting at index 0,
+and returns how many were filled. The count is limited by the length of the
+slice. A count less than requested means the rows are exhausted. Useful for
+processing large results in batches. Each element is decoded via a pointer to
+it, which means the elements of a preallocated slice are reused between
+chunks. Works with any `Scanner`.
+*/
+func ScanChunk(scan Scanner, dest interface{}, n int) (int, error) {
+	return scanChunk(scan, dest, n)
+}
+
+/*
+Decodes up to N rows into the slice pointed to by the destination, such as
+`*[]T`, and returns how many were decoded. The slice is resliced to that count,
+reusing its backing array and elements when the capacity allows, which makes it
+suitable for reusing one slice across batches, such as for bulk indexing. A
+count less than requested means the rows are exhausted. Works with any
+`Scanner`.
+*/
+func ScanSlice(scan Scanner, dest interface{}, n int) (int, error) {
+	return scanSlice(scan, dest, n)
+}
+
+/*
+Decodes the columns of the current row into the given pointers, positionally,
+like `(*sql.Rows).Scan`, but with Gos error wrapping. Useful for ad-hoc rows
+such as aggregates, without defining a single-use struct. The amount of
+pointers must match the amount of columns. Shortcut for passing the pointers to
+`Scanner.Scan` as a tuple, which must be supported by the scanner.
+*/
+func ScanScalars(scan Scanner, dests ...interface{}) error {
+	return scan.Scan(dests)
+}
+
+/*
+Decodes the row after the current one, without advancing to it: the next call
+to `Scanner.Next` still moves to that row, which can then be decoded as usual.
+Useful for lookahead, such as splitting sorted rows into groups. May be called
+before the first `Scanner.Next` to inspect the first row. Rows fetched ahead
+are kept as raw values, which are converted into Go types by Gos rather than by
+"database/sql", with minor differences for exotic types. Fails with `ErrNoRows`
+when there's no next row.
+
+Requires the optional method `Peek`, see `Scanner`. Fails with
+`ErrInvalidInput` for scanners without it.
+*/
+func PeekRow(scan Scanner, dest interface{}) error {
+	impl, ok := scan.(tScannerPeek)
+	if !ok {
+		return ErrInvalidInput.while(`peeking row`).because(fmt.Errorf(
+			`scanner of type %T doesn't support peeking`, scan,
+		))
+	}
+	return impl.Peek(dest)
+}
+
+/*
+Returns decoding statistics accumulated so far. Remains available after
+`Scanner.Close`. Requires the optional method `Stats`, see `Scanner`. Returns
+zero stats for scanners without it.
+*/
+func GetScanStats(scan Scanner) ScanStats {
+	impl, ok := scan.(tScannerStats)
+	if !ok {
+		return ScanStats{}
+	}
+	return impl.Stats()
+}
+
+/*
+Same as `(*sql.Rows).NextResultSet`. Advances to the next result set of a query
+that returns several, such as a multi-statement batch, after which
+`Scanner.Next` iterates its rows. Resets the decoding state cached by
+`Scanner.Scan`, which is specific to each result set. Returns false when there
+are no more result sets, or when unsupported by the scanner. Requires the
+optional method `NextResultSet`, see `Scanner`.
+*/
+func NextResultSet(scan Scanner) bool {
+	impl, ok := scan.(tScannerNextResultSet)
+	return ok && impl.NextResultSet()
+}
+
+/* Internal */
+
+// Optional interface of `Scanner`, see `PeekRow`.
+type tScannerPeek interface {
+	Peek(interface{}) error
+}
+
+// Optional interface of `Scanner`, see `GetScanStats`.
+type tScannerStats interface {
+	Stats() ScanStats
+}
+
+// Optional interface of `Scanner`, see `NextResultSet`.
+type tScannerNextResultSet interface {
+	NextResultSet() bool
+}
@@ -0,0 +1,101 @@
+package gos
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+/*
+Routes queries to one of several connections, based on a shard key. Implements
+`QueryExecer`, which allows code written against a single connection to work
+unchanged over a manually sharded database fleet. The shard key is taken from
+the context, see `ContextWithShardKey`:
+
+	router := gos.ShardRouter{
+		Shards: []gos.QueryExecer{db0, db1},
+		Route: func(key interface{}) (int, error) {
+			return int(key.(TenantId) % 2), nil
+		},
+	}
+
+	ctx = gos.ContextWithShardKey(ctx, tenantId)
+	err := gos.Query(ctx, router, &dest, query, args)
+
+Alternatively, use `ShardRouter.Shard` to pick a connection explicitly. A
+missing shard key, or a route outside of the shards, produces `ErrInvalidInput`.
+*/
+type ShardRouter struct {
+	// Underlying connections, one per shard.
+	Shards []QueryExecer
+	// Maps a shard key to an index in `Shards`. Required.
+	Route func(key interface{}) (int, error)
+}
+
+// Implement `Queryer`.
+func (self ShardRouter) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	conn, err := self.contextShard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.QueryContext(ctx, query, args...)
+}
+
+// Implement `Execer`.
+func (self ShardRouter) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	conn, err := self.contextShard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.ExecContext(ctx, query, args...)
+}
+
+// Returns the connection for the given shard key.
+func (self ShardRouter) Shard(key interface{}) (QueryExecer, error) {
+	if self.Route == nil {
+		return nil, ErrInvalidInput.while(`routing shard`).because(
+			fmt.Errorf(`missing route function`),
+		)
+	}
+
+	index, err := self.Route(key)
+	if err != nil {
+		return nil, Err{Code: ErrCodeInvalidInput, While: `routing shard`, Cause: err}
+	}
+
+	if index < 0 || index >= len(self.Shards) {
+		return nil, ErrInvalidInput.while(`routing shard`).because(fmt.Errorf(
+			`shard key %v routed to shard %v, expected index in range [0, %v)`,
+			key, index, len(self.Shards),
+		))
+	}
+	return self.Shards[index], nil
+}
+
+/*
+Returns a context that carries the given shard key, which is used by
+`ShardRouter` to pick a connection.
+*/
+func ContextWithShardKey(ctx context.Context, key interface{}) context.Context {
+	return context.WithValue(ctx, shardKeyCtxKey{}, key)
+}
+
+// Returns the shard key carried by the context, see `ContextWithShardKey`.
+func ShardKeyFromContext(ctx context.Context) (interface{}, bool) {
+	key := ctx.Value(shardKeyCtxKey{})
+	return key, key != nil
+}
+
+/* Internal */
+
+type shardKeyCtxKey struct{}
+
+func (self ShardRouter) contextShard(ctx context.Context) (QueryExecer, error) {
+	key, ok := ShardKeyFromContext(ctx)
+	if !ok {
+		return nil, ErrInvalidInput.while(`routing shard`).because(
+			fmt.Errorf(`missing shard key in context`),
+		)
+	}
+	return self.Shard(key)
+}
@@ -0,0 +1,59 @@
+package gos
+
+import (
+	"context"
+
+	"github.com/mitranim/sqlb"
+)
+
+/*
+Variant of `Query` that takes a query built with the sibling library
+"github.com/mitranim/sqlb", which is the recommended way of building queries
+for Gos, instead of requiring callers to destructure it into text and
+arguments. Accepts any `sqlb.IQuery`, including `sqlb.Query`:
+
+	query := sqlb.QueryOrd(`select * from persons where id = $1`, id)
+	err := gos.QuerySqlb(ctx, conn, &dest, query)
+*/
+func QuerySqlb(ctx context.Context, conn QueryExecer, dest interface{}, query sqlb.IQuery) error {
+	return Conf{}.QuerySqlb(ctx, conn, dest, query)
+}
+
+// Variant of `QuerySqlb` that uses the given configuration.
+func (self Conf) QuerySqlb(ctx context.Context, conn QueryExecer, dest interface{}, query sqlb.IQuery) error {
+	return self.QueryOf(ctx, conn, dest, SqlbQuery{query})
+}
+
+/*
+Variant of `QueryScanner` that takes a query built with "github.com/mitranim/sqlb".
+See `QuerySqlb`.
+*/
+func QueryScannerSqlb(ctx context.Context, conn Queryer, query sqlb.IQuery) (Scanner, error) {
+	return Conf{}.QueryScannerSqlb(ctx, conn, query)
+}
+
+// Variant of `QueryScannerSqlb` that uses the given configuration.
+func (self Conf) QueryScannerSqlb(ctx context.Context, conn Queryer, query sqlb.IQuery) (Scanner, error) {
+	return self.QueryScannerOf(ctx, conn, SqlbQuery{query})
+}
+
+/*
+Adapts a query built with "github.com/mitranim/sqlb" to `Queryable`, which
+allows to mix it with other query types:
+
+	var queries = []gos.Queryable{
+		gos.SqlbQuery{sqlb.QueryOrd(`select * from persons where id = $1`, id)},
+		gos.RawQuery{`select * from persons`, nil},
+	}
+*/
+type SqlbQuery struct{ Query sqlb.IQuery }
+
+// Implement `Queryable`.
+func (self SqlbQuery) QueryArgs() (string, []interface{}) {
+	query, ok := self.Query.(sqlb.Query)
+	if !ok {
+		query = sqlb.Query{}
+		query.AppendQuery(self.Query)
+	}
+	return query.String(), query.Args
+}
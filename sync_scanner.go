@@ -0,0 +1,109 @@
+package gos
+
+import (
+	"sync"
+)
+
+/*
+Wraps the scanner for use by multiple goroutines. `*sql.Rows` is not safe for
+concurrent use, and separate calls to `Next` and `Scan` from different
+goroutines would interleave even if each was synchronized. `SyncScanner`
+combines them into `SyncScanner.Decode`, which advances to the next row and
+decodes it under a lock, handing each row to exactly one consumer:
+
+	scan, err := gos.QueryScanner(ctx, conn, query, args)
+	if err != nil {
+		return err
+	}
+
+	shared := gos.NewSyncScanner(scan)
+	defer shared.Close()
+
+	var group errgroup.Group
+	for i := 0; i < workers; i++ {
+		group.Go(func() error {
+			for {
+				var val Person
+				ok, err := shared.Decode(&val)
+				if err != nil || !ok {
+					return err
+				}
+				// Process `val` concurrently with other consumers.
+			}
+		})
+	}
+
+	err = group.Wait()
+	if err != nil {
+		return err
+	}
+	return shared.Err()
+
+Only decoding is serialized, while processing of decoded values happens in
+parallel.
+*/
+func NewSyncScanner(scan Scanner) *SyncScanner {
+	return &SyncScanner{scan: scan}
+}
+
+// Concurrency-safe scanner wrapper, returned by `NewSyncScanner`.
+type SyncScanner struct {
+	lock sync.Mutex
+	scan Scanner
+	done bool
+	err  error
+}
+
+/*
+Advances to the next row and decodes it into the destination. Returns false
+when there are no more rows, or after a decoding error in any consumer, which
+is returned only to that consumer. Errors which stop the iteration, such as
+network errors, are reported by `SyncScanner.Err`.
+*/
+func (self *SyncScanner) Decode(dest interface{}) (bool, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.done || !self.scan.Next() {
+		self.done = true
+		return false, nil
+	}
+
+	err := self.scan.Scan(dest)
+	if err != nil {
+		self.done = true
+		self.err = err
+		return false, err
+	}
+	return true, nil
+}
+
+// Returns the first decoding error, or the error of the underlying scanner.
+func (self *SyncScanner) Err() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.err != nil {
+		return self.err
+	}
+	return self.scan.Err()
+}
+
+/*
+Closes the underlying scanner. Subsequent calls to `SyncScanner.Decode` return
+false.
+*/
+func (self *SyncScanner) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.done = true
+	return self.scan.Close()
+}
+
+// Returns the statistics of the underlying scanner, see `GetScanStats`.
+func (self *SyncScanner) Stats() ScanStats {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return GetScanStats(self.scan)
+}
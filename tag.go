@@ -0,0 +1,116 @@
+package gos
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Parsed `db` tag of a struct field, in the format `db:"name,opt1,opt2"`: the
+column name, followed by comma-separated options. Options modify how the field
+is decoded, encoded or selected. Built-in options:
+
+	key        -- Key of one-to-many merging, see the package docs.
+	readonly   -- Excluded from `ColsInsert`, `ColsAssign` and `StructArgs`.
+	zeronull   -- Zero values become nulls in `StructArgs`.
+	emptynull  -- Empty strings become nulls in `StructArgs`.
+	redact     -- Masked in audit entries, see `StructArgs`.
+	xml        -- Decoded from XML, see the package docs.
+	rest       -- Receives unmatched columns, see the package docs.
+
+Other options are ignored by decoding and encoding, but rejected by
+`ValidateDest`, unless registered via `RegisterColumnOpt`. Exported for
+tooling built on the same tags.
+*/
+type ColumnTag struct {
+	Name string   // Column name; "" if missing or "-".
+	Opts []string // Options in the order of appearance, without whitespace.
+}
+
+/*
+Parses a `db` tag, see `ColumnTag`. The name is the same as the one returned by
+`refut.TagIdent`. Blank options are dropped.
+*/
+func ParseColumnTag(tag string) ColumnTag {
+	var out ColumnTag
+	out.Name = refut.TagIdent(tag)
+
+	index := strings.IndexByte(tag, ',')
+	if index < 0 {
+		return out
+	}
+
+	for _, opt := range strings.Split(tag[index+1:], `,`) {
+		opt = strings.TrimSpace(opt)
+		if opt != `` {
+			out.Opts = append(out.Opts, opt)
+		}
+	}
+	return out
+}
+
+// True if the tag includes the given option.
+func (self ColumnTag) Has(opt string) bool {
+	for _, val := range self.Opts {
+		if val == opt {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Registers additional `db` tag options, so that `ValidateDest` accepts them.
+Meant for options interpreted by other code, via `ParseColumnTag`. Should be
+called during initialization.
+*/
+func RegisterColumnOpt(opts ...string) {
+	columnOpts.Lock()
+	defer columnOpts.Unlock()
+	for _, opt := range opts {
+		columnOpts.set[opt] = struct{}{}
+	}
+}
+
+/* Internal */
+
+var columnOpts = struct {
+	sync.RWMutex
+	set map[string]struct{}
+}{set: map[string]struct{}{
+	`key`:       {},
+	`readonly`:  {},
+	`zeronull`:  {},
+	`emptynull`: {},
+	`redact`:    {},
+	`xml`:       {},
+	`rest`:      {},
+}}
+
+func isColumnOptKnown(opt string) bool {
+	columnOpts.RLock()
+	defer columnOpts.RUnlock()
+	_, ok := columnOpts.set[opt]
+	return ok
+}
+
+func sfieldColumnTag(sfield reflect.StructField) ColumnTag {
+	return ParseColumnTag(sfield.Tag.Get(`db`))
+}
+
+// Used by `ValidateDest` to catch typos in options.
+func validateSfieldColumnOpts(rtype reflect.Type, sfield reflect.StructField) error {
+	for _, opt := range sfieldColumnTag(sfield).Opts {
+		if !isColumnOptKnown(opt) {
+			return ErrInvalidDest.while(`validating destination`).because(fmt.Errorf(
+				`field %q of type %q has unknown option %q in its "db" tag`,
+				sfield.Name, rtype, opt,
+			))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package gos
+
+import (
+	"context"
+)
+
+/*
+Generic variant of `Query` for a single row, which returns the decoded value
+instead of taking a destination pointer. `T` may be any type supported by
+`Query`, including `*T` for an optional row. Example:
+
+	person, err := gos.QueryVal[Person](ctx, conn, `select * from persons where id = $1`, []interface{}{id})
+*/
+func QueryVal[T any](ctx context.Context, conn Queryer, query string, args []interface{}) (T, error) {
+	return QueryValConf[T](ctx, conn, Conf{}, query, args)
+}
+
+// Variant of `QueryVal` that uses the given configuration.
+func QueryValConf[T any](ctx context.Context, conn Queryer, conf Conf, query string, args []interface{}) (T, error) {
+	var out T
+	err := conf.queryInto(ctx, conn, &out, query, args)
+	return out, err
+}
+
+/*
+Generic variant of `Query` for any amount of rows, which returns the decoded
+slice instead of taking a destination pointer. Example:
+
+	persons, err := gos.QuerySlice[Person](ctx, conn, `select * from persons`, nil)
+
+The result is nil when there are no rows.
+*/
+func QuerySlice[T any](ctx context.Context, conn Queryer, query string, args []interface{}) ([]T, error) {
+	return QuerySliceConf[T](ctx, conn, Conf{}, query, args)
+}
+
+// Variant of `QuerySlice` that uses the given configuration.
+func QuerySliceConf[T any](ctx context.Context, conn Queryer, conf Conf, query string, args []interface{}) ([]T, error) {
+	var out []T
+	err := conf.queryInto(ctx, conn, &out, query, args)
+	return out, err
+}
+
+/*
+Generic variant of `QueryScanner`, which decodes rows into values of type `T`,
+see `TypedScanner`. Example:
+
+	scan, err := gos.QueryTypedScanner[Person](ctx, conn, `select * from persons`, nil)
+	if err != nil {
+		return err
+	}
+	defer scan.Close()
+
+	for scan.Next() {
+		person, err := scan.Scan()
+		if err != nil {
+			return err
+		}
+	}
+	return scan.Err()
+*/
+func QueryTypedScanner[T any](ctx context.Context, conn Queryer, query string, args []interface{}) (TypedScanner[T], error) {
+	return QueryTypedScannerConf[T](ctx, conn, Conf{}, query, args)
+}
+
+// Variant of `QueryTypedScanner` that uses the given configuration.
+func QueryTypedScannerConf[T any](ctx context.Context, conn Queryer, conf Conf, query string, args []interface{}) (TypedScanner[T], error) {
+	scan, err := conf.QueryScanner(ctx, conn, query, args)
+	if err != nil {
+		return TypedScanner[T]{}, err
+	}
+	return TypedScanner[T]{scan}, nil
+}
+
+/*
+Wraps a `Scanner`, decoding rows into values of type `T`, which is checked at
+compile time. Returned by `QueryTypedScanner`, and may be used to wrap other
+scanners, such as `BufferedScanner`.
+*/
+type TypedScanner[T any] struct{ Scanner Scanner }
+
+// Same as `Scanner.Close`. MUST be called at the end.
+func (self TypedScanner[T]) Close() error { return self.Scanner.Close() }
+
+// Same as `Scanner.Next`.
+func (self TypedScanner[T]) Next() bool { return self.Scanner.Next() }
+
+// Same as `Scanner.Err`.
+func (self TypedScanner[T]) Err() error { return self.Scanner.Err() }
+
+// Same as `GetScanStats`.
+func (self TypedScanner[T]) Stats() ScanStats { return GetScanStats(self.Scanner) }
+
+// Decodes the current row into a new value of type `T`.
+func (self TypedScanner[T]) Scan() (T, error) {
+	var out T
+	err := self.Scanner.Scan(&out)
+	return out, err
+}
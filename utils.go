@@ -3,6 +3,7 @@ package gos
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"io"
 	"reflect"
 	"time"
@@ -35,8 +36,35 @@ type Execer interface {
 	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
 }
 
+/*
+Database connection required by `ValidateNamedQueries`. Satisfied by `*sql.DB`,
+`*sql.Tx`, may be satisfied by other types.
+*/
+type QueryPreparer interface {
+	Queryer
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+}
+
+/*
+Database connection required by `RetryTx`. Satisfied by `*sql.DB` and
+`*sql.Conn`, may be satisfied by other types.
+*/
+type TxBeginner interface {
+	BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+}
+
 /*
 Decodes individual SQL rows in a streaming fashion. Returned by `QueryScanner()`.
+
+Additional operations are provided by package-level functions which accept any
+`Scanner`: `ScanChunk`, `ScanSlice`, `ScanScalars`, `PeekRow`, `GetScanStats`
+and `NextResultSet`. Some of them rely on the following optional methods,
+which are implemented by the scanners returned by Gos, and may be implemented
+by other scanners:
+
+	Peek(interface{}) error
+	Stats() ScanStats
+	NextResultSet() bool
 */
 type Scanner interface {
 	// Same as `(*sql.Rows).Close`. MUST be called at the end.
@@ -48,11 +76,70 @@ type Scanner interface {
 	// Same as `(*sql.Rows).Err`.
 	Err() error
 
-	// Decodes the current row into the output. For technical reasons, the output
-	// type is cached on the first call and must be the same for every call.
+	// Decodes the current row into the output. The same row may be decoded
+	// several times, into different types. The decoding state of each type is
+	// cached until the next result set. A tuple such as
+	// `[]interface{}{&id, &name}` is scanned positionally, like `ScanScalars`,
+	// and doesn't participate in type caching.
 	Scan(interface{}) error
 }
 
+/*
+Optional interface of destinations that decode rows by hand. When a destination
+implements it, reflection-based decoding is bypassed, and the method receives
+the column names and the raw column values of each row, as returned by the
+driver, with nulls represented as nil. Gos still drives the row loop, which
+allows such types to be used in slices, channels and `Scanner.Scan`. Meant as
+an escape hatch for shapes that don't fit struct decoding. Example:
+
+	func (self *Pair) ScanRow(cols []string, vals []interface{}) error {
+		self.Key, _ = vals[0].(string)
+		self.Val = vals[1]
+		return nil
+	}
+
+Takes priority over mappers registered via `RegisterMapper`. Errors are wrapped
+in `ErrScan`.
+*/
+type RowScanner interface {
+	ScanRow(cols []string, vals []interface{}) error
+}
+
+/*
+Optional interface of struct destinations, invoked for each decoded row before
+assigning columns to fields. Fields without matching columns keep the values
+set by the hook, which makes it suitable for setting defaults or injecting
+fields that don't come from the database. Applies to single structs as well as
+elements of slices, maps and channels, which are allocated for each row. Must
+be implemented on the pointer type. Not invoked for nested structs, or for
+types decoded via `RegisterMapper` or `RowScanner`. Errors are wrapped in
+`ErrScan`. Example:
+
+	func (self *Person) BeforeScan() error {
+		self.Source = `db`
+		return nil
+	}
+*/
+type BeforeScanner interface{ BeforeScan() error }
+
+/*
+Decoding statistics of a `Scanner`, which allow streaming jobs to report
+throughput and to find out whether the database or the decoding is the
+bottleneck.
+*/
+type ScanStats struct {
+	// Count of successfully decoded rows. A row decoded several times, see
+	// `Scanner.Scan`, is counted once.
+	Rows int64
+	// Total time spent in `Scanner.Next`, waiting on the driver to fetch rows.
+	WaitTime time.Duration
+	// Total time spent decoding rows, including conversions by "database/sql".
+	DecodeTime time.Duration
+	// Total size of decoded text and binary column values. Doesn't include
+	// values decoded via mappers, see `RegisterMapper`.
+	Bytes int64
+}
+
 func stringIndex(strs []string, str string) int {
 	for i := range strs {
 		if strs[i] == str {
@@ -62,8 +149,19 @@ func stringIndex(strs []string, str string) int {
 	return -1
 }
 
+func intIndex(vals []int, val int) int {
+	for i := range vals {
+		if vals[i] == val {
+			return i
+		}
+	}
+	return -1
+}
+
 var timeRtype = reflect.TypeOf(time.Time{})
 var sqlScannerRtype = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+var rowScannerRtype = reflect.TypeOf((*RowScanner)(nil)).Elem()
+var beforeScannerRtype = reflect.TypeOf((*BeforeScanner)(nil)).Elem()
 var nullableRtype = reflect.TypeOf((*interface{ IsNull() bool })(nil)).Elem()
 
 func isRtypeScannable(rtype reflect.Type) bool {
@@ -74,7 +172,7 @@ func isRtypeScannable(rtype reflect.Type) bool {
 // WTB better name.
 func isRtypeStructNonScannable(rtype reflect.Type) bool {
 	rtype = refut.RtypeDeref(rtype)
-	return rtype != nil && rtype.Kind() == reflect.Struct && !isRtypeScannable(rtype)
+	return rtype != nil && rtype.Kind() == reflect.Struct && !isRtypeScannable(rtype) && !isRtypeBigNumber(rtype)
 }
 
 func copyIntSlice(src []int) []int {
@@ -86,6 +184,24 @@ func copyIntSlice(src []int) []int {
 	return out
 }
 
+func copyStringSlice(src []string) []string {
+	if src == nil {
+		return nil
+	}
+	out := make([]string, len(src))
+	copy(out, src)
+	return out
+}
+
+func copyInterfaceSlice(src []interface{}) []interface{} {
+	if src == nil {
+		return nil
+	}
+	out := make([]interface{}, len(src))
+	copy(out, src)
+	return out
+}
+
 func isNilableOrHasNilableNonRootAncestor(fieldSpec *tFieldSpec) bool {
 	for fieldSpec != nil {
 		if isRtypeNilable(fieldSpec.typeSpec.rtype) {
@@ -97,11 +213,11 @@ func isNilableOrHasNilableNonRootAncestor(fieldSpec *tFieldSpec) bool {
 }
 
 /*
-TODO: consider validating that the column name doesn't contain double quotes. We
-might return an error, or panic.
+Reports whether the `db` tag of the given field includes the given option, such
+as "readonly" in `db:"id,readonly"`. The column name is not an option.
 */
-func sfieldColumnName(sfield reflect.StructField) string {
-	return refut.TagIdent(sfield.Tag.Get("db"))
+func sfieldHasColumnOpt(sfield reflect.StructField, opt string) bool {
+	return sfieldColumnTag(sfield).Has(opt)
 }
 
 /*
@@ -112,6 +228,13 @@ func truncateSliceRval(rval reflect.Value) {
 	rval.SetLen(0)
 }
 
+// Deletes every entry, keeping the map. The input must be a non-nil map.
+func clearMapRval(rval reflect.Value) {
+	for _, key := range rval.MapKeys() {
+		rval.SetMapIndex(key, reflect.Value{})
+	}
+}
+
 func rtypeDerefKind(rtype reflect.Type) reflect.Kind {
 	rtype = refut.RtypeDeref(rtype)
 	if rtype == nil {
@@ -152,6 +275,23 @@ func rvalZeroAtPath(rval reflect.Value, path []int) {
 	rvalZero(rval)
 }
 
+/*
+Similar to `reflect.Value.FieldByIndex`, but returns nil when encountering a nil
+pointer on the way. Otherwise returns the field's value as `interface{}`.
+*/
+func rvalFieldByPathOrNil(rval reflect.Value, path []int) interface{} {
+	for _, index := range path {
+		for rval.Kind() == reflect.Ptr {
+			if rval.IsNil() {
+				return nil
+			}
+			rval = rval.Elem()
+		}
+		rval = rval.Field(index)
+	}
+	return rval.Interface()
+}
+
 // Assumes that types of `src` and `tar` match.
 func set(tar, src reflect.Value) {
 	if tar.Kind() == reflect.Ptr {
@@ -175,3 +315,129 @@ func set(tar, src reflect.Value) {
 func isRtypeNilable(val reflect.Type) bool {
 	return refut.IsRkindNilable(val.Kind()) || val.ConvertibleTo(nullableRtype)
 }
+
+/*
+True for values of types such as `sql.NullString` or `sql.Null[T]` which
+represent null via `driver.Valuer`, when they're not valid. The input must not
+be a pointer. Values whose `Value` method fails aren't considered null.
+*/
+func isRvalNullValuer(rval reflect.Value) bool {
+	valuer, ok := rval.Interface().(driver.Valuer)
+	if !ok {
+		return false
+	}
+	val, err := valuer.Value()
+	return err == nil && val == nil
+}
+
+/*
+True for embedded structs whose fields are treated as part of the enclosing
+struct. An embedded struct with a column name in its `db` tag is treated as a
+regular nested struct instead, which allows to reuse the same group of columns
+several times under different prefixes.
+*/
+func isSfieldFlattened(sfield reflect.StructField) bool {
+	return sfield.Anonymous &&
+		refut.RtypeDeref(sfield.Type).Kind() == reflect.Struct &&
+		sfieldColumnTag(sfield).Name == ""
+}
+
+/*
+Similar to `refut.TraverseStructRtype`, but flattens only the embedded structs
+that satisfy `isSfieldFlattened`.
+*/
+func traverseStructRtype(rtype reflect.Type, fun func(reflect.StructField, []int) error) error {
+	return traverseStructRtypeAt(refut.RtypeDeref(rtype), fun, nil)
+}
+
+func traverseStructRtypeAt(rtype reflect.Type, fun func(reflect.StructField, []int) error, path []int) error {
+	for i := 0; i < rtype.NumField(); i++ {
+		sfield := rtype.Field(i)
+		if !refut.IsSfieldExported(sfield) {
+			continue
+		}
+
+		path := append(path, i)
+
+		if isSfieldFlattened(sfield) {
+			err := traverseStructRtypeAt(refut.RtypeDeref(sfield.Type), fun, path)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := fun(sfield, path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Returns a deep copy of the given value, recursively copying pointers, slices,
+arrays, maps, interfaces, and exported struct fields. Unexported struct fields
+are copied shallowly.
+*/
+func rvalDeepCopy(rval reflect.Value) reflect.Value {
+	switch rval.Kind() {
+	case reflect.Ptr:
+		if rval.IsNil() {
+			return rval
+		}
+		out := reflect.New(rval.Type().Elem())
+		out.Elem().Set(rvalDeepCopy(rval.Elem()))
+		return out
+
+	case reflect.Slice:
+		if rval.IsNil() {
+			return rval
+		}
+		out := reflect.MakeSlice(rval.Type(), rval.Len(), rval.Len())
+		for i := 0; i < rval.Len(); i++ {
+			out.Index(i).Set(rvalDeepCopy(rval.Index(i)))
+		}
+		return out
+
+	case reflect.Array:
+		out := reflect.New(rval.Type()).Elem()
+		for i := 0; i < rval.Len(); i++ {
+			out.Index(i).Set(rvalDeepCopy(rval.Index(i)))
+		}
+		return out
+
+	case reflect.Map:
+		if rval.IsNil() {
+			return rval
+		}
+		out := reflect.MakeMapWithSize(rval.Type(), rval.Len())
+		iter := rval.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), rvalDeepCopy(iter.Value()))
+		}
+		return out
+
+	case reflect.Interface:
+		if rval.IsNil() {
+			return rval
+		}
+		out := reflect.New(rval.Type()).Elem()
+		out.Set(rvalDeepCopy(rval.Elem()))
+		return out
+
+	case reflect.Struct:
+		out := reflect.New(rval.Type()).Elem()
+		out.Set(rval)
+		for i := 0; i < rval.NumField(); i++ {
+			field := out.Field(i)
+			if field.CanSet() {
+				field.Set(rvalDeepCopy(rval.Field(i)))
+			}
+		}
+		return out
+
+	default:
+		return rval
+	}
+}
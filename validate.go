@@ -0,0 +1,348 @@
+package gos
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Checks every query registered via `RegisterNamedQuery` or
+`RegisterNamedQueryDest` against the live database, without executing it.
+Intended for startup, where it fails fast on drift between queries, the schema
+and Go types, which would otherwise surface in production traffic:
+
+	err := gos.ValidateNamedQueries(ctx, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+Every query is prepared, which checks its syntax and the tables and columns it
+references. For queries with a declared destination type, the result columns
+are obtained by running the query as a subquery with a false condition, using
+null for every argument, and checked against the destination type the same way
+as `Query` would, reporting errors such as `ErrNoColDest`. Such queries must be
+valid as subqueries, which excludes statements such as `insert ... returning`;
+register those via `RegisterNamedQuery`. Stops at the first invalid query, in
+the order of names.
+*/
+func ValidateNamedQueries(ctx context.Context, conn QueryPreparer) error {
+	return Conf{}.ValidateNamedQueries(ctx, conn)
+}
+
+// Variant of `ValidateNamedQueries` that uses the given configuration.
+func (self Conf) ValidateNamedQueries(ctx context.Context, conn QueryPreparer) error {
+	names, vals := namedQueries()
+	for i, name := range names {
+		err := self.validateNamedQuery(ctx, conn, vals[i])
+		if err != nil {
+			return Err{While: fmt.Sprintf(`validating named query %q`, name), Cause: err}
+		}
+	}
+	return nil
+}
+
+/*
+Checks the given destination type for mapping problems, without touching a
+database, which makes it suitable for table-driven tests over all model types:
+
+	func TestModels(t *testing.T) {
+		for _, val := range []interface{}{Person{}, []Order(nil)} {
+			err := gos.ValidateDest(val)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+Accepts a value of the destination type or a pointer to it; for slices, maps of
+structs and channels, the element type is checked. Reports unexported fields
+with column names in their `db` tags, which are silently ignored by decoding,
+as `ErrInvalidDest`; redundant occurrences of the same column as
+`ErrRedundantCol`; cyclic nesting of structs as `ErrInvalidDest`; and fields of
+types which can't be decoded from a column without a registered decoder, such
+as channels, functions, maps, or slices other than byte slices and one-to-many
+slices of structs, as `ErrInvalidDest`. Returns the first problem found. Types
+with registered mappers, see `RegisterMapper`, and types implementing
+`RowScanner` are not checked. Interfaces registered via `RegisterVariants` are
+checked by checking each variant.
+*/
+func ValidateDest(dest interface{}) error {
+	rtype := rowDestRtype(refut.RtypeDeref(reflect.TypeOf(dest)))
+	if rtype == nil {
+		return ErrInvalidDest.while(`validating destination`).because(
+			fmt.Errorf(`missing destination type`),
+		)
+	}
+
+	switch rowDestKind(rtype) {
+	case rowDestRow, rowDestRaw, rowDestRowScanner, rowDestMapper, rowDestDecoder:
+		return nil
+
+	case rowDestVariants:
+		variants, _ := getVariants(rtype)
+		for _, typ := range variants.types {
+			err := ValidateDest(reflect.Zero(typ).Interface())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case rowDestStruct:
+		rtype = refut.RtypeDeref(rtype)
+		_, err := structRestPath(rtype)
+		if err != nil {
+			return err
+		}
+		return validateStructRtype(rtype, nil, nil, map[string]struct{}{})
+
+	default:
+		if !isRtypeDecodable(rtype) && !isRtypeByteArray(rtype) && !isRtypeHstore(rtype) && !isRtypeBigNumber(rtype) {
+			return ErrInvalidDest.while(`validating destination`).because(
+				fmt.Errorf(`unsupported scalar destination type %q`, rtype),
+			)
+		}
+		return nil
+	}
+}
+
+/* Internal */
+
+/*
+Implements `ValidateDest` for struct types, following the same rules as
+`traverseMakeSpec`. Aliases are shared across the entire destination type.
+*/
+func validateStructRtype(rtype reflect.Type, colPath []string, ancestors []reflect.Type, aliases map[string]struct{}) error {
+	for _, val := range ancestors {
+		if val == rtype {
+			return ErrInvalidDest.while(`validating destination`).because(
+				fmt.Errorf(`cyclic nesting of type %q`, rtype),
+			)
+		}
+	}
+	ancestors = append(ancestors, rtype)
+
+	for i := 0; i < rtype.NumField(); i++ {
+		sfield := rtype.Field(i)
+
+		if !refut.IsSfieldExported(sfield) {
+			name := sfieldColumnTag(sfield).Name
+			if name != `` {
+				return ErrInvalidDest.while(`validating destination`).because(fmt.Errorf(
+					`unexported field %q of type %q has column name %q, but will be ignored`,
+					sfield.Name, rtype, name,
+				))
+			}
+			continue
+		}
+
+		err := validateSfieldColumnOpts(rtype, sfield)
+		if err != nil {
+			return err
+		}
+
+		if isSfieldFlattened(sfield) {
+			err := validateStructRtype(refut.RtypeDeref(sfield.Type), colPath, ancestors, aliases)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		colName := sfieldColumnName(sfield)
+		if colName == `` {
+			continue
+		}
+
+		colPath := append(colPath, colName)
+		alias := strings.Join(colPath, aliasSeparator())
+
+		_, ok := aliases[alias]
+		if ok {
+			return Err{
+				Code:  ErrCodeRedundantCol,
+				While: `validating destination`,
+				Cause: fmt.Errorf(`redundant occurrence of column %q`, alias),
+			}
+		}
+		aliases[alias] = struct{}{}
+
+		if findDecoder(rtype, sfield, ``) != nil ||
+			hasColumnDecodersFor(sfield.Type) ||
+			builtinDecoder(sfield, tSpecOpts{}) != nil {
+			continue
+		}
+
+		if isRtypeStructNonScannable(sfield.Type) {
+			err := validateStructRtype(refut.RtypeDeref(sfield.Type), colPath, ancestors, aliases)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isRtypeManyStruct(sfield.Type) {
+			_, err := structKeyPath(sfield.Type.Elem())
+			if err != nil {
+				return err
+			}
+
+			err = validateStructRtype(refut.RtypeDeref(sfield.Type.Elem()), colPath, ancestors, aliases)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !isRtypeDecodable(sfield.Type) {
+			return ErrInvalidDest.while(`validating destination`).because(fmt.Errorf(
+				`field %q of type %q has unsupported type %q`, sfield.Name, rtype, sfield.Type,
+			))
+		}
+	}
+	return nil
+}
+
+/*
+True for types which `database/sql` can decode a column into without help:
+scanners, `time.Time`, `interface{}`, primitives, byte slices, and pointers to
+any of them.
+*/
+func isRtypeDecodable(rtype reflect.Type) bool {
+	if rtype == interfaceRtype || isRtypeScannable(rtype) {
+		return true
+	}
+
+	switch rtype.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Ptr:
+		return isRtypeDecodable(rtype.Elem())
+	case reflect.Slice:
+		return rtype.Elem().Kind() == reflect.Uint8
+	default:
+		return false
+	}
+}
+
+func (self Conf) validateNamedQuery(ctx context.Context, conn QueryPreparer, val tNamedQuery) error {
+	stmt, err := conn.PrepareContext(ctx, val.query)
+	if err != nil {
+		return Err{While: `preparing query`, Cause: err}
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return Err{While: `closing statement`, Cause: err}
+	}
+
+	if val.rtype == nil {
+		return nil
+	}
+
+	args := make([]interface{}, queryParamCount(val.query))
+	rows, err := conn.QueryContext(ctx, wrapSelect(val.query, `*`)+` where false`, args...)
+	if err != nil {
+		return Err{While: `querying columns`, Cause: err}
+	}
+	defer rows.Close()
+
+	return self.validateCols(rows, val.rtype)
+}
+
+/*
+Checks the columns of the result set against the destination type, mirroring
+the decoding logic of `Query` and `Scanner.Scan`, see `rowDestKind`.
+*/
+func (self Conf) validateCols(rows Rows, rtype reflect.Type) error {
+	deref := refut.RtypeDeref(rtype)
+	if deref.Kind() == reflect.Map && isRtypeStructNonScannable(deref.Elem()) {
+		_, err := mapKeyPath(deref.Elem(), deref.Key(), self.MapKey)
+		if err != nil {
+			return err
+		}
+	}
+	return self.validateRowCols(rows, rowDestRtype(rtype))
+}
+
+// Implements `Conf.validateCols` for the type decoded from each row.
+func (self Conf) validateRowCols(rows Rows, rtype reflect.Type) error {
+	kind := rowDestKind(rtype)
+	switch kind {
+	case rowDestRow, rowDestRaw, rowDestRowScanner:
+		return nil
+
+	case rowDestStruct:
+		_, err := prepareDestSpec(rows, reflect.PtrTo(rtype), self)
+		return err
+	}
+
+	colNames, err := rows.Columns()
+	if err != nil {
+		return Err{While: `getting columns`, Cause: err}
+	}
+
+	switch kind {
+	case rowDestMapper:
+		mapper, _ := getMapper(rtype)
+		_, err := prepareMapping(colNames, rtype, mapper, self.IgnoreUnknownCols)
+		return err
+
+	case rowDestVariants:
+		variants, _ := getVariants(rtype)
+		if stringIndex(colNames, variants.col) < 0 {
+			return ErrMissingCol.while(`validating columns`).because(fmt.Errorf(
+				`missing discriminator column %q of %q`, variants.col, rtype,
+			))
+		}
+
+		// Variants ignore unknown columns, see `scanner.scanVariant`.
+		conf := self
+		conf.IgnoreUnknownCols = true
+		for _, typ := range variants.types {
+			err := conf.validateRowCols(rows, refut.RtypeDeref(typ))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		if len(colNames) != 1 {
+			return ErrInvalidDest.while(`validating columns`).because(fmt.Errorf(
+				`expected 1 column for scalar destination %q, got %v`, rtype, len(colNames),
+			))
+		}
+		return nil
+	}
+}
+
+/*
+Returns the highest ordinal of Postgres-style parameters such as "$1" in the
+query. Doesn't account for string literals or comments.
+*/
+func queryParamCount(query string) int {
+	var out int
+	for i := 0; i < len(query); i++ {
+		if query[i] != '$' {
+			continue
+		}
+
+		var val int
+		for i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9' {
+			i++
+			val = val*10 + int(query[i]-'0')
+		}
+		if val > out {
+			out = val
+		}
+	}
+	return out
+}
@@ -0,0 +1,262 @@
+package gos
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Registers the concrete struct types behind the interface type `T`, selected by
+the value of a discriminator column. This allows a single query over a
+polymorphic table, such as an event log, to decode each row into the right
+type. Destinations such as `*T`, `*[]T` or `chan T` then work like usual.
+Example:
+
+	type Event interface{ EventKind() string }
+
+	gos.RegisterVariants[Event](`kind`, map[string]interface{}{
+		`created`: Created{},
+		`deleted`: &Deleted{},
+	})
+
+	var events []Event
+	err := gos.Query(ctx, conn, &events, `select * from events`, nil)
+
+Each variant is given as a value of its struct type, or a pointer to it; the
+interface receives a value or a pointer respectively, which must implement `T`.
+The discriminator value is compared as text, which also works for integer
+columns. Rows are decoded into variants following the usual rules, except that
+columns without matching fields are ignored, since different variants usually
+use different columns of the same table. Rows with a null or unregistered
+discriminator fail with `ErrScan`, and result sets without the discriminator
+column fail with `ErrMissingCol`.
+
+Registering variants for the same type again replaces the previous ones.
+Should be called during initialization, before running queries.
+*/
+func RegisterVariants[T any](col string, variants map[string]interface{}) {
+	rtype := reflect.TypeOf((*T)(nil)).Elem()
+	if rtype.Kind() != reflect.Interface {
+		panic(ErrInvalidInput.while(`registering variants`).because(fmt.Errorf(
+			`expected an interface type, got %q`, rtype,
+		)))
+	}
+
+	types := make(map[string]reflect.Type, len(variants))
+	for key, val := range variants {
+		typ := reflect.TypeOf(val)
+		if !isRtypeStructNonScannable(typ) || !typ.Implements(rtype) {
+			panic(ErrInvalidInput.while(`registering variants`).because(fmt.Errorf(
+				`variant %q of %q must be a struct or struct pointer implementing the interface, got %q`,
+				key, rtype, typ,
+			)))
+		}
+		types[key] = typ
+	}
+
+	variantRegistry.Lock()
+	defer variantRegistry.Unlock()
+	variantRegistry.types[rtype] = &tVariants{col: col, types: types}
+}
+
+/* Internal */
+
+var variantRegistry = struct {
+	sync.RWMutex
+	types map[reflect.Type]*tVariants
+}{types: map[reflect.Type]*tVariants{}}
+
+type tVariants struct {
+	col   string
+	types map[string]reflect.Type // Struct types or struct pointer types.
+}
+
+func getVariants(rtype reflect.Type) (*tVariants, bool) {
+	variantRegistry.RLock()
+	defer variantRegistry.RUnlock()
+	val, ok := variantRegistry.types[rtype]
+	return val, ok
+}
+
+/*
+Decoding state of polymorphic rows for a specific result set. Each row is
+scanned as raw values, which are then replayed into a scanner specific to the
+variant, which caches the decoding spec of that variant.
+*/
+type tVariantScan struct {
+	rows     tRawRows
+	colIndex int // Discriminator column.
+	scanners map[reflect.Type]*scanner
+}
+
+func (self *scanner) scanVariant(rval reflect.Value, variants *tVariants) error {
+	if self.typ.variantScan == nil {
+		colNames, err := self.Rows.Columns()
+		if err != nil {
+			return Err{While: `getting columns`, Cause: err}
+		}
+
+		colIndex := stringIndex(colNames, variants.col)
+		if colIndex < 0 {
+			return ErrMissingCol.while(`decoding variant`).because(fmt.Errorf(
+				`missing discriminator column %q of %q`, variants.col, rval.Type().Elem(),
+			))
+		}
+
+		colDbTypes, err := rowsColDbTypes(self.Rows)
+		if err != nil {
+			return err
+		}
+
+		self.typ.variantScan = &tVariantScan{
+			rows:     tRawRows{cols: colNames, dbTypes: colDbTypes},
+			colIndex: colIndex,
+			scanners: map[reflect.Type]*scanner{},
+		}
+	}
+	state := self.typ.variantScan
+
+	vals, err := scanRawVals(self.Rows, len(state.rows.cols))
+	if err != nil {
+		return err
+	}
+	self.countBytes(vals...)
+
+	key, ok := variantKey(vals[state.colIndex])
+	typ := variants.types[key]
+	if !ok || typ == nil {
+		return ErrScan.while(`decoding variant`).because(fmt.Errorf(
+			`unknown value %#v of discriminator column %q of %q`,
+			vals[state.colIndex], variants.col, rval.Type().Elem(),
+		))
+	}
+
+	sub := state.scanners[typ]
+	if sub == nil {
+		conf := self.conf
+		conf.IgnoreUnknownCols = true
+		sub = &scanner{Rows: &state.rows, conf: conf}
+		state.scanners[typ] = sub
+	}
+
+	ptr := reflect.New(refut.RtypeDeref(typ))
+	state.rows.vals = vals
+	err = sub.scan(ptr.Interface())
+	if err != nil {
+		return err
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		rval.Elem().Set(ptr)
+	} else {
+		rval.Elem().Set(ptr.Elem())
+	}
+	return nil
+}
+
+// Returns the text of a discriminator value, or false for nulls.
+func variantKey(val interface{}) (string, bool) {
+	switch val := val.(type) {
+	case nil:
+		return ``, false
+	case string:
+		return val, true
+	case []byte:
+		return string(val), true
+	case int64:
+		return strconv.FormatInt(val, 10), true
+	default:
+		return fmt.Sprint(val), true
+	}
+}
+
+/*
+Implements `Rows` over a single row of raw values, which have already been
+scanned from the actual rows. Used for decoding the row again, into a type
+known only after scanning.
+*/
+type tRawRows struct {
+	cols    []string
+	dbTypes []string
+	vals    []interface{}
+}
+
+func (self *tRawRows) Columns() ([]string, error)       { return self.cols, nil }
+func (self *tRawRows) ColumnDbTypes() ([]string, error) { return self.dbTypes, nil }
+func (self *tRawRows) Next() bool                       { return false }
+func (self *tRawRows) Err() error                       { return nil }
+func (self *tRawRows) Close() error                     { return nil }
+
+func (self *tRawRows) Scan(dests ...interface{}) error {
+	if len(dests) != len(self.vals) {
+		return fmt.Errorf(`expected %d destination arguments in Scan, not %d`, len(self.vals), len(dests))
+	}
+
+	for i, dest := range dests {
+		err := assignRaw(self.vals[i], reflect.ValueOf(dest).Elem())
+		if err != nil {
+			return fmt.Errorf(`failed to assign column %q: %w`, self.cols[i], err)
+		}
+	}
+	return nil
+}
+
+/*
+Assigns a raw column value, as returned by the driver, to the destination,
+similarly to `(*sql.Rows).Scan`: `sql.Scanner` is used when implemented,
+pointers are allocated as needed, nil pointers accept nulls, and other
+mismatches are handled by `coerce`.
+*/
+func assignRaw(src interface{}, dest reflect.Value) error {
+	if dest.CanAddr() {
+		scanner, ok := dest.Addr().Interface().(sql.Scanner)
+		if ok {
+			return scanner.Scan(src)
+		}
+	}
+
+	if dest.Kind() == reflect.Ptr {
+		if src == nil {
+			rvalZero(dest)
+			return nil
+		}
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		return assignRaw(src, dest.Elem())
+	}
+
+	if src == nil {
+		if isRtypeNilable(dest.Type()) {
+			rvalZero(dest)
+			return nil
+		}
+		return ErrNull.because(fmt.Errorf(`can't assign null to non-nilable %q`, dest.Type()))
+	}
+
+	srcRval := reflect.ValueOf(src)
+	srcRtype := srcRval.Type()
+
+	if srcRtype.AssignableTo(dest.Type()) {
+		dest.Set(srcRval)
+		return nil
+	}
+
+	if srcRtype.ConvertibleTo(dest.Type()) &&
+		(srcRtype.Kind() == dest.Kind() || isStringOrBytes(srcRtype) && isStringOrBytes(dest.Type())) {
+		dest.Set(srcRval.Convert(dest.Type()))
+		return nil
+	}
+
+	return coerce(src, dest)
+}
+
+func isStringOrBytes(rtype reflect.Type) bool {
+	return rtype.Kind() == reflect.String ||
+		rtype.Kind() == reflect.Slice && rtype.Elem().Kind() == reflect.Uint8
+}
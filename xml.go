@@ -0,0 +1,52 @@
+package gos
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+
+	"github.com/mitranim/refut"
+)
+
+/*
+Decodes an XML column via "encoding/xml". Used as a `DecodeFunc` for fields
+that implement `xml.Unmarshaler`, or whose `db` tag includes the `xml` option,
+such as `db:"payload,xml"`. Nilable fields accept nulls.
+*/
+func decodeXml(src interface{}, dest reflect.Value) error {
+	if src == nil {
+		if isRtypeNilable(dest.Type()) {
+			rvalZero(dest)
+			return nil
+		}
+		return ErrNull.because(fmt.Errorf(`can't decode null into non-nilable %q`, dest.Type()))
+	}
+
+	var buf []byte
+	switch src := src.(type) {
+	case []byte:
+		buf = src
+	case string:
+		buf = []byte(src)
+	default:
+		return fmt.Errorf(`can't decode %T into %q as XML`, src, dest.Type())
+	}
+
+	rvalZero(dest)
+	return xml.Unmarshal(buf, dest.Addr().Interface())
+}
+
+/*
+True if the field should be decoded via `decodeXml`. Types that implement
+`sql.Scanner` are decoded as usual, unless explicitly tagged.
+*/
+func isSfieldXml(sfield reflect.StructField) bool {
+	if sfieldHasColumnOpt(sfield, `xml`) {
+		return true
+	}
+
+	rtype := refut.RtypeDeref(sfield.Type)
+	return !isRtypeScannable(rtype) && reflect.PtrTo(rtype).Implements(xmlUnmarshalerRtype)
+}
+
+var xmlUnmarshalerRtype = reflect.TypeOf((*xml.Unmarshaler)(nil)).Elem()